@@ -0,0 +1,298 @@
+package snmpgo
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+)
+
+// GetHandler returns the value of the OID requested by the GetRequest,
+// or nil if the OID is not served (answered with the noSuchObject).
+type GetHandler func(oid *Oid) Variable
+
+// GetNextHandler returns the VarBind following the OID requested by the GetNextRequest
+// or GetBulkRequest, or nil at the end of the MIB view (answered with the endOfMibView).
+type GetNextHandler func(oid *Oid) *VarBind
+
+// RequestHandler returns the GetResponse of the request, or nil not to answer it.
+type RequestHandler func(req Pdu) Pdu
+
+// An Agent answers the GetRequest, GetNextRequest and GetBulkRequest of SNMP V2c
+// by the handlers (e.g. for simulating a network element in tests).
+// The requests with a community not registered by AddSecurity are dropped,
+// and the other requests are answered with the genErr (unless served by a RequestHandler).
+type Agent struct {
+	args      *ServerArguments
+	mp        messageProcessing
+	secs      *securityMap
+	transport transport
+	servingMu sync.RWMutex
+	serving   bool
+
+	// Error Logger which will be used for logging of default errors
+	ErrorLog StdLogger
+}
+
+// AddSecurity registers the community accepted by the Agent, only V2c is supported.
+func (a *Agent) AddSecurity(entry *SecurityEntry) error {
+	if entry.Version != V2c {
+		return &ArgumentError{
+			Value:   entry.Version,
+			Message: "Unsupported SNMP Version",
+		}
+	}
+	if err := entry.validate(); err != nil {
+		return err
+	}
+	a.secs.Set(newSecurityFromEntry(entry))
+	return nil
+}
+
+// DeleteSecurity unregisters the community.
+func (a *Agent) DeleteSecurity(entry *SecurityEntry) error {
+	if err := entry.validate(); err != nil {
+		return err
+	}
+	a.secs.Delete(newSecurityFromEntry(entry))
+	return nil
+}
+
+// Serve starts answering the requests by the handlers.
+// Serve blocks, the caller should call Close when finished, to shut it down.
+func (a *Agent) Serve(get GetHandler, next GetNextHandler) error {
+	if get == nil || next == nil {
+		return &ArgumentError{Message: "handler is nil"}
+	}
+	return a.ServeRequests(NewRequestHandler(get, next))
+}
+
+// ServeRequests is like Serve, but answers the requests by the RequestHandler.
+func (a *Agent) ServeRequests(handler RequestHandler) error {
+	if handler == nil {
+		return &ArgumentError{Message: "handler is nil"}
+	}
+	a.servingMu.Lock()
+	a.serving = true
+	a.servingMu.Unlock()
+	return serveTransport(a.transport, a.args.MessageMaxSize, a.isServing, a.logf, "agent",
+		func(conn interface{}, msg message, src net.Addr, err error) {
+			if err == nil {
+				go a.handle(conn, msg, src, handler)
+			}
+		})
+}
+
+// Close shuts down the Agent.
+func (a *Agent) Close() error {
+	a.servingMu.Lock()
+	a.serving = false
+	a.servingMu.Unlock()
+	return a.transport.Close(nil)
+}
+
+func (a *Agent) isServing() bool {
+	a.servingMu.RLock()
+	defer a.servingMu.RUnlock()
+	return a.serving
+}
+
+// handle a newly received request
+func (a *Agent) handle(conn interface{}, msg message, src net.Addr, handler RequestHandler) {
+	defer recoverPanic(a.logf, "agent: panic while answering", src)
+
+	if msg.Version() != a.mp.Version() {
+		return
+	}
+	limitVarBinds(msg.Pdu(), a.args.MaxVarBinds)
+	sec := a.secs.Lookup(msg)
+	if sec == nil {
+		return
+	}
+	req, err := a.mp.PrepareDataElements(sec, msg, nil)
+	if err != nil || !confirmedType(req.PduType()) {
+		return
+	}
+
+	res := handler(req)
+	if res == nil {
+		return
+	}
+	if err = a.respond(conn, src, sec, msg, res, req.PduType() == GetBulkRequest); err != nil &&
+		a.isServing() {
+		a.logf("agent: failed to send response %v: %v", src, err)
+	}
+}
+
+// NewRequestHandler returns a RequestHandler, which answers the GetRequest, GetNextRequest
+// and GetBulkRequest by the handlers, and the other requests with the genErr.
+func NewRequestHandler(get GetHandler, next GetNextHandler) RequestHandler {
+	return func(req Pdu) Pdu {
+		res := NewPdu(V2c, GetResponse)
+		reqBinds := req.VarBinds()
+		switch req.PduType() {
+		case GetRequest:
+			for _, v := range reqBinds {
+				if val := get(v.Oid); val != nil {
+					res.AppendVarBind(v.Oid, val)
+				} else {
+					res.AppendVarBind(v.Oid, NewNoSuchObject())
+				}
+			}
+		case GetNextRequest:
+			for _, v := range reqBinds {
+				vb := nextVarBind(next, v.Oid)
+				res.AppendVarBind(vb.Oid, vb.Variable)
+			}
+		case GetBulkRequest:
+			// the non-repeaters and max-repetitions are in the error status and index
+			nonRepeaters, maxRepetitions := int(req.ErrorStatus()), req.ErrorIndex()
+			if nonRepeaters < 0 {
+				nonRepeaters = 0
+			} else if nonRepeaters > len(reqBinds) {
+				nonRepeaters = len(reqBinds)
+			}
+			for _, v := range reqBinds[:nonRepeaters] {
+				vb := nextVarBind(next, v.Oid)
+				res.AppendVarBind(vb.Oid, vb.Variable)
+			}
+			var oids Oids
+			for _, v := range reqBinds[nonRepeaters:] {
+				oids = append(oids, v.Oid)
+			}
+			// the response is truncated to the MessageMaxSize anyway,
+			// so that the huge max-repetitions are not expanded
+			if n := len(oids); n > 0 && maxRepetitions > (maxVarBindsDefault-nonRepeaters)/n {
+				maxRepetitions = (maxVarBindsDefault - nonRepeaters) / n
+			}
+			for r := 0; r < maxRepetitions && len(oids) > 0; r++ {
+				ended := true
+				for i, oid := range oids {
+					vb := nextVarBind(next, oid)
+					res.AppendVarBind(vb.Oid, vb.Variable)
+					if _, ok := vb.Variable.(*EndOfMibView); !ok {
+						ended = false
+					}
+					oids[i] = vb.Oid
+				}
+				if ended {
+					break
+				}
+			}
+		default:
+			res = NewPduWithVarBinds(V2c, GetResponse, reqBinds)
+			res.SetErrorStatus(GenError)
+		}
+		return res
+	}
+}
+
+// nextVarBind calls the GetNextHandler, the endOfMibView is returned in place of nil
+func nextVarBind(next GetNextHandler, oid *Oid) *VarBind {
+	if vb := next(oid); vb != nil {
+		return vb
+	}
+	return NewVarBind(oid, NewEndOfMibView())
+}
+
+// respond sends the response within the MessageMaxSize.
+// The response of GetBulkRequest is truncated, the others are replaced with the tooBig.
+// (RFC3416 Section 4.2)
+func (a *Agent) respond(conn interface{}, src net.Addr, sec security, msg message,
+	pdu Pdu, truncatable bool) error {
+
+	pkt, err := a.marshalResponse(sec, msg, pdu)
+	if err == nil && len(pkt) > a.args.MessageMaxSize && truncatable {
+		pkt, err = a.truncateResponse(sec, msg, pdu.VarBinds())
+	}
+	if err == nil && len(pkt) > a.args.MessageMaxSize {
+		tooBig := NewPdu(V2c, GetResponse)
+		tooBig.SetErrorStatus(TooBig)
+		if pkt, err = a.marshalResponse(sec, msg, tooBig); err == nil && len(pkt) > a.args.MessageMaxSize {
+			err = &MessageError{
+				Message: fmt.Sprintf("Response exceeds MessageMaxSize %d", a.args.MessageMaxSize),
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return a.transport.Write(conn, pkt, src)
+}
+
+// truncateResponse returns the response of the most leading VarBinds within the MessageMaxSize,
+// the number of them is searched by the bisection. The response of the first VarBind is
+// returned if none fits.
+func (a *Agent) truncateResponse(sec security, msg message, varBinds VarBinds) ([]byte, error) {
+	pkt, err := a.marshalResponse(sec, msg, NewPduWithVarBinds(V2c, GetResponse, varBinds[:1]))
+	if err != nil || len(pkt) > a.args.MessageMaxSize {
+		return pkt, err
+	}
+	// the response of the fit VarBinds is within the MessageMaxSize, and the over is not
+	fit, over := 1, len(varBinds)
+	for over-fit > 1 {
+		n := (fit + over) / 2
+		p, err := a.marshalResponse(sec, msg, NewPduWithVarBinds(V2c, GetResponse, varBinds[:n]))
+		if err != nil {
+			return nil, err
+		}
+		if len(p) <= a.args.MessageMaxSize {
+			fit, pkt = n, p
+		} else {
+			over = n
+		}
+	}
+	return pkt, nil
+}
+
+func (a *Agent) marshalResponse(sec security, msg message, pdu Pdu) ([]byte, error) {
+	respMsg, err := a.mp.PrepareResponseMessage(sec, pdu, msg)
+	if err != nil {
+		return nil, err
+	}
+	return respMsg.Marshal()
+}
+
+func (a *Agent) logf(format string, args ...interface{}) {
+	if l := a.ErrorLog; l != nil {
+		l.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// NewAgent returns a new Agent listening on the LocalAddr of the arguments,
+// the V3 specific arguments are ignored.
+// The MessageMaxSize defaults to 1400 same as the client.
+func NewAgent(args ServerArguments) (*Agent, error) {
+	if args.MessageMaxSize == 0 {
+		args.MessageMaxSize = msgSizeDefault
+	}
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	args.setDefault()
+
+	return &Agent{
+		args:      &args,
+		mp:        newMessageProcessing(V2c),
+		secs:      newSecurityMap(),
+		transport: newTransport(&args),
+	}, nil
+}
+
+// NewAgentWithConn is like NewAgent, but receives on the already bound conn
+// instead of listening on the LocalAddr. The conn is closed when the Agent is closed.
+func NewAgentWithConn(conn net.PacketConn, args ServerArguments) (*Agent, error) {
+	if conn == nil {
+		return nil, &ArgumentError{Message: "conn is nil"}
+	}
+	args.LocalAddr = conn.LocalAddr().String()
+
+	a, err := NewAgent(args)
+	if err != nil {
+		return nil, err
+	}
+	a.transport.(*packetTransport).boundConn = conn
+	return a, nil
+}
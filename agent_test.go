@@ -0,0 +1,191 @@
+package snmpgo_test
+
+import (
+	"errors"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/k-sone/snmpgo"
+)
+
+func newTestAgent(t *testing.T, mib snmpgo.VarBinds) *snmpgo.Agent {
+	agent, err := snmpgo.NewAgent(snmpgo.ServerArguments{
+		Network:   "udp4",
+		LocalAddr: "127.0.0.1:0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = agent.AddSecurity(&snmpgo.SecurityEntry{
+		Version:   snmpgo.V2c,
+		Community: "public",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	mib = mib.Sort()
+	get := func(oid *snmpgo.Oid) snmpgo.Variable {
+		if v := mib.MatchOid(oid); v != nil {
+			return v.Variable
+		}
+		return nil
+	}
+	next := func(oid *snmpgo.Oid) *snmpgo.VarBind {
+		for _, v := range mib {
+			if v.Oid.Compare(oid) > 0 {
+				return v
+			}
+		}
+		return nil
+	}
+	go agent.Serve(get, next)
+	return agent
+}
+
+func newAgentClient(t *testing.T, agent *snmpgo.Agent, community string) *snmpgo.SNMP {
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   snmpgo.ListeningAgentAddress(agent),
+		Network:   "udp4",
+		Timeout:   200 * time.Millisecond,
+		Community: community,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snmp
+}
+
+func TestAgent(t *testing.T) {
+	ifDescr1, _ := snmpgo.NewOid("1.3.6.1.2.1.2.2.1.2.1")
+	ifDescr2, _ := snmpgo.NewOid("1.3.6.1.2.1.2.2.1.2.2")
+	agent := newTestAgent(t, snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+		snmpgo.NewVarBind(ifDescr1, snmpgo.NewOctetString([]byte("eth0"))),
+		snmpgo.NewVarBind(ifDescr2, snmpgo.NewOctetString([]byte("eth1"))),
+	})
+	defer agent.Close()
+
+	snmp := newAgentClient(t, agent, "public")
+	defer snmp.Close()
+
+	unknown, _ := snmpgo.NewOid("1.3.6.1.2.1.1.1.0")
+	pdu, err := snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime, unknown})
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if pdu.ErrorStatus() != snmpgo.NoError || len(pdu.VarBinds()) != 2 {
+		t.Fatalf("GetRequest() - unexpected pdu %v", pdu)
+	}
+	if v := pdu.VarBinds()[0]; !v.Oid.Equal(snmpgo.OidSysUpTime) || v.Variable.String() != snmpgo.NewTimeTicks(100).String() {
+		t.Errorf("GetRequest() - unexpected VarBind %v", v)
+	}
+	if v := pdu.VarBinds()[1]; v.Variable.Type() != "NoSuchObject" {
+		t.Errorf("GetRequest() - expected noSuchObject, actual %v", v)
+	}
+
+	base, _ := snmpgo.NewOid("1.3.6.1.2.1.2.2.1.2")
+	pdu, err = snmp.GetNextRequest(snmpgo.Oids{base})
+	if err != nil {
+		t.Fatalf("GetNextRequest() - has error %v", err)
+	}
+	if v := pdu.VarBinds()[0]; !v.Oid.Equal(ifDescr1) || v.Variable.String() != "eth0" {
+		t.Errorf("GetNextRequest() - unexpected VarBind %v", v)
+	}
+
+	pdu, err = snmp.GetBulkWalk(snmpgo.Oids{base}, 0, 10)
+	if err != nil {
+		t.Fatalf("GetBulkWalk() - has error %v", err)
+	}
+	if vbs := pdu.VarBinds(); len(vbs) != 2 || !vbs[0].Oid.Equal(ifDescr1) || !vbs[1].Oid.Equal(ifDescr2) {
+		t.Errorf("GetBulkWalk() - unexpected pdu %v", pdu)
+	}
+}
+
+func TestAgentGetBulkRepetitions(t *testing.T) {
+	// an endless MIB, which increments the last sub-identifier
+	next := func(oid *snmpgo.Oid) *snmpgo.VarBind {
+		o := oid.Copy()
+		o.Value[len(o.Value)-1]++
+		return snmpgo.NewVarBind(o, snmpgo.NewNull())
+	}
+	handler := snmpgo.NewRequestHandler(func(*snmpgo.Oid) snmpgo.Variable { return nil }, next)
+
+	req := snmpgo.NewPduWithOids(snmpgo.V2c, snmpgo.GetBulkRequest, snmpgo.Oids{
+		snmpgo.MustNewOid("1.3.6.1.2.1.1"), snmpgo.MustNewOid("1.3.6.1.2.1.2"),
+	})
+	req.SetNonrepeaters(0)
+	req.SetMaxRepetitions(math.MaxInt32)
+	if n := len(handler(req).VarBinds()); n != snmpgo.MaxVarBindsDefault {
+		t.Errorf("NewRequestHandler() - expected %d VarBinds, actual %d", snmpgo.MaxVarBindsDefault, n)
+	}
+
+	// the response is truncated to the MessageMaxSize
+	agent, err := snmpgo.NewAgent(snmpgo.ServerArguments{
+		Network:   "udp4",
+		LocalAddr: "127.0.0.1:0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = agent.AddSecurity(&snmpgo.SecurityEntry{
+		Version:   snmpgo.V2c,
+		Community: "public",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	go agent.ServeRequests(handler)
+	defer agent.Close()
+
+	snmp := newAgentClient(t, agent, "public")
+	defer snmp.Close()
+
+	oids := snmpgo.Oids{snmpgo.MustNewOid("1.3.6.1.2.1.1")}
+	pdu, err := snmp.GetBulkRequest(oids, 0, 1000)
+	if err != nil {
+		t.Fatalf("GetBulkRequest() - has error %v", err)
+	}
+	if n := len(pdu.VarBinds()); n == 0 || n >= 1000 {
+		t.Errorf("GetBulkRequest() - expected the truncated response, actual %d VarBinds", n)
+	}
+}
+
+func TestAgentCommunityMismatch(t *testing.T) {
+	agent := newTestAgent(t, snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+	})
+	defer agent.Close()
+
+	snmp := newAgentClient(t, agent, "private")
+	defer snmp.Close()
+
+	_, err := snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime})
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("GetRequest() - expected timeout, actual %v", err)
+	}
+}
+
+func TestAgentArguments(t *testing.T) {
+	agent, err := snmpgo.NewAgent(snmpgo.ServerArguments{LocalAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = agent.AddSecurity(&snmpgo.SecurityEntry{
+		Version:  snmpgo.V3,
+		UserName: "MyName",
+	}); err == nil {
+		t.Error("AddSecurity() - V3 is accepted")
+	}
+	if err = agent.Serve(nil, nil); err == nil {
+		t.Error("Serve() - nil handler is accepted")
+	}
+	if err = agent.ServeRequests(nil); err == nil {
+		t.Error("ServeRequests() - nil handler is accepted")
+	}
+	if _, err = snmpgo.NewAgentWithConn(nil, snmpgo.ServerArguments{}); err == nil {
+		t.Error("NewAgentWithConn() - nil conn is accepted")
+	}
+}
@@ -1,13 +1,15 @@
 package snmpgo
 
 import (
+	"context"
 	"encoding/asn1"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,10 +18,17 @@ type SNMPArguments struct {
 	Version          SNMPVersion   // SNMP version to use
 	Network          string        // See net.Dial parameter (The default is `udp`)
 	Address          string        // See net.Dial parameter
+	BindToDevice     string        // Network interface to send from, e.g. `eth0` (Linux specific, SO_BINDTODEVICE)
 	Timeout          time.Duration // Request timeout (The default is 5sec)
-	Retries          uint          // Number of retries (The default is `0`)
+	PingTimeout      time.Duration // Request timeout of Ping (The default is 1sec)
+	Retries          uint          // Number of retries after the first attempt, i.e. Retries+1 attempts in total (The default is `0`, at most `10`)
 	MessageMaxSize   int           // Maximum size of an SNMP message (The default is `1400`)
+	MaxVarBinds      int           // Maximum number of VarBinds in a received message (The default is `10000`)
+	ReadBufferSize   int           // Size of the socket receive buffer (The default is the OS default)
+	WriteBufferSize  int           // Size of the socket send buffer (The default is the OS default)
 	Community        string        // Community (V1 or V2c specific)
+	Communities      []string      // Fallback communities, tried in order after Community (V1 or V2c specific)
+	WriteCommunity   string        // Community of SetRequest (The default is Community, V1 or V2c specific)
 	UserName         string        // Security name (V3 specific)
 	SecurityLevel    SecurityLevel // Security level (V3 specific)
 	AuthPassword     string        // Authentication protocol pass phrase (V3 specific)
@@ -27,8 +36,34 @@ type SNMPArguments struct {
 	PrivPassword     string        // Privacy protocol pass phrase (V3 specific)
 	PrivProtocol     PrivProtocol  // Privacy protocol (V3 specific)
 	SecurityEngineId string        // Security engine ID (V3 specific)
+	SkipDiscovery    bool          // Use the preloaded engine parameters instead of discovery (V3 specific)
+	DiscoveryOid     string        // OID requested by the discovery (The default is none, V3 specific)
+	EngineBoots      int           // Preloaded boots of the security engine (V3 specific)
+	EngineTime       int           // Preloaded time of the security engine (V3 specific)
 	ContextEngineId  string        // Context engine ID (V3 specific)
 	ContextName      string        // Context name (V3 specific)
+	SplitOnTooBig    bool          // Split the OIDs of GetRequest in half and retry on the tooBig error
+	ReconnectOnError bool          // Reopen the connection broken during a walk once, and continue the walk
+
+	// Return a MessageError with the walked VarBinds if the OIDs of a walked subtree do not increase
+	// (The default ends the subtree silently, a broken agent may return the same rows again)
+	ReportWalkLoops bool
+
+	// Cap the maxRepetitions of GetBulkRequest to MaxRepetitionsFor the MessageMaxSize,
+	// otherwise a warning is logged once when it exceeds
+	CapMaxRepetitions bool
+
+	// Generator of the request ids (The default is random)
+	RequestIdGenerator func() int `json:"-"`
+	// Generator of the salts for the privacy protocol, only the lower 32 bits are used
+	// with the DES (The default is random)
+	SaltGenerator func() int64 `json:"-"`
+	// Hook called with the bytes of each outbound and inbound message (e.g. for debugging)
+	OnWire func(dir Direction, b []byte) `json:"-"`
+	// Hook called once per request after all attempts (e.g. for metrics)
+	OnRequestComplete func(stats RequestStats) `json:"-"`
+	// Logger which will be used for logging of warnings (The default is no logging)
+	Logger StdLogger `json:"-"`
 
 	authEngineBoots int
 	authEngineTime  int
@@ -41,9 +76,18 @@ func (a *SNMPArguments) setDefault() {
 	if a.Timeout <= 0 {
 		a.Timeout = timeoutDefault
 	}
+	if a.PingTimeout <= 0 {
+		a.PingTimeout = pingTimeoutDefault
+	}
 	if a.MessageMaxSize == 0 {
 		a.MessageMaxSize = msgSizeDefault
 	}
+	if a.MaxVarBinds == 0 {
+		a.MaxVarBinds = maxVarBindsDefault
+	}
+	if a.Community == "" && len(a.Communities) > 0 {
+		a.Community = a.Communities[0]
+	}
 }
 
 func (a *SNMPArguments) validate() error {
@@ -61,44 +105,72 @@ func (a *SNMPArguments) validate() error {
 				msgSizeMinimum, math.MaxInt32),
 		}
 	}
-	if a.Version == V3 {
-		// RFC3414 Section 5
-		if l := len(a.UserName); l < 1 || l > 32 {
+	if a.Retries > retriesMaximum {
+		return &ArgumentError{
+			Value:   a.Retries,
+			Message: fmt.Sprintf("Retries is range 0..%d", retriesMaximum),
+		}
+	}
+	if a.MaxVarBinds < 0 {
+		return &ArgumentError{
+			Value:   a.MaxVarBinds,
+			Message: "MaxVarBinds must be a non-negative integer",
+		}
+	}
+	if a.BindToDevice != "" {
+		if !bindToDeviceSupported {
 			return &ArgumentError{
-				Value:   a.UserName,
-				Message: "UserName length is range 1..32",
+				Value:   a.BindToDevice,
+				Message: "BindToDevice is not supported on this platform",
 			}
 		}
-		if a.SecurityLevel > NoAuthNoPriv {
-			// RFC3414 Section 11.2
-			if len(a.AuthPassword) < 8 {
-				return &ArgumentError{
-					Value:   a.AuthPassword,
-					Message: "AuthPassword is at least 8 characters in length",
-				}
+		// IFNAMSIZ including the terminating null byte
+		if len(a.BindToDevice) > 15 {
+			return &ArgumentError{
+				Value:   a.BindToDevice,
+				Message: "BindToDevice is too long, the length must be 15 or less",
 			}
-			if p := a.AuthProtocol; p != Md5 && p != Sha {
-				return &ArgumentError{
-					Value:   a.AuthProtocol,
-					Message: "Illegal AuthProtocol",
-				}
+		}
+	}
+	if a.ReadBufferSize < 0 {
+		return &ArgumentError{
+			Value:   a.ReadBufferSize,
+			Message: "ReadBufferSize must be a non-negative integer",
+		}
+	}
+	if a.WriteBufferSize < 0 {
+		return &ArgumentError{
+			Value:   a.WriteBufferSize,
+			Message: "WriteBufferSize must be a non-negative integer",
+		}
+	}
+	if a.Version == V1 || a.Version == V2c {
+		if a.Community != "" || len(a.Communities) == 0 {
+			if err := validateCommunity(a.Community); err != nil {
+				return err
 			}
 		}
-		if a.SecurityLevel > AuthNoPriv {
-			// RFC3414 Section 11.2
-			if len(a.PrivPassword) < 8 {
-				return &ArgumentError{
-					Value:   a.PrivPassword,
-					Message: "PrivPassword is at least 8 characters in length",
-				}
+		for _, c := range a.Communities {
+			if err := validateCommunity(c); err != nil {
+				return err
 			}
-			if p := a.PrivProtocol; p != Des && p != Aes {
-				return &ArgumentError{
-					Value:   a.PrivProtocol,
-					Message: "Illegal PrivProtocol",
-				}
+		}
+		if a.WriteCommunity != "" {
+			if err := validateCommunity(a.WriteCommunity); err != nil {
+				return err
 			}
 		}
+	}
+	if a.Version == V3 {
+		err := validateUsm(a.UserName, a.SecurityLevel,
+			a.AuthPassword, a.AuthProtocol, a.PrivPassword, a.PrivProtocol)
+		if err != nil {
+			return err
+		}
+		if names := ignoredUsmCredentials(a.SecurityLevel,
+			a.AuthPassword, a.AuthProtocol, a.PrivPassword, a.PrivProtocol); len(names) > 0 {
+			a.logf("snmpgo: SecurityLevel %s ignores %s", a.SecurityLevel, strings.Join(names, ", "))
+		}
 		if a.SecurityEngineId != "" {
 			a.SecurityEngineId = stripHexPrefix(a.SecurityEngineId)
 			_, err := engineIdToBytes(a.SecurityEngineId)
@@ -106,6 +178,26 @@ func (a *SNMPArguments) validate() error {
 				return err
 			}
 		}
+		if a.SkipDiscovery {
+			if a.SecurityEngineId == "" {
+				return &ArgumentError{
+					Value:   a.SecurityEngineId,
+					Message: "SecurityEngineId is required when SkipDiscovery is set",
+				}
+			}
+			if b := a.EngineBoots; b < 0 || b > math.MaxInt32 {
+				return &ArgumentError{
+					Value:   b,
+					Message: fmt.Sprintf("EngineBoots is range %d..%d", 0, math.MaxInt32),
+				}
+			}
+			if t := a.EngineTime; t < 0 || t > math.MaxInt32 {
+				return &ArgumentError{
+					Value:   t,
+					Message: fmt.Sprintf("EngineTime is range %d..%d", 0, math.MaxInt32),
+				}
+			}
+		}
 		if a.ContextEngineId != "" {
 			a.ContextEngineId = stripHexPrefix(a.ContextEngineId)
 			_, err := engineIdToBytes(a.ContextEngineId)
@@ -113,58 +205,350 @@ func (a *SNMPArguments) validate() error {
 				return err
 			}
 		}
+		if a.DiscoveryOid != "" {
+			if _, err := NewOid(a.DiscoveryOid); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+func (a *SNMPArguments) logf(format string, args ...interface{}) {
+	if l := a.Logger; l != nil {
+		l.Printf(format, args...)
+	}
+}
+
+
+func (a *SNMPArguments) requestId() int {
+	if a.RequestIdGenerator != nil {
+		return a.RequestIdGenerator()
+	}
+	return genRequestId()
+}
+
+func (a *SNMPArguments) onWire(dir Direction, b []byte) {
+	if a.OnWire != nil {
+		a.OnWire(dir, b)
+	}
+}
+
+// Clone returns a deep copy of the arguments without the engine parameters
+// cached by a session, the hooks and the Logger are shared with the copy
+func (a SNMPArguments) Clone() SNMPArguments {
+	if a.Communities != nil {
+		a.Communities = append([]string(nil), a.Communities...)
+	}
+	a.authEngineBoots = 0
+	a.authEngineTime = 0
+	return a
+}
+
 func (a *SNMPArguments) String() string {
 	return escape(a)
 }
 
+// Statistics of a request, which are passed to the OnRequestComplete hook
+type RequestStats struct {
+	PduType       PduType       // Type of the request PDU
+	Duration      time.Duration // Elapsed time of all attempts
+	Attempts      int           // Number of attempts including retries
+	Timeouts      int           // Number of attempts that timed out
+	BytesSent     int           // Total bytes of the sent messages
+	BytesReceived int           // Total bytes of the received messages
+	Error         error         // Error of the request, nil if succeeded
+
+	responseSize int // bytes of the message of the response
+}
+
 // SNMP Object provides functions for the SNMP Client
 type SNMP struct {
-	conn   net.Conn
-	args   *SNMPArguments
-	engine *snmpEngine
+	conn      net.Conn
+	args      *SNMPArguments
+	engine    *snmpEngine
+	startTime time.Time
+	userConn  net.Conn // supplied by NewSNMPWithConn instead of dialing
+
+	warnedRepetitions bool
+	lastAttempts      int
+	lastPduType       PduType
+
+	communityLock sync.Mutex
+	community     string // the answered one of the Communities, which is tried first
 }
 
 // Open a connection
 func (s *SNMP) Open() (err error) {
+	return s.OpenContext(context.Background())
+}
+
+// OpenContext opens a connection like Open, but the connection setup
+// (including the name resolution of the Address and the discovery of V3)
+// is aborted with ctx.Err() when the ctx is canceled or expires
+func (s *SNMP) OpenContext(ctx context.Context) (err error) {
 	if s.conn != nil {
 		return
 	}
 
-	err = retry(int(s.args.Retries), func() error {
-		conn, e := net.DialTimeout(s.args.Network, s.args.Address, s.args.Timeout)
-		if e == nil {
+	if s.userConn != nil {
+		s.conn, s.userConn = s.userConn, nil
+	} else {
+		dialer := net.Dialer{Timeout: s.args.Timeout}
+		if s.args.BindToDevice != "" {
+			dialer.Control = bindToDeviceControl(s.args.BindToDevice)
+		}
+		err = retry(int(s.args.Retries), func() error {
+			conn, e := dialer.DialContext(ctx, s.args.Network, s.args.Address)
+			if e != nil {
+				if ctx.Err() != nil {
+					// not a net.Error, so that it is not retried
+					return ctx.Err()
+				}
+				return e
+			}
 			s.conn = conn
+			return nil
+		})
+		if err != nil {
+			return
 		}
-		return e
-	})
-	if err != nil {
+	}
+	if err = s.setBufferSizes(); err != nil {
+		s.Close()
 		return
 	}
 
 	s.engine = newSNMPEngine(s.args)
-	if err = s.engine.Discover(s); err != nil {
+	if err = s.engine.Discover(ctx, s); err != nil {
 		s.Close()
 	}
 	return
 }
 
-// Close a connection
-func (s *SNMP) Close() {
-	fmt.Println("Close")
-	if s.conn != nil {
-		s.conn.Close()
-		s.conn = nil
-		s.engine = nil
+func (s *SNMP) setBufferSizes() error {
+	type bufferSetter interface {
+		SetReadBuffer(bytes int) error
+		SetWriteBuffer(bytes int) error
+	}
+	conn, ok := s.conn.(bufferSetter)
+	if !ok {
+		return nil
+	}
+	if n := s.args.ReadBufferSize; n > 0 {
+		if err := conn.SetReadBuffer(n); err != nil {
+			return err
+		}
+	}
+	if n := s.args.WriteBufferSize; n > 0 {
+		if err := conn.SetWriteBuffer(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BufferSizes returns the effective sizes of the socket receive and send buffers.
+// The values reported by the OS may differ from the requested sizes
+// (e.g. Linux doubles them and caps them at the system limits)
+func (s *SNMP) BufferSizes() (read, write int, err error) {
+	if s.conn == nil {
+		return 0, 0, &MessageError{Message: "Connection is not opened"}
+	}
+	return socketBufferSizes(s.conn)
+}
+
+// SecurityEngineId returns the ID of the authoritative engine used by the SNMP V3 session,
+// which is discovered from the agent or given by the SecurityEngineId.
+// Returns an empty string with the other versions or before the connection is opened.
+func (s *SNMP) SecurityEngineId() string {
+	if s.engine == nil {
+		return ""
 	}
+	if u, ok := s.engine.sec.(*usm); ok {
+		return toHexStr(u.AuthEngineId, "")
+	}
+	return ""
+}
+
+// Authoritative returns true if the local side acted as the authoritative engine
+// for the last sent message, that is a SNMPv2-Trap or a Report (RFC3414 Section 1.5.1).
+// Returns false for the requests and the InformRequest, or except with SNMP V3.
+func (s *SNMP) Authoritative() bool {
+	return s.args.Version == V3 && authoritativeType(s.lastPduType)
+}
+
+// LastAttempts returns the number of attempts including retries of the last request,
+// which is same as the Attempts of the RequestStats (more than 1 means the request was retried)
+func (s *SNMP) LastAttempts() int {
+	return s.lastAttempts
+}
+
+// Close a connection, and returns the error of closing it.
+// It is safe to call more than once, and returns nil if the connection is not opened.
+func (s *SNMP) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	s.engine = nil
+	return err
 }
 
 func (s *SNMP) GetRequest(oids Oids) (result Pdu, err error) {
+	return s.getRequest(oids, "")
+}
+
+func (s *SNMP) getRequest(oids Oids, contextName string) (result Pdu, err error) {
 	pdu := NewPduWithOids(s.args.Version, GetRequest, oids)
-	return s.sendPdu(pdu)
+	setContextName(pdu, contextName)
+	result, err = s.sendPdu(pdu)
+	if err == nil && s.args.SplitOnTooBig && result.ErrorStatus() == TooBig && len(oids) > 1 {
+		return s.splitGetRequest(oids, contextName)
+	}
+	return
+}
+
+// GetRequestTimed is like GetRequest, but also returns the elapsed time
+// from the first send of the request to the receipt of the response (including the retries),
+// which excludes opening the connection. The SplitOnTooBig is not applied.
+func (s *SNMP) GetRequestTimed(oids Oids) (result Pdu, elapsed time.Duration, err error) {
+	pdu := NewPduWithOids(s.args.Version, GetRequest, oids)
+	var stats RequestStats
+	result, _, stats, err = s.sendPduWithStats(pdu)
+	return result, stats.Duration, err
+}
+
+// splitGetRequest sends the halves of the oids by GetRequest, and merges the responses.
+// If the ErrorStatus of a response is not the NoError, the response is returned
+// with the ErrorIndex in the whole oids.
+func (s *SNMP) splitGetRequest(oids Oids, contextName string) (result Pdu, err error) {
+	half := len(oids) / 2
+	var varBinds VarBinds
+	for i, part := range []Oids{oids[:half], oids[half:]} {
+		result, err = s.getRequest(part, contextName)
+		if err != nil {
+			return nil, err
+		}
+		if result.ErrorStatus() != NoError {
+			if i > 0 && result.ErrorIndex() > 0 {
+				result.SetErrorIndex(result.ErrorIndex() + half)
+			}
+			return result, nil
+		}
+		varBinds = append(varBinds, result.VarBinds()...)
+	}
+
+	pdu := NewPduWithVarBinds(s.args.Version, GetResponse, varBinds)
+	pdu.SetRequestId(result.RequestId())
+	return pdu, nil
+}
+
+// GetRequestWithContextName is like GetRequest, but the ContextName of the arguments
+// is overridden by the contextName for this request (V3 specific)
+func (s *SNMP) GetRequestWithContextName(oids Oids, contextName string) (result Pdu, err error) {
+	return s.getRequest(oids, contextName)
+}
+
+// setContextName sets the contextName to the ScopedPdu, which takes precedence over
+// the ContextName of the arguments, an empty contextName leaves it to the arguments
+func setContextName(pdu Pdu, contextName string) {
+	if p, ok := pdu.(*ScopedPdu); ok && contextName != "" {
+		p.ContextName = []byte(contextName)
+	}
+}
+
+// Ping sends a GetRequest of the sysUpTime.0 with the PingTimeout instead of the Timeout,
+// and returns nil if the agent responds.
+// If the agent does not respond or the request fails (e.g. the authentication failure),
+// an UnreachableError is returned.
+func (s *SNMP) Ping() error {
+	opts := s.sendOptions()
+	opts.timeout = s.args.PingTimeout
+
+	pdu := NewPduWithOids(s.args.Version, GetRequest, Oids{OidSysUpTime})
+	if _, err := s.sendPduContext(context.Background(), pdu, opts); err != nil {
+		if e, ok := err.(*UnreachableError); ok {
+			return e
+		}
+		return &UnreachableError{
+			Address: s.args.Address,
+			Cause:   err,
+		}
+	}
+	return nil
+}
+
+// GetRequestFrom is like GetRequest, but also returns the source address of the response,
+// which may differ from the Address with UDP (e.g. the agent replied to a broadcast address).
+// The first response is returned, even if more agents reply.
+func (s *SNMP) GetRequestFrom(oids Oids) (result Pdu, src net.Addr, err error) {
+	pdu := NewPduWithOids(s.args.Version, GetRequest, oids)
+	return s.sendPduFrom(pdu)
+}
+
+// GetString sends a GetRequest of the oid, and returns the value of the OctetString.
+// A MessageError is returned if the ErrorStatus is not the NoError,
+// the value is an exception (e.g. noSuchInstance) or not an OctetString.
+func (s *SNMP) GetString(oid *Oid) (string, error) {
+	v, err := s.getScalar(oid)
+	if err != nil {
+		return "", err
+	}
+	o, ok := v.(*OctetString)
+	if !ok {
+		return "", &MessageError{
+			Message: fmt.Sprintf("Value of %s is not an OctetString - %s", oid, v.Type()),
+		}
+	}
+	return string(o.Value), nil
+}
+
+// GetInt sends a GetRequest of the oid, and returns the value of the integer type
+// (e.g. Integer, Counter32 or Gauge32).
+// A MessageError is returned if the ErrorStatus is not the NoError,
+// the value is an exception (e.g. noSuchInstance) or not an integer within int64.
+func (s *SNMP) GetInt(oid *Oid) (int64, error) {
+	v, err := s.getScalar(oid)
+	if err != nil {
+		return 0, err
+	}
+	i, err := v.BigInt()
+	if err != nil || !i.IsInt64() {
+		return 0, &MessageError{
+			Message: fmt.Sprintf("Value of %s is not an integer within int64 - %s", oid, v.Type()),
+		}
+	}
+	return i.Int64(), nil
+}
+
+// getScalar returns the value of the oid, which is not an exception
+func (s *SNMP) getScalar(oid *Oid) (Variable, error) {
+	pdu, err := s.GetRequest(Oids{oid})
+	if err != nil {
+		return nil, err
+	}
+	if status := pdu.ErrorStatus(); status != NoError {
+		return nil, &MessageError{
+			Message: fmt.Sprintf("Failed to get %s, error status `%s`", oid, status),
+			Detail:  pdu.String(),
+		}
+	}
+	vb := pdu.VarBinds().MatchOid(oid)
+	if vb == nil {
+		return nil, &MessageError{
+			Message: fmt.Sprintf("Response does not contain %s", oid),
+			Detail:  pdu.String(),
+		}
+	}
+	if IsException(vb.Variable) {
+		return nil, &MessageError{
+			Message: fmt.Sprintf("Failed to get %s - %s", oid, vb.Variable.Type()),
+			Detail:  pdu.String(),
+		}
+	}
+	return vb.Variable, nil
 }
 
 func (s *SNMP) GetNextRequest(oids Oids) (result Pdu, err error) {
@@ -172,47 +556,599 @@ func (s *SNMP) GetNextRequest(oids Oids) (result Pdu, err error) {
 	return s.sendPdu(pdu)
 }
 
+// SetRequest sets the values of the VarBinds on the agent.
+// With SNMP V1 or V2c, the request uses the WriteCommunity if it is given.
+func (s *SNMP) SetRequest(varBinds VarBinds) (result Pdu, err error) {
+	pdu := NewPduWithVarBinds(s.args.Version, SetRequest, varBinds)
+	return s.sendPdu(pdu)
+}
+
 func (s *SNMP) GetBulkRequest(oids Oids, nonRepeaters, maxRepetitions int) (result Pdu, err error) {
+	_, result, _, err = s.getBulkRequest(oids, nonRepeaters, maxRepetitions, "")
+	return
+}
+
+// GetBulkRequestTruncated is like GetBulkRequest, but also returns whether the response
+// was probably truncated by the MessageMaxSize, that is, the response has fewer VarBinds
+// than requested and no room for another VarBind as large as the largest one.
+// If so, the rest can be requested with smaller maxRepetitions.
+func (s *SNMP) GetBulkRequestTruncated(oids Oids, nonRepeaters, maxRepetitions int) (
+	result Pdu, truncated bool, err error) {
+
+	pdu, result, stats, err := s.getBulkRequest(oids, nonRepeaters, maxRepetitions, "")
+	if err != nil {
+		return nil, false, err
+	}
+	return result, s.responseTruncated(pdu, result, stats.responseSize), nil
+}
+
+func (s *SNMP) getBulkRequest(oids Oids, nonRepeaters, maxRepetitions int, contextName string) (
+	pdu, result Pdu, stats RequestStats, err error) {
 
 	if s.args.Version < V2c {
-		return nil, &ArgumentError{
+		return nil, nil, stats, &ArgumentError{
 			Value:   s.args.Version,
 			Message: "Unsupported SNMP Version",
 		}
 	}
 	// RFC 3416 Section 3
 	if nonRepeaters < 0 || nonRepeaters > math.MaxInt32 {
-		return nil, &ArgumentError{
+		return nil, nil, stats, &ArgumentError{
 			Value:   nonRepeaters,
 			Message: fmt.Sprintf("NonRepeaters is range %d..%d", 0, math.MaxInt32),
 		}
 	}
 	if maxRepetitions < 0 || maxRepetitions > math.MaxInt32 {
-		return nil, &ArgumentError{
+		return nil, nil, stats, &ArgumentError{
 			Value:   maxRepetitions,
 			Message: fmt.Sprintf("NonRepeaters is range %d..%d", 0, math.MaxInt32),
 		}
 	}
 
-	pdu := NewPduWithOids(s.args.Version, GetBulkRequest, oids)
+	if limit := MaxRepetitionsFor(s.args.MessageMaxSize, oids, nonRepeaters); maxRepetitions > limit {
+		if s.args.CapMaxRepetitions {
+			maxRepetitions = limit
+		} else if !s.warnedRepetitions {
+			s.warnedRepetitions = true
+			s.args.logf("snmpgo: maxRepetitions %d exceeds %d, "+
+				"the response of %d OIDs will be truncated by MessageMaxSize(%d)",
+				maxRepetitions, limit, len(oids), s.args.MessageMaxSize)
+		}
+	}
+
+	pdu = NewPduWithOids(s.args.Version, GetBulkRequest, oids)
 	pdu.SetNonrepeaters(nonRepeaters)
 	pdu.SetMaxRepetitions(maxRepetitions)
-	return s.sendPdu(pdu)
+	setContextName(pdu, contextName)
+	result, _, stats, err = s.sendPduWithStats(pdu)
+	return
+}
+
+// responseTruncated returns true if the response of the GetBulkRequest has fewer VarBinds
+// than requested, and the size of the response leaves no room for the largest VarBind
+func (s *SNMP) responseTruncated(req, res Pdu, size int) bool {
+	if res.ErrorStatus() != NoError {
+		return false
+	}
+	// the non-repeaters and max-repetitions are in the error status and index
+	oids := len(req.VarBinds())
+	nonRepeaters, maxRepetitions := int(req.ErrorStatus()), req.ErrorIndex()
+	if nonRepeaters > oids {
+		nonRepeaters = oids
+	}
+	varBinds := res.VarBinds()
+	if len(varBinds) >= nonRepeaters+maxRepetitions*(oids-nonRepeaters) {
+		return false
+	}
+
+	largest := 0
+	for _, val := range varBinds {
+		if b, err := val.Marshal(); err == nil && len(b) > largest {
+			largest = len(b)
+		}
+	}
+	return size+largest > s.args.MessageMaxSize
+}
+
+// MaxRepetitionsFor returns the upper bound of the maxRepetitions of a GetBulkRequest
+// whose response can fit in the maxSize.
+// Each repetition has the VarBinds of the repeaters (the oids after the nonRepeaters),
+// so that the response of a larger maxRepetitions is always truncated by the agent.
+// The bound is estimated with the smallest VarBinds, which are the successors of the oids
+// with an empty value, the actual fitting one depends on the values. The bound is at least 1.
+func MaxRepetitionsFor(maxSize int, oids Oids, nonRepeaters int) int {
+	if nonRepeaters < 0 {
+		nonRepeaters = 0
+	}
+	varBindSize := func(oid *Oid) int {
+		b, _ := oid.Marshal()
+		// sequence header + successor oid (at least one more sub-identifier) + empty value
+		return 2 + len(b) + 1 + 2
+	}
+
+	rest := maxSize - bulkOverheadSize
+	repSize := 0
+	for i, oid := range oids {
+		if i < nonRepeaters {
+			rest -= varBindSize(oid)
+		} else {
+			repSize += varBindSize(oid)
+		}
+	}
+	if repSize == 0 {
+		return math.MaxInt32
+	}
+	if rest < repSize {
+		return 1
+	}
+	return rest / repSize
+}
+
+// GetScalarsAndColumns sends a GetBulkRequest with the scalars as non-repeaters
+// and the columns as repeaters.
+// The first len(scalars) VarBinds of the returned PDU are the successors of the scalars,
+// and the rest are the rows of the columns in row-major order.
+func (s *SNMP) GetScalarsAndColumns(scalars, columns Oids, maxRepetitions int) (result Pdu, err error) {
+	oids := make(Oids, 0, len(scalars)+len(columns))
+	oids = append(oids, scalars...)
+	oids = append(oids, columns...)
+	return s.GetBulkRequest(oids, len(scalars), maxRepetitions)
 }
 
 // This method inquire about OID subtrees by repeatedly using GetBulkRequest.
 // Returned PDU contains the varbind list of all subtrees.
 // however, if the ErrorStatus of PDU is not the NoError, return only the last query result.
 func (s *SNMP) GetBulkWalk(oids Oids, nonRepeaters, maxRepetitions int) (result Pdu, err error) {
+	result, _, err = s.getBulkWalk(oids, nonRepeaters, maxRepetitions, &WalkOptions{})
+	return
+}
+
+// BulkWalk is like GetBulkWalk, but returns the VarBinds of all subtrees
+// instead of a PDU, which is not a response of the agent.
+// If the ErrorStatus of a response is not the NoError, a MessageError is returned.
+func (s *SNMP) BulkWalk(oids Oids, nonRepeaters, maxRepetitions int) (VarBinds, error) {
+	result, _, err := s.getBulkWalk(oids, nonRepeaters, maxRepetitions, &WalkOptions{})
+	if err != nil {
+		if result != nil {
+			return result.VarBinds(), err
+		}
+		return nil, err
+	}
+	if status := result.ErrorStatus(); status != NoError {
+		return nil, &MessageError{
+			Message: fmt.Sprintf("Failed to walk, error status `%s`", status),
+			Detail:  result.String(),
+		}
+	}
+	return result.VarBinds(), nil
+}
+
+// Options for the walk methods
+type WalkOptions struct {
+	MaxRows       int    // Maximum number of VarBinds to collect (The default is unlimited)
+	ContextName   string // Context name overriding the arguments (V3 specific)
+	PreserveOrder bool   // Keep the subtrees in the order of the oids instead of sorting by OID
+
+	// Time after which no more GetBulkRequest is sent, the walk returns the VarBinds collected
+	// so far (The default is no deadline, the per-request Timeout still applies to each round)
+	Deadline time.Time
+
+	// Hints of maxRepetitions for each subtree following the non-repeaters (0 is the maxRepetitions),
+	// the subtrees with the different hints are walked by the separate requests
+	Repetitions []int
+
+	// Predicate evaluated for each VarBind of the subtrees as the responses arrive,
+	// the walk is stopped after the VarBind when it returns true
+	Stop func(vb *VarBind) bool `json:"-"`
+
+	// Callback invoked after each GetBulkRequest round with the number of VarBinds collected so far
+	OnProgress func(rows int) `json:"-"`
+}
+
+// GetBulkWalkWithOptions is like GetBulkWalk, but the walk is controlled by the options.
+// If the walk is stopped by the MaxRows limit before reaching the end of subtrees,
+// the returned PDU contains at most MaxRows VarBinds and truncated is true,
+// and likewise when the walk is stopped by the Stop or the Deadline.
+func (s *SNMP) GetBulkWalkWithOptions(oids Oids, nonRepeaters, maxRepetitions int,
+	opts WalkOptions) (result Pdu, truncated bool, err error) {
+
+	if opts.MaxRows < 0 {
+		return nil, false, &ArgumentError{
+			Value:   opts.MaxRows,
+			Message: "MaxRows must be a non-negative value",
+		}
+	}
+	if len(opts.Repetitions) > 0 {
+		if nonRepeaters < 0 || len(opts.Repetitions) != len(oids)-nonRepeaters {
+			return nil, false, &ArgumentError{
+				Value:   opts.Repetitions,
+				Message: "Repetitions must have the same length as Oids following the non-repeaters",
+			}
+		}
+		for _, r := range opts.Repetitions {
+			if r < 0 {
+				return nil, false, &ArgumentError{
+					Value:   opts.Repetitions,
+					Message: "Repetitions must be non-negative values",
+				}
+			}
+		}
+	}
+	return s.getBulkWalk(oids, nonRepeaters, maxRepetitions, &opts)
+}
+
+// WalkFunc inquires about OID subtrees by repeatedly using GetBulkRequest,
+// and calls fn for each VarBind as the responses arrive, without buffering the results.
+// If fn returns an error, the walk is stopped and the error is returned.
+// If the ErrorStatus of a response is not the NoError, a MessageError is returned.
+func (s *SNMP) WalkFunc(oids Oids, maxRepetitions int, fn func(vb *VarBind) error) error {
+	errPdu, err := s.bulkWalk(oids, 0, maxRepetitions, "",
+		func(_, varBinds VarBinds, _ bool) error {
+			for _, val := range varBinds {
+				if err := fn(val); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	if e := loopError(err); e != nil {
+		err = e
+	}
+	if err == nil && errPdu != nil {
+		err = &MessageError{
+			Message: fmt.Sprintf("Failed to walk, error status `%s`", errPdu.ErrorStatus()),
+			Detail:  errPdu.String(),
+		}
+	}
+	return err
+}
+
+// WalkWithin inquires about the subtree of the base by repeatedly using GetNextRequest,
+// which works also with SNMP V1. The walk stops at the first OID out of the subtree,
+// which is not included in the result.
+// If the ErrorStatus of a response is not the NoError (except the end of the MIB view
+// with SNMP V1), a MessageError is returned.
+func (s *SNMP) WalkWithin(base *Oid) (VarBinds, error) {
+	if base == nil {
+		return nil, &ArgumentError{
+			Value:   base,
+			Message: "Base Oid is required",
+		}
+	}
+
+	var result VarBinds
+	var reopened bool
+	for oid := base; ; {
+		pdu, err := s.GetNextRequest(Oids{oid})
+		if err != nil {
+			if s.reopenOnError(err, &reopened) {
+				continue
+			}
+			return nil, err
+		}
+		if status := pdu.ErrorStatus(); status != NoError {
+			if status == NoSuchName && s.args.Version == V1 {
+				break
+			}
+			return nil, &MessageError{
+				Message: fmt.Sprintf("Failed to walk, error status `%s`", status),
+				Detail:  pdu.String(),
+			}
+		}
+
+		varBinds := pdu.VarBinds()
+		if len(varBinds) == 0 {
+			break
+		}
+		val := varBinds[0]
+		if IsException(val.Variable) || val.Oid == nil || !val.Oid.Contains(base) {
+			break
+		}
+		if val.Oid.Compare(oid) <= 0 {
+			if s.args.ReportWalkLoops {
+				return result, notIncreasingError(base, oid, val.Oid, pdu)
+			}
+			break
+		}
+		result = append(result, val)
+		oid = val.Oid
+	}
+	return result, nil
+}
+
+// GetBulkWalkFrom is like GetBulkWalk without the non-repeaters, but inquires each subtree
+// of the oids after the cursor, which is the last OID seen by the previous walk
+// (a nil cursor inquires the subtree from the beginning).
+// The returned next holds the cursors for the next walk, it keeps the given cursor
+// if no new rows are found in the subtree.
+// This is useful for the append-mostly tables (e.g. logs, events), but note that
+// the rows inserted before the cursor and the changed rows are not returned.
+func (s *SNMP) GetBulkWalkFrom(oids, cursors Oids, maxRepetitions int) (
+	result Pdu, next Oids, err error) {
+
+	if len(cursors) != len(oids) {
+		return nil, nil, &ArgumentError{
+			Value:   cursors,
+			Message: "Cursors must have the same length as Oids",
+		}
+	}
+	if len(oids.Sort().UniqBase()) != len(oids) {
+		return nil, nil, &ArgumentError{
+			Value:   oids,
+			Message: "Oids must not overlap each other",
+		}
+	}
+	for i, cursor := range cursors {
+		if cursor != nil && !cursor.Contains(oids[i]) {
+			return nil, nil, &ArgumentError{
+				Value:   cursor,
+				Message: fmt.Sprintf("Cursor is out of the subtree of %s", oids[i]),
+			}
+		}
+	}
+
+	var resBinds VarBinds
+	errPdu, err := s.bulkWalkFrom(oids, cursors, 0, maxRepetitions, "",
+		func(_, varBinds VarBinds, _ bool) error {
+			resBinds = append(resBinds, varBinds...)
+			return nil
+		})
+	loopErr := loopError(err)
+	if err != nil && loopErr == nil {
+		return nil, nil, err
+	}
+	if errPdu != nil {
+		return errPdu, cursors, nil
+	}
+
+	resBinds = resBinds.Sort().Uniq()
+	next = make(Oids, len(oids))
+	copy(next, cursors)
+	for i, oid := range oids {
+		if matched := resBinds.MatchBaseOids(oid); len(matched) > 0 {
+			next[i] = matched[len(matched)-1].Oid
+		}
+	}
+	return NewPduWithVarBinds(s.args.Version, GetResponse, resBinds), next, loopErr
+}
+
+// Table inquires about the columns of the conceptual table under the entryOid
+// by repeatedly using GetBulkRequest, and returns a row for each index,
+// which maps the column number to the value.
+// The rows are in the order of the index, and the cells missing from a sparse row
+// are absent from the map.
+// If the ErrorStatus of a response is not the NoError, a MessageError is returned.
+func (s *SNMP) Table(entryOid *Oid, columns []uint32) ([]map[uint32]Variable, error) {
+	if entryOid == nil || len(columns) == 0 {
+		return nil, &ArgumentError{
+			Value:   columns,
+			Message: "EntryOid and Columns are required",
+		}
+	}
+
+	oids := make(Oids, 0, len(columns))
+	for _, c := range columns {
+		oid, err := entryOid.AppendSubIds([]int{int(c)})
+		if err != nil {
+			return nil, err
+		}
+		oids = append(oids, oid)
+	}
+
+	var resBinds VarBinds
+	errPdu, err := s.bulkWalk(oids, 0, maxRepetitionsDefault, "",
+		func(_, varBinds VarBinds, _ bool) error {
+			resBinds = append(resBinds, varBinds...)
+			return nil
+		})
+	loopErr := loopError(err)
+	if err != nil && loopErr == nil {
+		return nil, err
+	}
+	if errPdu != nil {
+		return nil, &MessageError{
+			Message: fmt.Sprintf("Failed to walk, error status `%s`", errPdu.ErrorStatus()),
+			Detail:  errPdu.String(),
+		}
+	}
+
+	// group the cells by the index, which is the sub-ids following the column number
+	l := len(entryOid.Value)
+	cells := make(map[string]map[uint32]Variable)
+	var indexes Oids
+	for _, val := range resBinds {
+		if len(val.Oid.Value) <= l+1 {
+			continue
+		}
+		index := &Oid{Value: val.Oid.Value[l+1:]}
+		key := index.Value.String()
+		row, ok := cells[key]
+		if !ok {
+			row = make(map[uint32]Variable)
+			cells[key] = row
+			indexes = append(indexes, index)
+		}
+		row[uint32(val.Oid.Value[l])] = val.Variable
+	}
+
+	rows := make([]map[uint32]Variable, 0, len(indexes))
+	for _, index := range indexes.Sort() {
+		rows = append(rows, cells[index.Value.String()])
+	}
+	return rows, loopErr
+}
+
+var errStopWalk = errors.New("Stop walk")
+
+// reopenOnError reopens the connection (and discovers the engine again) if ReconnectOnError
+// and the err is caused by the broken connection, which is done once per walk.
+// It returns true if the walk can continue from the last OIDs.
+func (s *SNMP) reopenOnError(err error, reopened *bool) bool {
+	if !s.args.ReconnectOnError || *reopened || !isConnectionError(err) {
+		return false
+	}
+	*reopened = true
+	s.Close()
+	return s.Open() == nil
+}
+
+func (s *SNMP) getBulkWalk(oids Oids, nonRepeaters, maxRepetitions int,
+	opts *WalkOptions) (result Pdu, truncated bool, err error) {
+
 	var nonRepBinds, resBinds VarBinds
 
-	oids = append(oids[:nonRepeaters], oids[nonRepeaters:].Sort().UniqBase()...)
+	collect := func(nonRep, varBinds VarBinds, last bool) error {
+		nonRepBinds = append(nonRepBinds, nonRep...)
+		if opts.Stop != nil {
+			for i, val := range varBinds {
+				if opts.Stop(val) {
+					resBinds = append(resBinds, varBinds[:i+1]...)
+					truncated = !last || i < len(varBinds)-1
+					return errStopWalk
+				}
+			}
+		}
+		resBinds = append(resBinds, varBinds...)
+		if opts.MaxRows > 0 && len(nonRepBinds)+len(resBinds) >= opts.MaxRows {
+			truncated = !last
+			return errStopWalk
+		}
+		if !opts.Deadline.IsZero() && !time.Now().Before(opts.Deadline) {
+			truncated = !last
+			return errStopWalk
+		}
+		return nil
+	}
+
+	var errPdu Pdu
+	var loopErr error
+	groups := repetitionGroups(oids, nonRepeaters, maxRepetitions, opts.Repetitions)
+	for i, group := range groups {
+		lastGroup := i == len(groups)-1
+		errPdu, err = s.bulkWalk(group.oids, group.nonRepeaters, group.maxRepetitions, opts.ContextName,
+			func(nonRep, varBinds VarBinds, last bool) error {
+				err := collect(nonRep, varBinds, last && lastGroup)
+				if opts.OnProgress != nil {
+					opts.OnProgress(len(nonRepBinds) + len(resBinds))
+				}
+				return err
+			})
+		if e := loopError(err); e != nil {
+			if loopErr == nil {
+				loopErr = e
+			}
+			err = nil
+		}
+		if err != nil || errPdu != nil {
+			break
+		}
+	}
+	if err != nil && err != errStopWalk {
+		return nil, false, err
+	}
+	if errPdu != nil {
+		return errPdu, false, nil
+	}
+
+	resBinds = resBinds.Sort().Uniq()
+	if opts.PreserveOrder {
+		resBinds = orderBySubtrees(resBinds, oids[nonRepeaters:])
+	}
+	resBinds = append(nonRepBinds, resBinds...)
+	if opts.MaxRows > 0 && len(resBinds) > opts.MaxRows {
+		resBinds = resBinds[:opts.MaxRows]
+		truncated = true
+	}
+	return NewPduWithVarBinds(s.args.Version, GetResponse, resBinds), truncated, loopErr
+}
+
+// repetitionGroup is the subtrees walked with the same maxRepetitions
+type repetitionGroup struct {
+	oids           Oids
+	nonRepeaters   int
+	maxRepetitions int
+}
+
+// repetitionGroups groups the subtrees by the hints of maxRepetitions in the order of appearance,
+// the non-repeaters are requested with the first group
+func repetitionGroups(oids Oids, nonRepeaters, maxRepetitions int, hints []int) []repetitionGroup {
+	if len(hints) == 0 {
+		return []repetitionGroup{{oids, nonRepeaters, maxRepetitions}}
+	}
+
+	var groups []repetitionGroup
+	index := make(map[int]int)
+	for i, oid := range oids[nonRepeaters:] {
+		r := hints[i]
+		if r == 0 {
+			r = maxRepetitions
+		}
+		j, ok := index[r]
+		if !ok {
+			j = len(groups)
+			index[r] = j
+			group := repetitionGroup{maxRepetitions: r}
+			if j == 0 {
+				group.oids = append(group.oids, oids[:nonRepeaters]...)
+				group.nonRepeaters = nonRepeaters
+			}
+			groups = append(groups, group)
+		}
+		groups[j].oids = append(groups[j].oids, oid)
+	}
+	return groups
+}
+
+// orderBySubtrees concatenates the sorted VarBinds of each subtree in the order of the oids,
+// a VarBind belongs to the first subtree containing it.
+func orderBySubtrees(varBinds VarBinds, oids Oids) VarBinds {
+	ordered := make(VarBinds, 0, len(varBinds))
+	seen := make(map[string]bool, len(varBinds))
+	for _, oid := range oids {
+		for _, val := range varBinds.MatchBaseOids(oid) {
+			if key := val.Oid.Value.String(); !seen[key] {
+				seen[key] = true
+				ordered = append(ordered, val)
+			}
+		}
+	}
+	return ordered
+}
+
+// bulkWalk walks the subtrees, and calls fn with the VarBinds of non-repeaters
+// and the newly found VarBinds of subtrees for each response.
+// The last is true if no more requests follow.
+// If the ErrorStatus of a response is not the NoError, the response is returned as errPdu.
+// A non-empty contextName overrides the ContextName of the arguments (V3 specific).
+func (s *SNMP) bulkWalk(oids Oids, nonRepeaters, maxRepetitions int, contextName string,
+	fn func(nonRepBinds, varBinds VarBinds, last bool) error) (errPdu Pdu, err error) {
+
+	oids = append(oids[:nonRepeaters:nonRepeaters], oids[nonRepeaters:].Sort().UniqBase()...)
+	return s.bulkWalkFrom(oids, nil, nonRepeaters, maxRepetitions, contextName, fn)
+}
+
+// bulkWalkFrom is like bulkWalk, but walks each subtree after the OID of the starts
+// (a nil start walks the subtree from the beginning), the oids are used as they are.
+func (s *SNMP) bulkWalkFrom(oids, starts Oids, nonRepeaters, maxRepetitions int, contextName string,
+	fn func(nonRepBinds, varBinds VarBinds, last bool) error) (errPdu Pdu, err error) {
+
+	// the last OIDs of each subtree, which are also used to detect that an agent loops
 	reqOids := make(Oids, len(oids))
 	copy(reqOids, oids)
+	for i, start := range starts {
+		if start != nil {
+			reqOids[i] = start
+		}
+	}
 
+	var reopened bool
+	var loopErr error
 	for len(reqOids) > 0 {
-		pdu, err := s.GetBulkRequest(reqOids, nonRepeaters, maxRepetitions)
+		_, pdu, _, err := s.getBulkRequest(reqOids, nonRepeaters, maxRepetitions, contextName)
 		if err != nil {
+			if s.reopenOnError(err, &reopened) {
+				continue
+			}
 			return nil, err
 		}
 		if s := pdu.ErrorStatus(); s != NoError &&
@@ -220,40 +1156,47 @@ func (s *SNMP) GetBulkWalk(oids Oids, nonRepeaters, maxRepetitions int) (result
 			return pdu, nil
 		}
 
+		var nonRepBinds, resBinds VarBinds
 		varBinds := pdu.VarBinds()
 
 		if nonRepeaters > 0 {
-			nonRepBinds = append(nonRepBinds, varBinds[:nonRepeaters]...)
+			nonRepBinds = varBinds[:nonRepeaters]
 			varBinds = varBinds[nonRepeaters:]
 			oids = oids[nonRepeaters:]
 			reqOids = reqOids[nonRepeaters:]
 			nonRepeaters = 0
 		}
 
-		filled := len(varBinds) == len(reqOids)*maxRepetitions
-		varBinds = varBinds.Sort().Uniq()
-
-		for i, _ := range reqOids {
-			matched := varBinds.MatchBaseOids(oids[i])
-			mLength := len(matched)
-
-			if mLength == 0 || resBinds.MatchOid(matched[mLength-1].Oid) != nil {
-				reqOids[i] = nil
+		// RFC 3416 Section 4.2.3, the VarBinds of the repeaters are in row-major order,
+		// so that each VarBind is attributed to the column by the position, not by the OID.
+		// (a column that leaves its subtree returns the OIDs in the subtree of other columns)
+		columns := len(reqOids)
+		done := make([]bool, columns)
+		for j, val := range varBinds {
+			i := j % columns
+			if done[i] {
 				continue
 			}
 
-			hasError := false
-			for _, val := range matched {
-				switch val.Variable.(type) {
-				case *NoSucheObject, *NoSucheInstance, *EndOfMibView:
-					hasError = true
-				default:
-					resBinds = append(resBinds, val)
-					reqOids[i] = val.Oid
+			if IsException(val.Variable) || val.Oid == nil || !val.Oid.Contains(oids[i]) {
+				done[i] = true
+				continue
+			}
+			// a broken agent returns the same rows again, which makes the walk endless
+			if val.Oid.Compare(reqOids[i]) <= 0 {
+				if s.args.ReportWalkLoops && loopErr == nil {
+					loopErr = &walkLoopError{notIncreasingError(oids[i], reqOids[i], val.Oid, pdu)}
 				}
+				done[i] = true
+				continue
 			}
 
-			if hasError || (filled && mLength < maxRepetitions) {
+			resBinds = append(resBinds, val)
+			reqOids[i] = val.Oid
+		}
+
+		for i := range reqOids {
+			if done[i] || len(varBinds) == 0 {
 				reqOids[i] = nil
 			}
 		}
@@ -265,10 +1208,29 @@ func (s *SNMP) GetBulkWalk(oids Oids, nonRepeaters, maxRepetitions int) (result
 				oids = append(oids[:i], oids[i+1:]...)
 			}
 		}
+
+		if err = fn(nonRepBinds, resBinds, len(reqOids) == 0); err != nil {
+			return nil, err
+		}
 	}
+	return nil, loopErr
+}
 
-	resBinds = append(nonRepBinds, resBinds.Sort().Uniq()...)
-	return NewPduWithVarBinds(s.args.Version, GetResponse, resBinds), nil
+// walkLoopError returns the error of the subtree of the base, in which the OIDs do not increase
+func notIncreasingError(base, previous, returned *Oid, pdu Pdu) error {
+	return &MessageError{
+		Message: fmt.Sprintf("OID is not increasing in the walk of %s - "+
+			"previous [%s], returned [%s]", base, previous, returned),
+		Detail: fmt.Sprintf("Pdu - %s", pdu),
+	}
+}
+
+// loopError returns the error wrapped by the walkLoopError, or nil for the other errors
+func loopError(err error) error {
+	if e, ok := err.(*walkLoopError); ok {
+		return e.error
+	}
+	return nil
 }
 
 func (s *SNMP) V1Trap(varPduV1 TrapPduV1) (err error) {
@@ -354,16 +1316,34 @@ func (s *SNMP) V1Trap(varPduV1 TrapPduV1) (err error) {
 	raw.Bytes[dataTrapLength-1] = (byte)(len(raw.Bytes) - dataTrapLength)
 
 	marbuf, _ := asn1.Marshal(raw)
-	fmt.Println(hex.Dump(marbuf))
+	s.args.onWire(Outbound, marbuf)
 
 	s.conn.SetWriteDeadline(time.Now().Add(s.args.Timeout))
 	_, err = s.conn.Write(marbuf[:len(marbuf)])
-	fmt.Println("err = ", err)
 	return err
 }
 
+// Send trap, the varBinds must start with the sysUpTime.0 and snmpTrapOID.0 (RFC3416 Section 4.2.6).
+// If the varBinds start with the snmpTrapOID.0, the sysUpTime.0 is inserted
+// with the elapsed time since the SNMP was created.
 func (s *SNMP) V2Trap(varBinds VarBinds) error {
-	return s.v2trap(SNMPTrapV2, varBinds)
+	_, err := s.v2trap(SNMPTrapV2, varBinds, s.sendOptions())
+	return err
+}
+
+// Send trap with the sysUpTime.0 and snmpTrapOID.0, which are prepended to the varBinds.
+func (s *SNMP) SendTrap(uptime uint32, trapOid *Oid, varBinds VarBinds) error {
+	if trapOid == nil {
+		return &ArgumentError{
+			Value:   trapOid,
+			Message: "TrapOid is required",
+		}
+	}
+
+	v := make(VarBinds, 0, len(varBinds)+2)
+	v = append(v, NewVarBind(OidSysUpTime, NewTimeTicks(uptime)))
+	v = append(v, NewVarBind(OidSnmpTrap, trapOid))
+	return s.V2Trap(append(v, varBinds...))
 }
 
 // Send trap with the authoritative engine boots and time when used with SNMP V3.
@@ -387,46 +1367,286 @@ func (s *SNMP) V2TrapWithBootsTime(varBinds VarBinds, eBoots, eTime int) error {
 	}()
 	s.args.authEngineBoots = eBoots
 	s.args.authEngineTime = eTime
-	return s.v2trap(SNMPTrapV2, varBinds)
+	_, err := s.v2trap(SNMPTrapV2, varBinds, s.sendOptions())
+	return err
 }
 
+// Send InformRequest and wait for the acknowledgement (GetResponse) from the receiver,
+// the request is retransmitted on the timeout up to the Retries.
+// An error is returned if it is never acknowledged or the acknowledgement has the error status.
 func (s *SNMP) InformRequest(varBinds VarBinds) error {
-	return s.v2trap(InformRequest, varBinds)
+	return s.informRequest(varBinds, s.sendOptions())
 }
 
-func (s *SNMP) v2trap(pduType PduType, varBinds VarBinds) (err error) {
-	fmt.Println("v2trap")
-	if s.args.Version < V2c {
+func (s *SNMP) informRequest(varBinds VarBinds, opts sendOptions) error {
+	if err := s.Open(); err != nil {
+		return err
+	}
+	// RFC3414, the receiver of InformRequest is an authoritative engine,
+	// so that the boots and time of the receiver are required also with the SecurityEngineId
+	if u, ok := s.engine.sec.(*usm); ok {
+		if err := u.Synchronize(context.Background(), s); err != nil {
+			return err
+		}
+	}
+	ack, err := s.v2trap(InformRequest, varBinds, opts)
+	if err != nil {
+		return err
+	}
+	if ack == nil || ack.PduType() != GetResponse {
+		return &MessageError{
+			Message: "InformRequest is not acknowledged",
+			Detail:  fmt.Sprintf("Pdu - %s", ack),
+		}
+	}
+	if ack.ErrorStatus().IsError() {
+		return &MessageError{
+			Message: fmt.Sprintf("InformRequest is acknowledged with the error - %s", ack.ErrorStatus()),
+			Detail:  fmt.Sprintf("Pdu - %s", ack),
+		}
+	}
+	return nil
+}
+
+// InformRequestWithTimeout is like InformRequest, but waits for the acknowledgment
+// with the timeout and retries instead of the Timeout and Retries of the arguments
+// (e.g. for a slow manager). The timeout of 0 or less is the Timeout of the arguments.
+func (s *SNMP) InformRequestWithTimeout(varBinds VarBinds, timeout time.Duration, retries uint) error {
+	if retries > retriesMaximum {
 		return &ArgumentError{
+			Value:   retries,
+			Message: fmt.Sprintf("Retries is range 0..%d", retriesMaximum),
+		}
+	}
+	opts := s.sendOptions()
+	if timeout > 0 {
+		opts.timeout = timeout
+	}
+	opts.retries = retries
+	return s.informRequest(varBinds, opts)
+}
+
+func (s *SNMP) v2trap(pduType PduType, varBinds VarBinds, opts sendOptions) (result Pdu, err error) {
+	if s.args.Version < V2c {
+		return nil, &ArgumentError{
 			Value:   s.args.Version,
 			Message: "Unsupported SNMP Version",
 		}
 	}
 
+	if varBinds, err = s.notificationVarBinds(varBinds); err != nil {
+		return
+	}
 	pdu := NewPduWithVarBinds(s.args.Version, pduType, varBinds)
-	_, err = s.sendPdu(pdu)
-	return
+	return s.sendPduContext(context.Background(), pdu, opts)
+}
+
+// notificationVarBinds validates the leading sysUpTime.0 and snmpTrapOID.0 of the varBinds,
+// the sysUpTime.0 is inserted if missing
+func (s *SNMP) notificationVarBinds(varBinds VarBinds) (VarBinds, error) {
+	if len(varBinds) > 0 && varBinds[0].Oid.Equal(OidSnmpTrap) {
+		uptime := NewUptimeTicks(s.startTime)
+		varBinds = append(VarBinds{NewVarBind(OidSysUpTime, uptime)}, varBinds...)
+	}
+	if len(varBinds) < 2 || !varBinds[0].Oid.Equal(OidSysUpTime) || !varBinds[1].Oid.Equal(OidSnmpTrap) {
+		return nil, &ArgumentError{
+			Value:   varBinds,
+			Message: "VarBinds must start with the sysUpTime.0 and snmpTrapOID.0",
+		}
+	}
+	for _, v := range varBinds[2:] {
+		if v.Oid.Equal(OidSysUpTime) || v.Oid.Equal(OidSnmpTrap) {
+			return nil, &ArgumentError{
+				Value:   varBinds,
+				Message: fmt.Sprintf("%s is not in the leading VarBinds", v.Oid),
+			}
+		}
+	}
+	if _, ok := varBinds[0].Variable.(*TimeTicks); !ok {
+		return nil, &ArgumentError{
+			Value:   varBinds[0],
+			Message: "Type of sysUpTime.0 is not TimeTicks",
+		}
+	}
+	if _, ok := varBinds[1].Variable.(*Oid); !ok {
+		return nil, &ArgumentError{
+			Value:   varBinds[1],
+			Message: "Type of snmpTrapOID.0 is not ObjectIdentifier",
+		}
+	}
+	return varBinds, nil
+}
+
+// sendOptions are the settings of a request passed down the send path,
+// so that a request overrides them without changing the arguments shared by the requests
+type sendOptions struct {
+	timeout   time.Duration // Timeout of each attempt
+	retries   uint          // Number of retries
+	community []byte        // Community of the message instead of the security (V1 or V2c specific)
+}
+
+// sendOptions returns the settings of a request given by the arguments
+func (s *SNMP) sendOptions() sendOptions {
+	return sendOptions{
+		timeout: s.args.Timeout,
+		retries: s.args.Retries,
+	}
 }
 
 func (s *SNMP) sendPdu(pdu Pdu) (result Pdu, err error) {
-	fmt.Println("sendPdu")
+	return s.sendPduContext(context.Background(), pdu, s.sendOptions())
+}
+
+// sendPduContext sends the pdu with the opts, and the request is aborted with ctx.Err()
+// when the ctx is canceled or expires
+func (s *SNMP) sendPduContext(ctx context.Context, pdu Pdu, opts sendOptions) (result Pdu, err error) {
 	if err = s.Open(); err != nil {
 		return
 	}
+	result, _, _, err = s.sendPduOn(ctx, s.conn, pdu, opts)
+	return
+}
 
-	retry(int(s.args.Retries), func() error {
-		result, err = s.engine.SendPdu(pdu, s.conn, s.args)
-		return err
-	})
+// sendPduFrom sends the pdu like sendPdu, and returns the source address of the response.
+// With UDP, the pdu is sent from an unconnected socket, so that the response
+// from another address than the Address (e.g. to a broadcast address) is received.
+func (s *SNMP) sendPduFrom(pdu Pdu) (result Pdu, src net.Addr, err error) {
+	if err = s.Open(); err != nil {
+		return
+	}
+	conn := s.conn
+	if c, ok := s.conn.(*net.UDPConn); ok {
+		if conn, err = s.listenPacket(c.RemoteAddr()); err != nil {
+			return
+		}
+		defer conn.Close()
+	}
+	result, src, _, err = s.sendPduOn(context.Background(), conn, pdu, s.sendOptions())
+	return
+}
+
+// listenPacket returns an unconnected socket, which sends to the addr
+func (s *SNMP) listenPacket(addr net.Addr) (net.Conn, error) {
+	var lc net.ListenConfig
+	if s.args.BindToDevice != "" {
+		lc.Control = bindToDeviceControl(s.args.BindToDevice)
+	}
+	conn, err := lc.ListenPacket(context.Background(), s.args.Network, ":0")
+	if err != nil {
+		return nil, err
+	}
+	return &unconnectedConn{PacketConn: conn, addr: addr}, nil
+}
+
+// sendPduWithStats sends the pdu, and returns the statistics of the request
+// measured after opening the connection
+func (s *SNMP) sendPduWithStats(pdu Pdu) (result Pdu, src net.Addr, stats RequestStats, err error) {
+	if err = s.Open(); err != nil {
+		return
+	}
+	return s.sendPduOn(context.Background(), s.conn, pdu, s.sendOptions())
+}
+
+// sendPduOn sends the pdu on the conn, which is the connection or an unconnected socket,
+// the retransmission and the waiting for the response are aborted when the ctx is done
+func (s *SNMP) sendPduOn(ctx context.Context, conn net.Conn, pdu Pdu, opts sendOptions) (
+	result Pdu, src net.Addr, stats RequestStats, err error) {
+
+	if done := ctx.Done(); done != nil {
+		// wakes up the blocked read by the expired deadline
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-done:
+				conn.SetDeadline(time.Now())
+			case <-stop:
+			}
+		}()
+	}
+
+	stats = RequestStats{PduType: pdu.PduType()}
+	start := time.Now()
+	send := func() {
+		retry(int(opts.retries), func() error {
+			stats.Attempts++
+			result, src, err = s.engine.SendPdu(ctx, pdu, conn, s.args, opts, &stats)
+			if ctx.Err() != nil {
+				// not a net.Error, so that it is not retried
+				result, err = nil, ctx.Err()
+				return err
+			}
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				stats.Timeouts++
+			}
+			return err
+		})
+	}
+
+	_, ok := s.engine.sec.(*community)
+	if ok && pdu.PduType() == SetRequest && s.args.WriteCommunity != "" {
+		opts.community = []byte(s.args.WriteCommunity)
+		send()
+	} else if ok && len(s.args.Communities) > 0 {
+		// an agent does not respond to the wrong community,
+		// so tries the next community on the timeout and remembers the responded one
+		for _, name := range s.communities() {
+			opts.community = []byte(name)
+			send()
+			if e, ok := err.(net.Error); !ok || !e.Timeout() {
+				s.setCommunity(name)
+				break
+			}
+		}
+	} else {
+		send()
+	}
+
+	// the port unreachable is notified on the connected socket,
+	// so that a down agent is detected without waiting for the timeout
+	if isConnectionRefused(err) {
+		err = &UnreachableError{
+			Address: s.args.Address,
+			Cause:   err,
+		}
+	}
+
+	stats.Duration = time.Since(start)
+	stats.Error = err
+	s.lastAttempts = stats.Attempts
+	s.lastPduType = stats.PduType
+	if s.args.OnRequestComplete != nil {
+		s.args.OnRequestComplete(stats)
+	}
 	return
 }
 
+// communities returns the answered community followed by the other Communities
+func (s *SNMP) communities() []string {
+	s.communityLock.Lock()
+	defer s.communityLock.Unlock()
+	list := []string{s.community}
+	for _, c := range s.args.Communities {
+		if c != s.community {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+func (s *SNMP) setCommunity(name string) {
+	s.communityLock.Lock()
+	defer s.communityLock.Unlock()
+	s.community = name
+}
+
 func (s *SNMP) String() string {
 	if s.conn == nil {
 		return fmt.Sprintf(`{"conn": false, "args": %s, "engine": null}`, s.args.String())
 	} else {
-		return fmt.Sprintf(`{"conn": true, "args": %s, "engine": %s}`,
-			s.args.String(), s.engine.String())
+		return fmt.Sprintf(`{"conn": true, "args": %s, "engine": %s, `+
+			`"securityEngineId": "%s", "authoritative": %t}`,
+			s.args.String(), s.engine.String(), s.SecurityEngineId(), s.Authoritative())
 	}
 }
 
@@ -436,5 +1656,75 @@ func NewSNMP(args SNMPArguments) (*SNMP, error) {
 		return nil, err
 	}
 	args.setDefault()
-	return &SNMP{args: &args}, nil
+	return &SNMP{args: &args, startTime: time.Now(), community: args.Community}, nil
+}
+
+// Create a SNMP Object using the supplied connection instead of dialing the Address
+// (e.g. a connection through a tunnel, or an in-memory connection for testing).
+// The connection is used on the first Open (the discovery runs over it with SNMP V3),
+// and is closed by Close, after that Open dials the Address as usual.
+func NewSNMPWithConn(args SNMPArguments, conn net.Conn) (*SNMP, error) {
+	if conn == nil {
+		return nil, &ArgumentError{
+			Value:   conn,
+			Message: "Connection is required",
+		}
+	}
+	snmp, err := NewSNMP(args)
+	if err != nil {
+		return nil, err
+	}
+	snmp.userConn = conn
+	return snmp, nil
+}
+
+// A result of MultiGet for an agent
+type MultiResult struct {
+	Address string // Address of the agent
+	Pdu     Pdu    // Response, nil if Err is not nil
+	Err     error  // Error of creating, opening or requesting
+}
+
+// MultiGet sends the GetRequest of the oids to each agent of the arguments concurrently,
+// at most concurrency agents at a time (unbounded if concurrency is 0 or less).
+// The results are returned in the same order as the arguments.
+func MultiGet(args []SNMPArguments, oids Oids, concurrency int) []MultiResult {
+	if concurrency <= 0 || concurrency > len(args) {
+		concurrency = len(args)
+	}
+	results := make([]MultiResult, len(args))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range args {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = multiGet(args[i], oids)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+func multiGet(args SNMPArguments, oids Oids) (r MultiResult) {
+	r.Address = args.Address
+	snmp, err := NewSNMP(args)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	if err = snmp.Open(); err != nil {
+		r.Err = err
+		return
+	}
+	defer snmp.Close()
+	r.Pdu, r.Err = snmp.GetRequest(oids)
+	if r.Err != nil {
+		r.Pdu = nil
+	}
+	return
 }
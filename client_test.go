@@ -1,10 +1,28 @@
 package snmpgo_test
 
 import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"math"
+	"net"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/k-sone/snmpgo"
+	"github.com/k-sone/snmpgo/snmptest"
 )
 
 func TestSNMPArguments(t *testing.T) {
@@ -30,6 +48,42 @@ func TestSNMPArguments(t *testing.T) {
 		}
 	}
 
+	args = &snmpgo.SNMPArguments{Version: snmpgo.V2c, Community: "public", Retries: 10}
+	err = snmpgo.ArgsValidate(args)
+	if err != nil {
+		t.Errorf("validate() - retries(max) has error %v", err)
+	}
+
+	args = &snmpgo.SNMPArguments{Version: snmpgo.V2c, Community: "public", Retries: 11}
+	err = snmpgo.ArgsValidate(args)
+	if err == nil {
+		t.Error("validate() - retries(max)")
+	}
+
+	args = &snmpgo.SNMPArguments{Version: snmpgo.V2c}
+	err = snmpgo.ArgsValidate(args)
+	if err == nil {
+		t.Error("validate() - empty community")
+	}
+
+	args = &snmpgo.SNMPArguments{Version: snmpgo.V1, Community: strings.Repeat("a", 256)}
+	err = snmpgo.ArgsValidate(args)
+	if err == nil {
+		t.Error("validate() - oversized community")
+	}
+
+	args = &snmpgo.SNMPArguments{Version: snmpgo.V2c, Community: "public"}
+	err = snmpgo.ArgsValidate(args)
+	if err != nil {
+		t.Errorf("validate() - has error %v", err)
+	}
+
+	args = &snmpgo.SNMPArguments{Version: snmpgo.V1, Community: strings.Repeat("a", 255)}
+	err = snmpgo.ArgsValidate(args)
+	if err != nil {
+		t.Errorf("validate() - has error %v", err)
+	}
+
 	args = &snmpgo.SNMPArguments{Version: snmpgo.V3}
 	err = snmpgo.ArgsValidate(args)
 	if err == nil {
@@ -95,8 +149,153 @@ func TestSNMPArguments(t *testing.T) {
 	if err != nil {
 		t.Errorf("validate() - has error %v", err)
 	}
+
+	args = &snmpgo.SNMPArguments{
+		Version:       snmpgo.V3,
+		UserName:      "MyName",
+		SkipDiscovery: true,
+	}
+	err = snmpgo.ArgsValidate(args)
+	if err == nil {
+		t.Error("validate() - skip discovery without engine id")
+	}
+
+	args = &snmpgo.SNMPArguments{
+		Version:          snmpgo.V3,
+		UserName:         "MyName",
+		SecurityEngineId: "8000000004736e6d70676f",
+		SkipDiscovery:    true,
+		EngineBoots:      -1,
+	}
+	err = snmpgo.ArgsValidate(args)
+	if err == nil {
+		t.Error("validate() - engine boots")
+	}
+
+	args = &snmpgo.SNMPArguments{
+		Version:          snmpgo.V3,
+		UserName:         "MyName",
+		SecurityEngineId: "8000000004736e6d70676f",
+		SkipDiscovery:    true,
+		EngineTime:       -1,
+	}
+	err = snmpgo.ArgsValidate(args)
+	if err == nil {
+		t.Error("validate() - engine time")
+	}
+}
+
+func TestSNMPArgumentsText(t *testing.T) {
+	type textValue interface {
+		encoding.TextMarshaler
+		encoding.TextUnmarshaler
+	}
+	for _, c := range []struct {
+		value, decoded textValue
+		text           string
+	}{
+		{ptrVersion(snmpgo.V1), new(snmpgo.SNMPVersion), "v1"},
+		{ptrVersion(snmpgo.V2c), new(snmpgo.SNMPVersion), "v2c"},
+		{ptrVersion(snmpgo.V3), new(snmpgo.SNMPVersion), "v3"},
+		{ptrLevel(snmpgo.NoAuthNoPriv), new(snmpgo.SecurityLevel), "noAuthNoPriv"},
+		{ptrLevel(snmpgo.AuthNoPriv), new(snmpgo.SecurityLevel), "authNoPriv"},
+		{ptrLevel(snmpgo.AuthPriv), new(snmpgo.SecurityLevel), "authPriv"},
+		{ptrAuth(snmpgo.Md5), new(snmpgo.AuthProtocol), "MD5"},
+		{ptrAuth(snmpgo.Sha), new(snmpgo.AuthProtocol), "SHA"},
+		{ptrPriv(snmpgo.Des), new(snmpgo.PrivProtocol), "DES"},
+		{ptrPriv(snmpgo.Aes), new(snmpgo.PrivProtocol), "AES"},
+	} {
+		text, err := c.value.MarshalText()
+		if err != nil || string(text) != c.text {
+			t.Errorf("MarshalText() - expected [%s], actual [%s], err %v", c.text, text, err)
+		}
+		// case-insensitive
+		if err = c.decoded.UnmarshalText([]byte(strings.ToUpper(c.text))); err != nil {
+			t.Errorf("UnmarshalText() - [%s] has error %v", c.text, err)
+		}
+		if !reflect.DeepEqual(c.decoded, c.value) {
+			t.Errorf("UnmarshalText() - expected [%v], actual [%v]", c.value, c.decoded)
+		}
+		if err = c.decoded.UnmarshalText([]byte("invalid")); err == nil {
+			t.Errorf("UnmarshalText() - [%s] accepts an invalid value", c.text)
+		}
+	}
+
+	if _, err := snmpgo.SNMPVersion(2).MarshalText(); err == nil {
+		t.Error("MarshalText() - invalid SNMPVersion")
+	}
+	if _, err := snmpgo.SecurityLevel(3).MarshalText(); err == nil {
+		t.Error("MarshalText() - invalid SecurityLevel")
+	}
+	if _, err := snmpgo.AuthProtocol("SHA256").MarshalText(); err == nil {
+		t.Error("MarshalText() - invalid AuthProtocol")
+	}
+	if _, err := snmpgo.PrivProtocol("AES256").MarshalText(); err == nil {
+		t.Error("MarshalText() - invalid PrivProtocol")
+	}
+
+	// JSON round-trip of a configuration
+	args := snmpgo.SNMPArguments{
+		Version:       snmpgo.V3,
+		UserName:      "MyName",
+		SecurityLevel: snmpgo.AuthNoPriv,
+		AuthPassword:  "aaaaaaaa",
+		AuthProtocol:  snmpgo.Sha,
+	}
+	b, err := json.Marshal(&args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"Version":"v3"`) ||
+		!strings.Contains(string(b), `"SecurityLevel":"authNoPriv"`) {
+		t.Errorf("json.Marshal() - unexpected text %s", b)
+	}
+	var decoded snmpgo.SNMPArguments
+	if err = json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Version != args.Version || decoded.SecurityLevel != args.SecurityLevel ||
+		decoded.AuthProtocol != args.AuthProtocol || decoded.PrivProtocol != "" {
+		t.Errorf("json.Unmarshal() - expected %v, actual %v", &args, &decoded)
+	}
+}
+
+func TestParseArgumentsText(t *testing.T) {
+	if v, err := snmpgo.ParseSNMPVersion("V2C"); err != nil || v != snmpgo.V2c {
+		t.Errorf("ParseSNMPVersion() - expected [%v], actual [%v], err %v", snmpgo.V2c, v, err)
+	}
+	if v, err := snmpgo.ParseSNMPVersion("3"); err != nil || v != snmpgo.V3 {
+		t.Errorf("ParseSNMPVersion() - expected [%v], actual [%v], err %v", snmpgo.V3, v, err)
+	}
+	if l, err := snmpgo.ParseSecurityLevel("AuthPriv"); err != nil || l != snmpgo.AuthPriv {
+		t.Errorf("ParseSecurityLevel() - expected [%v], actual [%v], err %v", snmpgo.AuthPriv, l, err)
+	}
+	if a, err := snmpgo.ParseAuthProtocol("sha"); err != nil || a != snmpgo.Sha {
+		t.Errorf("ParseAuthProtocol() - expected [%v], actual [%v], err %v", snmpgo.Sha, a, err)
+	}
+	if p, err := snmpgo.ParsePrivProtocol("Aes"); err != nil || p != snmpgo.Aes {
+		t.Errorf("ParsePrivProtocol() - expected [%v], actual [%v], err %v", snmpgo.Aes, p, err)
+	}
+
+	if _, err := snmpgo.ParseSNMPVersion("v4"); err == nil {
+		t.Error("ParseSNMPVersion() - v4 is accepted")
+	}
+	if _, err := snmpgo.ParseSecurityLevel("privOnly"); err == nil {
+		t.Error("ParseSecurityLevel() - privOnly is accepted")
+	}
+	if _, err := snmpgo.ParseAuthProtocol("SHA256"); err == nil {
+		t.Error("ParseAuthProtocol() - SHA256 is accepted")
+	}
+	if _, err := snmpgo.ParsePrivProtocol("3DES"); err == nil {
+		t.Error("ParsePrivProtocol() - 3DES is accepted")
+	}
 }
 
+func ptrVersion(v snmpgo.SNMPVersion) *snmpgo.SNMPVersion   { return &v }
+func ptrLevel(v snmpgo.SecurityLevel) *snmpgo.SecurityLevel { return &v }
+func ptrAuth(v snmpgo.AuthProtocol) *snmpgo.AuthProtocol    { return &v }
+func ptrPriv(v snmpgo.PrivProtocol) *snmpgo.PrivProtocol    { return &v }
+
 func TestSNMP(t *testing.T) {
 	_, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
 		Version:       snmpgo.V3,
@@ -112,3 +311,2190 @@ func TestSNMP(t *testing.T) {
 		t.Error("checkPdu() - report oid")
 	}
 }
+
+func TestSNMPSkipDiscovery(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	engineId := "8000000004736e6d70676f"
+	args := snmpgo.SNMPArguments{
+		Version:          snmpgo.V3,
+		Address:          conn.LocalAddr().String(),
+		Timeout:          200 * time.Millisecond,
+		UserName:         "MyName",
+		SecurityLevel:    snmpgo.AuthPriv,
+		AuthPassword:     "aaaaaaaa",
+		AuthProtocol:     snmpgo.Sha,
+		PrivPassword:     "bbbbbbbb",
+		PrivProtocol:     snmpgo.Aes,
+		SecurityEngineId: engineId,
+		SkipDiscovery:    true,
+		EngineBoots:      3,
+		EngineTime:       1000,
+	}
+	snmp, err := snmpgo.NewSNMP(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	pkts := make(chan []byte, 8)
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				close(pkts)
+				return
+			}
+			pkt := make([]byte, n)
+			copy(pkt, buf)
+			pkts <- pkt
+		}
+	}()
+
+	snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime})
+	conn.Close()
+	if snmp.Authoritative() {
+		t.Error("Authoritative() - expected false for the request with the SecurityEngineId")
+	}
+
+	var recv [][]byte
+	for pkt := range pkts {
+		recv = append(recv, pkt)
+	}
+	if len(recv) != 1 {
+		t.Fatalf("GetRequest() - expected 1 message without discovery, actual %d", len(recv))
+	}
+
+	msg, _, err := snmpgo.UnmarshalMessage(recv[0])
+	if err != nil {
+		t.Fatalf("UnmarshalMessage() - has error %v", err)
+	}
+	m := snmpgo.ToMessageV3(msg)
+	if !m.Authentication() || !m.Privacy() {
+		t.Error("GetRequest() - security flag")
+	}
+	if snmpgo.ToHexStr(m.AuthEngineId, "") != engineId {
+		t.Errorf("GetRequest() - engine id expected [%s], actual [%s]",
+			engineId, snmpgo.ToHexStr(m.AuthEngineId, ""))
+	}
+	if m.AuthEngineBoots != 3 || m.AuthEngineTime < 1000 {
+		t.Errorf("GetRequest() - boots/time expected [3/1000], actual [%d/%d]",
+			m.AuthEngineBoots, m.AuthEngineTime)
+	}
+
+	sec := snmpgo.NewSecurity(&args)
+	eid, _ := hex.DecodeString(engineId)
+	snmpgo.ToUsm(sec).SetAuthEngineId(eid)
+	if err = sec.ProcessIncomingMessage(msg); err != nil {
+		t.Fatalf("ProcessIncomingMessage() - has error %v", err)
+	}
+	pdu := msg.Pdu()
+	if pdu.PduType() != snmpgo.GetRequest || len(pdu.VarBinds()) != 1 ||
+		!pdu.VarBinds()[0].Oid.Equal(snmpgo.OidSysUpTime) {
+		t.Errorf("GetRequest() - unexpected pdu %v", pdu)
+	}
+}
+
+func newMockSNMP(t *testing.T, agent *snmptest.Agent) *snmpgo.SNMP {
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   agent.Address(),
+		Network:   "udp",
+		Timeout:   200 * time.Millisecond,
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snmp
+}
+
+// newMockTable returns the rows of the columns that are under the base oid.
+func newMockTable(base string, columns, rows int) snmpgo.VarBinds {
+	var varBinds snmpgo.VarBinds
+	for c := 1; c <= columns; c++ {
+		for r := 1; r <= rows; r++ {
+			oid := snmpgo.MustNewOid(fmt.Sprintf("%s.%d.%d", base, c, r))
+			varBinds = append(varBinds, snmpgo.NewVarBind(oid, snmpgo.NewInteger(int32(c*1000+r))))
+		}
+	}
+	return varBinds
+}
+
+// countRequests wraps the handler to count the number of requests.
+func countRequests(count *int32, handler func(snmpgo.Pdu) snmpgo.Pdu) func(snmpgo.Pdu) snmpgo.Pdu {
+	return func(req snmpgo.Pdu) snmpgo.Pdu {
+		atomic.AddInt32(count, 1)
+		return handler(req)
+	}
+}
+
+func TestSNMPGetRequestFrom(t *testing.T) {
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		return snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, snmpgo.VarBinds{
+			snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+		})
+	})
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	pdu, src, err := snmp.GetRequestFrom(snmpgo.Oids{snmpgo.OidSysUpTime})
+	if err != nil {
+		t.Fatalf("GetRequestFrom() - has error %v", err)
+	}
+	if len(pdu.VarBinds()) != 1 {
+		t.Errorf("GetRequestFrom() - unexpected pdu %v", pdu)
+	}
+	if src == nil || src.String() != agent.Address() {
+		t.Errorf("GetRequestFrom() - source expected [%s], actual [%v]", agent.Address(), src)
+	}
+
+	// the request to the listener is answered from the relay, which has another address
+	listener, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	relay, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+	agentAddr, _ := net.ResolveUDPAddr("udp4", agent.Address())
+	go func() {
+		buf := make([]byte, 2048)
+		n, client, err := listener.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		relay.WriteTo(buf[:n], agentAddr)
+		if n, _, err = relay.ReadFrom(buf); err != nil {
+			return
+		}
+		relay.WriteTo(buf[:n], client)
+	}()
+
+	other, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   listener.LocalAddr().String(),
+		Network:   "udp4",
+		Timeout:   time.Second,
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	if _, src, err = other.GetRequestFrom(snmpgo.Oids{snmpgo.OidSysUpTime}); err != nil {
+		t.Fatalf("GetRequestFrom() - has error %v", err)
+	}
+	if src == nil || src.String() != relay.LocalAddr().String() {
+		t.Errorf("GetRequestFrom() - source expected [%s], actual [%v]", relay.LocalAddr(), src)
+	}
+}
+
+func TestSNMPGetStringAndInt(t *testing.T) {
+	sysDescr := snmpgo.MustNewOid("1.3.6.1.2.1.1.1.0")
+	ifInOctets := snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.10.1")
+	agent := snmptest.NewAgentWithHandler(t, "public", snmptest.MibHandler(snmpgo.VarBinds{
+		snmpgo.NewVarBind(sysDescr, snmpgo.NewOctetString([]byte("router"))),
+		snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+		snmpgo.NewVarBind(ifInOctets, snmpgo.NewCounter32(math.MaxUint32)),
+	}))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	if v, err := snmp.GetString(sysDescr); err != nil || v != "router" {
+		t.Errorf("GetString() - expected [router], actual [%s], err %v", v, err)
+	}
+	if v, err := snmp.GetInt(ifInOctets); err != nil || v != math.MaxUint32 {
+		t.Errorf("GetInt() - expected [%d], actual [%d], err %v", uint32(math.MaxUint32), v, err)
+	}
+	if v, err := snmp.GetInt(snmpgo.OidSysUpTime); err != nil || v != 100 {
+		t.Errorf("GetInt() - expected [100], actual [%d], err %v", v, err)
+	}
+
+	// absent
+	absent := snmpgo.MustNewOid("1.3.6.1.2.1.1.5.0")
+	if _, err := snmp.GetString(absent); err == nil || !strings.Contains(err.Error(), "NoSuchObject") {
+		t.Errorf("GetString() - expected NoSuchObject, actual %v", err)
+	}
+	if _, err := snmp.GetInt(absent); err == nil || !strings.Contains(err.Error(), "NoSuchObject") {
+		t.Errorf("GetInt() - expected NoSuchObject, actual %v", err)
+	}
+
+	// type mismatch
+	if _, err := snmp.GetString(ifInOctets); err == nil {
+		t.Error("GetString() - Counter32 is accepted")
+	} else if _, ok := err.(*snmpgo.MessageError); !ok {
+		t.Errorf("GetString() - expected MessageError, actual %v", err)
+	}
+	if _, err := snmp.GetInt(sysDescr); err == nil {
+		t.Error("GetInt() - OctetString is accepted")
+	} else if _, ok := err.(*snmpgo.MessageError); !ok {
+		t.Errorf("GetInt() - expected MessageError, actual %v", err)
+	}
+}
+
+func TestSNMPSendTrap(t *testing.T) {
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest)}
+	s := snmptest.NewTrapServer("localhost:0", trapQueue)
+	defer s.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   snmpgo.ListeningUDPAddress(s),
+		Network:   "udp4",
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	if err = snmp.SendTrap(100, nil, nil); err == nil {
+		t.Error("SendTrap() - nil trap oid")
+	}
+
+	trapOid := snmpgo.MustNewOid("1.3.6.1.6.3.1.1.5.3")
+	extra := snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1.1"), snmpgo.NewInteger(1))
+	if err = snmp.SendTrap(12345, trapOid, snmpgo.VarBinds{extra}); err != nil {
+		t.Fatalf("SendTrap() - has error %v", err)
+	}
+
+	trap := trapQueue.takeNextTrap()
+	if trap == nil || trap.Error != nil {
+		t.Fatalf("trap is not received: %v", trap)
+	}
+	varBinds := trap.Pdu.VarBinds()
+	if len(varBinds) != 3 {
+		t.Fatalf("SendTrap() - expected 3 varbinds, actual %v", varBinds)
+	}
+	if !varBinds[0].Oid.Equal(snmpgo.OidSysUpTime) ||
+		varBinds[0].Variable.(*snmpgo.TimeTicks).Value != 12345 {
+		t.Errorf("SendTrap() - unexpected sysUpTime %v", varBinds[0])
+	}
+	if !varBinds[1].Oid.Equal(snmpgo.OidSnmpTrap) ||
+		!varBinds[1].Variable.(*snmpgo.Oid).Equal(trapOid) {
+		t.Errorf("SendTrap() - unexpected snmpTrapOID %v", varBinds[1])
+	}
+	if !varBinds[2].Oid.Equal(extra.Oid) {
+		t.Errorf("SendTrap() - unexpected varbind %v", varBinds[2])
+	}
+}
+
+func TestSNMPGetBulkWalkWithOptions(t *testing.T) {
+	mib := append(newMockTable("1.3.6.1.2.1.2.2.1", 1, 20),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.31.1.1.1.1.1"), snmpgo.NewInteger(1)))
+	var count int32
+	agent := snmptest.NewAgentWithHandler(t, "public", countRequests(&count, snmptest.MibHandler(mib)))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	oids := snmpgo.Oids{snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1")}
+
+	pdu, truncated, err := snmp.GetBulkWalkWithOptions(oids, 0, 5, snmpgo.WalkOptions{MaxRows: 7})
+	if err != nil {
+		t.Fatalf("GetBulkWalkWithOptions() - has error %v", err)
+	}
+	if !truncated {
+		t.Error("GetBulkWalkWithOptions() - expected truncated")
+	}
+	if l := len(pdu.VarBinds()); l != 7 {
+		t.Errorf("GetBulkWalkWithOptions() - expected 7 varbinds, actual %d", l)
+	}
+	if c := atomic.LoadInt32(&count); c != 2 {
+		t.Errorf("GetBulkWalkWithOptions() - expected 2 requests, actual %d", c)
+	}
+	if !pdu.VarBinds()[6].Oid.Equal(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1.7")) {
+		t.Errorf("GetBulkWalkWithOptions() - unexpected last varbind %v", pdu.VarBinds()[6])
+	}
+
+	pdu, truncated, err = snmp.GetBulkWalkWithOptions(oids, 0, 5, snmpgo.WalkOptions{MaxRows: 100})
+	if err != nil {
+		t.Fatalf("GetBulkWalkWithOptions() - has error %v", err)
+	}
+	if truncated || len(pdu.VarBinds()) != 20 {
+		t.Errorf("GetBulkWalkWithOptions() - expected 20 varbinds, actual %d, truncated %t",
+			len(pdu.VarBinds()), truncated)
+	}
+
+	_, _, err = snmp.GetBulkWalkWithOptions(oids, 0, 5, snmpgo.WalkOptions{MaxRows: -1})
+	if _, ok := err.(*snmpgo.ArgumentError); !ok {
+		t.Errorf("GetBulkWalkWithOptions() - expected ArgumentError, actual %v", err)
+	}
+}
+
+func TestSNMPGetBulkWalkStop(t *testing.T) {
+	var count int32
+	agent := snmptest.NewAgentWithHandler(t, "public",
+		countRequests(&count, snmptest.MibHandler(newMockTable("1.3.6.1.2.1.2.2.1", 1, 20))))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	target := snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1.3")
+	var evaluated int
+	pdu, truncated, err := snmp.GetBulkWalkWithOptions(
+		snmpgo.Oids{snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1")}, 0, 2, snmpgo.WalkOptions{
+			Stop: func(vb *snmpgo.VarBind) bool {
+				evaluated++
+				return vb.Oid.Equal(target)
+			},
+		})
+	if err != nil {
+		t.Fatalf("GetBulkWalkWithOptions() - has error %v", err)
+	}
+	if !truncated {
+		t.Error("GetBulkWalkWithOptions() - expected truncated")
+	}
+	if varBinds := pdu.VarBinds(); len(varBinds) != 3 || !varBinds[2].Oid.Equal(target) {
+		t.Errorf("GetBulkWalkWithOptions() - expected 3 varbinds to %s, actual %v", target, varBinds)
+	}
+	if evaluated != 3 {
+		t.Errorf("GetBulkWalkWithOptions() - expected 3 evaluations, actual %d", evaluated)
+	}
+	if c := atomic.LoadInt32(&count); c != 2 {
+		t.Errorf("GetBulkWalkWithOptions() - expected 2 requests, actual %d", c)
+	}
+}
+
+func TestSNMPGetBulkWalkProgress(t *testing.T) {
+	var count int32
+	agent := snmptest.NewAgentWithHandler(t, "public",
+		countRequests(&count, snmptest.MibHandler(newMockTable("1.3.6.1.2.1.2.2.1", 1, 12))))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	var progress []int
+	pdu, _, err := snmp.GetBulkWalkWithOptions(
+		snmpgo.Oids{snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1")}, 0, 5, snmpgo.WalkOptions{
+			OnProgress: func(rows int) {
+				progress = append(progress, rows)
+			},
+		})
+	if err != nil {
+		t.Fatalf("GetBulkWalkWithOptions() - has error %v", err)
+	}
+	if len(pdu.VarBinds()) != 12 {
+		t.Errorf("GetBulkWalkWithOptions() - expected 12 varbinds, actual %d", len(pdu.VarBinds()))
+	}
+	if c := atomic.LoadInt32(&count); int(c) != len(progress) {
+		t.Errorf("GetBulkWalkWithOptions() - expected %d callbacks, actual %d", c, len(progress))
+	}
+	if expected := []int{5, 10, 12}; !reflect.DeepEqual(progress, expected) {
+		t.Errorf("GetBulkWalkWithOptions() - expected progress %v, actual %v", expected, progress)
+	}
+}
+
+func TestSNMPGetBulkWalkDeadline(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	var count int32
+	handler := snmptest.MibHandler(newMockTable("1.3.6.1.2.1.2.2.1", 1, 20))
+	agent := snmptest.NewAgentWithHandler(t, "public", countRequests(&count, func(req snmpgo.Pdu) snmpgo.Pdu {
+		time.Sleep(delay)
+		return handler(req)
+	}))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	// the deadline passes during the second round
+	pdu, truncated, err := snmp.GetBulkWalkWithOptions(
+		snmpgo.Oids{snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1")}, 0, 2, snmpgo.WalkOptions{
+			Deadline: time.Now().Add(delay + delay/2),
+		})
+	if err != nil {
+		t.Fatalf("GetBulkWalkWithOptions() - has error %v", err)
+	}
+	if !truncated {
+		t.Error("GetBulkWalkWithOptions() - expected truncated")
+	}
+	if c := atomic.LoadInt32(&count); c != 2 {
+		t.Errorf("GetBulkWalkWithOptions() - expected 2 requests, actual %d", c)
+	}
+	if varBinds := pdu.VarBinds(); len(varBinds) != 4 ||
+		!varBinds[3].Oid.Equal(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1.4")) {
+		t.Errorf("GetBulkWalkWithOptions() - expected 4 varbinds, actual %v", varBinds)
+	}
+}
+
+func TestSNMPGetBulkWalkLoop(t *testing.T) {
+	// a broken agent returning the first rows again and again
+	rows := snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1.1"), snmpgo.NewInteger(1)),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1.2"), snmpgo.NewInteger(2)),
+	}
+	var count int32
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		if atomic.AddInt32(&count, 1) > 10 {
+			return nil
+		}
+		return snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, rows)
+	})
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	// the subtree is ended silently by default
+	oids := snmpgo.Oids{snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1")}
+	pdu, err := snmp.GetBulkWalk(oids, 0, 2)
+	if err != nil || len(pdu.VarBinds()) != 2 {
+		t.Errorf("GetBulkWalk() - expected 2 varbinds, actual %v, error %v", pdu, err)
+	}
+	if c := atomic.LoadInt32(&count); c != 2 {
+		t.Errorf("GetBulkWalk() - expected 2 requests, actual %d", c)
+	}
+
+	atomic.StoreInt32(&count, 0)
+	snmp, err = snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:         snmpgo.V2c,
+		Address:         agent.Address(),
+		Network:         "udp",
+		Timeout:         200 * time.Millisecond,
+		Community:       "public",
+		ReportWalkLoops: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	// the walked varbinds are returned with the error
+	pdu, err = snmp.GetBulkWalk(oids, 0, 2)
+	if _, ok := err.(*snmpgo.MessageError); !ok || !strings.Contains(err.Error(), "not increasing") {
+		t.Errorf("GetBulkWalk() - expected the loop error, actual %v", err)
+	}
+	if pdu == nil || len(pdu.VarBinds()) != 2 {
+		t.Errorf("GetBulkWalk() - expected 2 varbinds, actual %v", pdu)
+	}
+	if c := atomic.LoadInt32(&count); c != 2 {
+		t.Errorf("GetBulkWalk() - expected 2 requests, actual %d", c)
+	}
+}
+
+func TestSNMPGetBulkWalkRepetitions(t *testing.T) {
+	handler := snmptest.MibHandler(newMockTable("1.3.6.1.2.1.2.2.1", 2, 10))
+	var lock sync.Mutex
+	repetitions := make(map[string][]int)
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		lock.Lock()
+		for _, v := range req.VarBinds() {
+			column := v.Oid.Value[:10].String()
+			repetitions[column] = append(repetitions[column], req.ErrorIndex())
+		}
+		lock.Unlock()
+		return handler(req)
+	})
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	oids := snmpgo.Oids{
+		snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1"),
+		snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2"),
+	}
+	pdu, _, err := snmp.GetBulkWalkWithOptions(oids, 0, 5,
+		snmpgo.WalkOptions{Repetitions: []int{2, 20}})
+	if err != nil {
+		t.Fatalf("GetBulkWalkWithOptions() - has error %v", err)
+	}
+	if l := len(pdu.VarBinds()); l != 20 {
+		t.Errorf("GetBulkWalkWithOptions() - expected 20 varbinds, actual %d", l)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for column, exp := range map[string]int{"1.3.6.1.2.1.2.2.1.1": 2, "1.3.6.1.2.1.2.2.1.2": 20} {
+		reps := repetitions[column]
+		if len(reps) == 0 {
+			t.Errorf("GetBulkWalkWithOptions() - column %s is not requested", column)
+		}
+		for _, r := range reps {
+			if r != exp {
+				t.Errorf("GetBulkWalkWithOptions() - expected maxRepetitions %d for %s, actual %v",
+					exp, column, reps)
+				break
+			}
+		}
+	}
+
+	for _, reps := range [][]int{{2}, {2, -1}} {
+		_, _, err = snmp.GetBulkWalkWithOptions(oids, 0, 5, snmpgo.WalkOptions{Repetitions: reps})
+		if _, ok := err.(*snmpgo.ArgumentError); !ok {
+			t.Errorf("GetBulkWalkWithOptions() - expected ArgumentError with %v, actual %v", reps, err)
+		}
+	}
+}
+
+func TestSNMPGetBulkWalkPreserveOrder(t *testing.T) {
+	agent := snmptest.NewAgentWithHandler(t, "public", snmptest.MibHandler(newMockTable("1.3.6.1.2.1.2.2.1", 10, 3)))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	// the column 10 follows the column 2 in the OID order
+	colA := snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.10")
+	colB := snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2")
+	pdu, _, err := snmp.GetBulkWalkWithOptions(snmpgo.Oids{colA, colB}, 0, 2,
+		snmpgo.WalkOptions{PreserveOrder: true})
+	if err != nil {
+		t.Fatalf("GetBulkWalkWithOptions() - has error %v", err)
+	}
+	varBinds := pdu.VarBinds()
+	if len(varBinds) != 6 {
+		t.Fatalf("GetBulkWalkWithOptions() - expected 6 varbinds, actual %v", varBinds)
+	}
+	for i, val := range varBinds {
+		col := colA
+		if i >= 3 {
+			col = colB
+		}
+		if !val.Oid.Contains(col) {
+			t.Errorf("GetBulkWalkWithOptions() - expected varbinds[%d] in %s, actual %v", i, col, val)
+		}
+	}
+}
+
+func TestSNMPWalkFunc(t *testing.T) {
+	mib := append(newMockTable("1.3.6.1.2.1.2.2.1", 2, 12),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.31.1.1.1.1.1"), snmpgo.NewInteger(1)))
+	var count int32
+	agent := snmptest.NewAgentWithHandler(t, "public", countRequests(&count, snmptest.MibHandler(mib)))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	oids := snmpgo.Oids{
+		snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1"),
+		snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2"),
+	}
+
+	calls := 0
+	err := snmp.WalkFunc(oids, 5, func(vb *snmpgo.VarBind) error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkFunc() - has error %v", err)
+	}
+	if calls != 24 {
+		t.Errorf("WalkFunc() - expected 24 callbacks, actual %d", calls)
+	}
+
+	stop := fmt.Errorf("stop")
+	calls = 0
+	atomic.StoreInt32(&count, 0)
+	err = snmp.WalkFunc(oids, 5, func(vb *snmpgo.VarBind) error {
+		calls++
+		if calls == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("WalkFunc() - expected stop error, actual %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("WalkFunc() - expected 3 callbacks, actual %d", calls)
+	}
+	if c := atomic.LoadInt32(&count); c != 1 {
+		t.Errorf("WalkFunc() - expected 1 request, actual %d", c)
+	}
+}
+
+func TestSNMPWalkWithin(t *testing.T) {
+	// the sibling subtree follows the table
+	mib := append(newMockTable("1.3.6.1.2.1.2.2.1", 1, 3),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.2.1"), snmpgo.NewInteger(1)))
+	var count int32
+	agent := snmptest.NewAgentWithHandler(t, "public", countRequests(&count, snmptest.MibHandler(mib)))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	base := snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1")
+	varBinds, err := snmp.WalkWithin(base)
+	if err != nil {
+		t.Fatalf("WalkWithin() - has error %v", err)
+	}
+	if len(varBinds) != 3 {
+		t.Fatalf("WalkWithin() - expected 3 varbinds, actual %v", varBinds)
+	}
+	for _, val := range varBinds {
+		if !val.Oid.Contains(base) {
+			t.Errorf("WalkWithin() - out of the subtree %v", val)
+		}
+	}
+	if c := atomic.LoadInt32(&count); c != 4 {
+		t.Errorf("WalkWithin() - expected 4 requests, actual %d", c)
+	}
+
+	// the end of the MIB view
+	varBinds, err = snmp.WalkWithin(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.2"))
+	if err != nil || len(varBinds) != 1 {
+		t.Errorf("WalkWithin() - expected 1 varbind, actual %v, err %v", varBinds, err)
+	}
+
+	if _, err = snmp.WalkWithin(nil); err == nil {
+		t.Error("WalkWithin() - nil base")
+	}
+}
+
+func TestSNMPGetBulkRequestTruncated(t *testing.T) {
+	var rows int32
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		var varBinds snmpgo.VarBinds
+		for i := 1; i <= int(atomic.LoadInt32(&rows)); i++ {
+			oid := snmpgo.MustNewOid(fmt.Sprintf("1.3.6.1.2.1.2.2.1.2.%d", i))
+			varBinds = append(varBinds,
+				snmpgo.NewVarBind(oid, snmpgo.NewOctetString(bytes.Repeat([]byte("a"), 100))))
+		}
+		return snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, varBinds)
+	})
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	oids := snmpgo.Oids{snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2")}
+	for _, c := range []struct {
+		maxRepetitions int
+		rows           int32
+		truncated      bool
+	}{
+		// near the MessageMaxSize of 1400 bytes
+		{20, 11, true},
+		// the end of the subtree
+		{20, 2, false},
+		// as many as requested
+		{5, 5, false},
+	} {
+		atomic.StoreInt32(&rows, c.rows)
+		pdu, truncated, err := snmp.GetBulkRequestTruncated(oids, 0, c.maxRepetitions)
+		if err != nil {
+			t.Fatalf("GetBulkRequestTruncated() - has error %v", err)
+		}
+		if len(pdu.VarBinds()) != int(c.rows) {
+			t.Errorf("GetBulkRequestTruncated() - unexpected pdu %v", pdu)
+		}
+		if truncated != c.truncated {
+			t.Errorf("GetBulkRequestTruncated() - %d rows, expected truncated %t, actual %t",
+				c.rows, c.truncated, truncated)
+		}
+	}
+}
+
+func TestSNMPBulkWalk(t *testing.T) {
+	mib := newMockTable("1.3.6.1.2.1.2.2.1", 1, 3)
+	var failing int32
+	handler := snmptest.MibHandler(mib)
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		if atomic.LoadInt32(&failing) != 0 {
+			res := snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, req.VarBinds())
+			res.SetErrorStatus(snmpgo.GenError)
+			return res
+		}
+		return handler(req)
+	})
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	oids := snmpgo.Oids{snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1")}
+	varBinds, err := snmp.BulkWalk(oids, 0, 2)
+	if err != nil {
+		t.Fatalf("BulkWalk() - has error %v", err)
+	}
+	if len(varBinds) != 3 {
+		t.Fatalf("BulkWalk() - expected 3 varbinds, actual %v", varBinds)
+	}
+	for i, val := range varBinds {
+		if !val.Oid.Equal(mib[i].Oid) {
+			t.Errorf("BulkWalk() - expected [%s], actual [%s]", mib[i].Oid, val.Oid)
+		}
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	varBinds, err = snmp.BulkWalk(oids, 0, 2)
+	if _, ok := err.(*snmpgo.MessageError); !ok || varBinds != nil {
+		t.Errorf("BulkWalk() - expected MessageError, actual %v, %v", varBinds, err)
+	}
+}
+
+func TestSNMPGetBulkWalkSparseTable(t *testing.T) {
+	// column 1 ends before column 2, and column 2 reaches the end of the mib
+	mib := append(newMockTable("1.3.6.1.2.1.2.2.1", 1, 3),
+		newMockTable("1.3.6.1.2.1.2.2.1", 2, 12)[12:]...)
+	agent := snmptest.NewAgentWithHandler(t, "public", snmptest.MibHandler(mib))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	oids := snmpgo.Oids{
+		snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1"),
+		snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2"),
+	}
+	for _, maxRepetitions := range []int{1, 4, 5, 12, 20} {
+		pdu, err := snmp.GetBulkWalk(oids, 0, maxRepetitions)
+		if err != nil {
+			t.Fatalf("GetBulkWalk() - has error %v", err)
+		}
+		varBinds := pdu.VarBinds()
+		if len(varBinds) != 15 {
+			t.Errorf("GetBulkWalk() - maxRepetitions %d, expected 15 varbinds, actual %d",
+				maxRepetitions, len(varBinds))
+			continue
+		}
+		for i, val := range varBinds {
+			if _, ok := val.Variable.(*snmpgo.Integer); !ok || !mib[i].Oid.Equal(val.Oid) {
+				t.Errorf("GetBulkWalk() - maxRepetitions %d, expected %v, actual %v",
+					maxRepetitions, mib[i], val)
+			}
+		}
+	}
+}
+
+func TestSNMPMessageMaxSize(t *testing.T) {
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		return snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, req.VarBinds())
+	})
+	defer agent.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:        snmpgo.V2c,
+		Address:        agent.Address(),
+		Network:        "udp4",
+		Timeout:        200 * time.Millisecond,
+		MessageMaxSize: 484,
+		Community:      "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	var oids snmpgo.Oids
+	for i := 1; i <= 40; i++ {
+		oids = append(oids, snmpgo.MustNewOid(fmt.Sprintf("1.3.6.1.2.1.2.2.1.2.%d", i)))
+	}
+	_, err = snmp.GetRequest(oids)
+	if e, ok := err.(*snmpgo.ArgumentError); !ok {
+		t.Fatalf("GetRequest() - expected ArgumentError, actual %v", err)
+	} else if !strings.Contains(e.Message, "MessageMaxSize(484)") ||
+		!strings.Contains(e.Message, "with 40 VarBinds") {
+		t.Errorf("GetRequest() - unexpected message %s", e.Message)
+	}
+
+	if _, err = snmp.GetRequest(oids[:10]); err != nil {
+		t.Errorf("GetRequest() - has error %v", err)
+	}
+}
+
+func TestSNMPOnWire(t *testing.T) {
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		return snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, snmpgo.VarBinds{
+			snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+		})
+	})
+	defer agent.Close()
+
+	var dirs []snmpgo.Direction
+	var bufs [][]byte
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   agent.Address(),
+		Network:   "udp4",
+		Timeout:   200 * time.Millisecond,
+		Community: "public",
+		OnWire: func(dir snmpgo.Direction, b []byte) {
+			dirs = append(dirs, dir)
+			bufs = append(bufs, b)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	if _, err = snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime}); err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if len(dirs) != 2 || dirs[0] != snmpgo.Outbound || dirs[1] != snmpgo.Inbound {
+		t.Fatalf("OnWire - unexpected directions %v", dirs)
+	}
+	for i, b := range bufs {
+		if len(b) == 0 {
+			t.Errorf("OnWire - empty %s buffer", dirs[i])
+		}
+		if _, _, err := snmpgo.UnmarshalMessage(b); err != nil {
+			t.Errorf("OnWire - %s buffer is not a message: %v", dirs[i], err)
+		}
+	}
+}
+
+func TestSNMPGetScalarsAndColumns(t *testing.T) {
+	mib := append(newMockTable("1.3.6.1.2.1.2.2.1", 2, 3),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.1.1.0"), snmpgo.NewOctetString([]byte("descr"))),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.1.3.0"), snmpgo.NewTimeTicks(100)))
+	handler := snmptest.MibHandler(mib)
+	var nonRepeaters, maxRepetitions int32
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		atomic.StoreInt32(&nonRepeaters, int32(req.ErrorStatus()))
+		atomic.StoreInt32(&maxRepetitions, int32(req.ErrorIndex()))
+		return handler(req)
+	})
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	scalars := snmpgo.Oids{
+		snmpgo.MustNewOid("1.3.6.1.2.1.1.1"),
+		snmpgo.MustNewOid("1.3.6.1.2.1.1.3"),
+	}
+	columns := snmpgo.Oids{
+		snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1"),
+		snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2"),
+	}
+	pdu, err := snmp.GetScalarsAndColumns(scalars, columns, 3)
+	if err != nil {
+		t.Fatalf("GetScalarsAndColumns() - has error %v", err)
+	}
+	if n, m := atomic.LoadInt32(&nonRepeaters), atomic.LoadInt32(&maxRepetitions); int(n) != len(scalars) || m != 3 {
+		t.Errorf("GetScalarsAndColumns() - expected nonRepeaters %d and maxRepetitions 3, "+
+			"actual %d and %d", len(scalars), n, m)
+	}
+
+	expOids := []string{
+		"1.3.6.1.2.1.1.1.0",
+		"1.3.6.1.2.1.1.3.0",
+		"1.3.6.1.2.1.2.2.1.1.1",
+		"1.3.6.1.2.1.2.2.1.2.1",
+		"1.3.6.1.2.1.2.2.1.1.2",
+		"1.3.6.1.2.1.2.2.1.2.2",
+		"1.3.6.1.2.1.2.2.1.1.3",
+		"1.3.6.1.2.1.2.2.1.2.3",
+	}
+	varBinds := pdu.VarBinds()
+	if len(varBinds) != len(expOids) {
+		t.Fatalf("GetScalarsAndColumns() - expected %d varbinds, actual %v", len(expOids), varBinds)
+	}
+	for i, exp := range expOids {
+		if varBinds[i].Oid.String() != exp {
+			t.Errorf("GetScalarsAndColumns() - expected [%s], actual [%s]", exp, varBinds[i].Oid)
+		}
+	}
+}
+
+func TestSNMPOnRequestComplete(t *testing.T) {
+	var count int32
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		// drops the first request and the requests while the count is negative
+		if n := atomic.AddInt32(&count, 1); n == 1 || n <= 0 {
+			return nil
+		}
+		return snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, snmpgo.VarBinds{
+			snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+		})
+	})
+	defer agent.Close()
+
+	var stats []snmpgo.RequestStats
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   agent.Address(),
+		Network:   "udp4",
+		Timeout:   100 * time.Millisecond,
+		Retries:   1,
+		Community: "public",
+		OnRequestComplete: func(s snmpgo.RequestStats) {
+			stats = append(stats, s)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	if _, err = snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime}); err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("OnRequestComplete - expected 1 call, actual %d", len(stats))
+	}
+	s := stats[0]
+	if s.PduType != snmpgo.GetRequest || s.Attempts != 2 || s.Timeouts != 1 || s.Error != nil {
+		t.Errorf("OnRequestComplete - unexpected stats %+v", s)
+	}
+	if s.Duration < 100*time.Millisecond || s.BytesSent == 0 || s.BytesReceived == 0 {
+		t.Errorf("OnRequestComplete - unexpected stats %+v", s)
+	}
+	if n := snmp.LastAttempts(); n != 2 {
+		t.Errorf("LastAttempts() - expected 2, actual %d", n)
+	}
+
+	// all attempts time out
+	atomic.StoreInt32(&count, -10)
+	stats = nil
+	if _, err = snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime}); err == nil {
+		t.Fatal("GetRequest() - no error")
+	}
+	if len(stats) != 1 || stats[0].Attempts != 2 || stats[0].Timeouts != 2 || stats[0].Error != err {
+		t.Errorf("OnRequestComplete - unexpected stats %+v", stats)
+	}
+
+	// answered at the first attempt
+	atomic.StoreInt32(&count, 10)
+	if _, err = snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime}); err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if n := snmp.LastAttempts(); n != 1 {
+		t.Errorf("LastAttempts() - expected 1, actual %d", n)
+	}
+}
+
+func TestSNMPOverIPv6(t *testing.T) {
+	conn, err := net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback is not available: %v", err)
+	}
+
+	agent := snmptest.NewAgentWithConn(t, conn, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		return snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, snmpgo.VarBinds{
+			snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+		})
+	})
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	pdu, src, err := snmp.GetRequestFrom(snmpgo.Oids{snmpgo.OidSysUpTime})
+	if err != nil {
+		t.Fatalf("GetRequestFrom() - has error %v", err)
+	}
+	if len(pdu.VarBinds()) != 1 {
+		t.Errorf("GetRequestFrom() - unexpected pdu %v", pdu)
+	}
+	if src == nil || src.String() != agent.Address() {
+		t.Errorf("GetRequestFrom() - source expected [%s], actual [%v]", agent.Address(), src)
+	}
+}
+
+func TestSNMPGetBulkWalkFrom(t *testing.T) {
+	base := "1.3.6.1.2.1.16.9.2.1"
+	mib := newMockTable(base, 2, 5)
+	var current atomic.Value
+	handler := func(req snmpgo.Pdu) snmpgo.Pdu {
+		return snmptest.MibHandler(current.Load().(snmpgo.VarBinds))(req)
+	}
+	agent := snmptest.NewAgentWithHandler(t, "public", handler)
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	oids := snmpgo.Oids{snmpgo.MustNewOid(base + ".1"), snmpgo.MustNewOid(base + ".2")}
+
+	// rows 1..3 of both columns exist at the first walk
+	current.Store(append(append(snmpgo.VarBinds{}, mib[0:3]...), mib[5:8]...))
+	pdu, cursors, err := snmp.GetBulkWalkFrom(oids, snmpgo.Oids{nil, nil}, 2)
+	if err != nil {
+		t.Fatalf("GetBulkWalkFrom() - has error %v", err)
+	}
+	if len(pdu.VarBinds()) != 6 {
+		t.Errorf("GetBulkWalkFrom() - expected 6 varbinds, actual %v", pdu.VarBinds())
+	}
+	if cursors[0].String() != base+".1.3" || cursors[1].String() != base+".2.3" {
+		t.Errorf("GetBulkWalkFrom() - unexpected cursors %v", cursors)
+	}
+
+	// rows 4..5 of the first column are appended
+	current.Store(append(append(snmpgo.VarBinds{}, mib[0:5]...), mib[5:8]...))
+	pdu, cursors, err = snmp.GetBulkWalkFrom(oids, cursors, 2)
+	if err != nil {
+		t.Fatalf("GetBulkWalkFrom() - has error %v", err)
+	}
+	varBinds := pdu.VarBinds()
+	if len(varBinds) != 2 || varBinds[0].Oid.String() != base+".1.4" ||
+		varBinds[1].Oid.String() != base+".1.5" {
+		t.Errorf("GetBulkWalkFrom() - expected only new rows, actual %v", varBinds)
+	}
+	if cursors[0].String() != base+".1.5" || cursors[1].String() != base+".2.3" {
+		t.Errorf("GetBulkWalkFrom() - unexpected cursors %v", cursors)
+	}
+
+	// nothing is appended
+	pdu, _, err = snmp.GetBulkWalkFrom(oids, cursors, 2)
+	if err != nil || len(pdu.VarBinds()) != 0 {
+		t.Errorf("GetBulkWalkFrom() - expected no varbinds, actual %v, err %v", pdu, err)
+	}
+
+	_, _, err = snmp.GetBulkWalkFrom(oids, snmpgo.Oids{nil}, 2)
+	if _, ok := err.(*snmpgo.ArgumentError); !ok {
+		t.Errorf("GetBulkWalkFrom() - expected ArgumentError for cursors, actual %v", err)
+	}
+	_, _, err = snmp.GetBulkWalkFrom(oids, snmpgo.Oids{cursors[1], nil}, 2)
+	if _, ok := err.(*snmpgo.ArgumentError); !ok {
+		t.Errorf("GetBulkWalkFrom() - expected ArgumentError for cursor, actual %v", err)
+	}
+}
+
+func TestSNMPCommunities(t *testing.T) {
+	agent := snmptest.NewAgentWithHandler(t, "new", func(req snmpgo.Pdu) snmpgo.Pdu {
+		return snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, snmpgo.VarBinds{
+			snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+		})
+	})
+	defer agent.Close()
+
+	var attempts []int
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:     snmpgo.V2c,
+		Address:     agent.Address(),
+		Network:     "udp",
+		Timeout:     100 * time.Millisecond,
+		Communities: []string{"old", "new"},
+		OnRequestComplete: func(s snmpgo.RequestStats) {
+			attempts = append(attempts, s.Attempts)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err = snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime}); err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+	}
+	// the second request uses the remembered community
+	if len(attempts) != 2 || attempts[0] != 2 || attempts[1] != 1 {
+		t.Errorf("GetRequest() - unexpected attempts %v", attempts)
+	}
+	if !strings.Contains(snmp.String(), `"Community":"old"`) {
+		t.Errorf("GetRequest() - the arguments are changed %s", snmp)
+	}
+
+	args := snmpgo.SNMPArguments{Version: snmpgo.V2c, Communities: []string{"public", ""}}
+	if err = snmpgo.ArgsValidate(&args); err == nil {
+		t.Error("validate() - empty community in Communities")
+	}
+}
+
+func TestSNMPWriteCommunity(t *testing.T) {
+	agent := snmptest.NewAgentWithHandler(t, "private", func(req snmpgo.Pdu) snmpgo.Pdu {
+		return snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, req.VarBinds())
+	})
+	defer agent.Close()
+
+	var sent [][]byte
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:        snmpgo.V2c,
+		Address:        agent.Address(),
+		Network:        "udp",
+		Timeout:        100 * time.Millisecond,
+		Community:      "public",
+		WriteCommunity: "private",
+		OnWire: func(dir snmpgo.Direction, b []byte) {
+			if dir == snmpgo.Outbound {
+				sent = append(sent, append([]byte(nil), b...))
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	varBinds := snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.1.5.0"), snmpgo.NewOctetString([]byte("MyHost"))),
+	}
+	if _, err = snmp.SetRequest(varBinds); err != nil {
+		t.Fatalf("SetRequest() - has error %v", err)
+	}
+	if len(sent) != 1 || !bytes.Contains(sent[0], []byte("private")) {
+		t.Errorf("SetRequest() - expected the write community, actual %v", sent)
+	}
+
+	// the agent does not respond to the read community
+	sent = nil
+	if _, err = snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime}); err == nil {
+		t.Error("GetRequest() - expected timeout with the read community")
+	}
+	if len(sent) != 1 || !bytes.Contains(sent[0], []byte("public")) {
+		t.Errorf("GetRequest() - expected the read community, actual %v", sent)
+	}
+
+	args := snmpgo.SNMPArguments{
+		Version: snmpgo.V2c, Community: "public", WriteCommunity: strings.Repeat("a", 256)}
+	if err = snmpgo.ArgsValidate(&args); err == nil {
+		t.Error("validate() - invalid WriteCommunity")
+	}
+}
+
+func TestSNMPBufferSizes(t *testing.T) {
+	const size = 65536
+	snmp, _ := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:         snmpgo.V2c,
+		Address:         "127.0.0.1:161",
+		Network:         "udp",
+		Community:       "public",
+		ReadBufferSize:  size,
+		WriteBufferSize: size,
+	})
+	if err := snmp.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	read, write, err := snmp.BufferSizes()
+	if err != nil {
+		t.Skipf("BufferSizes() - not supported: %v", err)
+	}
+	// the OS may round up the requested sizes
+	if read < size {
+		t.Errorf("BufferSizes() - expected read >= %d, actual %d", size, read)
+	}
+	if write < size {
+		t.Errorf("BufferSizes() - expected write >= %d, actual %d", size, write)
+	}
+
+	args := snmpgo.SNMPArguments{Version: snmpgo.V2c, Community: "public", ReadBufferSize: -1}
+	if err = snmpgo.ArgsValidate(&args); err == nil {
+		t.Error("validate() - negative ReadBufferSize")
+	}
+}
+
+func TestSNMPArgumentsClone(t *testing.T) {
+	args := snmpgo.SNMPArguments{
+		Version:     snmpgo.V2c,
+		Address:     "192.0.2.1:161",
+		Communities: []string{"public", "private"},
+	}
+	snmpgo.SetArgsAuthEngine(&args, 10, 100)
+
+	clone := args.Clone()
+	clone.Address = "192.0.2.2:161"
+	clone.Communities[0] = "changed"
+
+	if args.Address != "192.0.2.1:161" {
+		t.Errorf("Clone() - original Address is changed %s", args.Address)
+	}
+	if args.Communities[0] != "public" {
+		t.Errorf("Clone() - original Communities is changed %v", args.Communities)
+	}
+	if boots, eTime := snmpgo.ArgsAuthEngine(&clone); boots != 0 || eTime != 0 {
+		t.Errorf("Clone() - engine cache is not zeroed, boots %d, time %d", boots, eTime)
+	}
+	if boots, eTime := snmpgo.ArgsAuthEngine(&args); boots != 10 || eTime != 100 {
+		t.Errorf("Clone() - original engine cache is changed, boots %d, time %d", boots, eTime)
+	}
+}
+
+type recordLogger struct {
+	logs []string
+}
+
+func (l *recordLogger) Print(v ...interface{}) {
+	l.logs = append(l.logs, fmt.Sprint(v...))
+}
+
+func (l *recordLogger) Printf(format string, v ...interface{}) {
+	l.logs = append(l.logs, fmt.Sprintf(format, v...))
+}
+
+func TestSNMPArgumentsSecurityLevel(t *testing.T) {
+	tests := []struct {
+		level        snmpgo.SecurityLevel
+		authPassword string
+		authProtocol snmpgo.AuthProtocol
+		privPassword string
+		privProtocol snmpgo.PrivProtocol
+		err          string
+		warn         string
+	}{
+		{snmpgo.AuthNoPriv, "", "", "", "", "requires AuthPassword and AuthProtocol", ""},
+		{snmpgo.AuthNoPriv, "aaaaaaaa", "", "", "", "Illegal AuthProtocol", ""},
+		{snmpgo.AuthNoPriv, "", snmpgo.Md5, "", "", "AuthPassword is at least", ""},
+		{snmpgo.AuthPriv, "", "", "", "", "requires AuthPassword and AuthProtocol", ""},
+		{snmpgo.AuthPriv, "aaaaaaaa", snmpgo.Md5, "", "", "requires PrivPassword and PrivProtocol", ""},
+		{snmpgo.AuthPriv, "aaaaaaaa", snmpgo.Md5, "bbbbbbbb", "", "Illegal PrivProtocol", ""},
+		{snmpgo.AuthPriv, "aaaaaaaa", snmpgo.Md5, "", snmpgo.Des, "PrivPassword is at least", ""},
+		{snmpgo.AuthPriv, "aaaaaaaa", snmpgo.Md5, "bbbbbbbb", snmpgo.Des, "", ""},
+		{snmpgo.AuthNoPriv, "aaaaaaaa", snmpgo.Md5, "", "", "", ""},
+		{snmpgo.NoAuthNoPriv, "", "", "", "", "", ""},
+		{snmpgo.NoAuthNoPriv, "aaaaaaaa", snmpgo.Md5, "", "", "",
+			"SecurityLevel NoAuthNoPriv ignores AuthPassword, AuthProtocol"},
+		{snmpgo.NoAuthNoPriv, "", "", "bbbbbbbb", snmpgo.Des, "",
+			"SecurityLevel NoAuthNoPriv ignores PrivPassword, PrivProtocol"},
+		{snmpgo.AuthNoPriv, "aaaaaaaa", snmpgo.Md5, "bbbbbbbb", "", "",
+			"SecurityLevel AuthNoPriv ignores PrivPassword"},
+	}
+
+	for i, test := range tests {
+		logger := &recordLogger{}
+		args := &snmpgo.SNMPArguments{
+			Version:       snmpgo.V3,
+			UserName:      "MyName",
+			SecurityLevel: test.level,
+			AuthPassword:  test.authPassword,
+			AuthProtocol:  test.authProtocol,
+			PrivPassword:  test.privPassword,
+			PrivProtocol:  test.privProtocol,
+			Logger:        logger,
+		}
+		err := snmpgo.ArgsValidate(args)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("[%d] validate() - has error %v", i, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("[%d] validate() - expected error `%s`, actual `%v`", i, test.err, err)
+		}
+
+		if test.warn == "" {
+			if len(logger.logs) != 0 {
+				t.Errorf("[%d] validate() - unexpected warnings %v", i, logger.logs)
+			}
+		} else if len(logger.logs) != 1 || !strings.Contains(logger.logs[0], test.warn) {
+			t.Errorf("[%d] validate() - expected warning `%s`, actual %v", i, test.warn, logger.logs)
+		}
+	}
+
+	// nothing is logged to the standard logger without the Logger
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	args := &snmpgo.SNMPArguments{
+		Version:       snmpgo.V3,
+		UserName:      "MyName",
+		SecurityLevel: snmpgo.NoAuthNoPriv,
+		AuthPassword:  "aaaaaaaa",
+	}
+	if err := snmpgo.ArgsValidate(args); err != nil || buf.Len() != 0 {
+		t.Errorf("validate() - without Logger, err %v, logged [%s]", err, buf.String())
+	}
+}
+
+func TestSNMPTable(t *testing.T) {
+	table := newMockTable("1.3.6.1.2.1.2.2.1", 3, 4)
+	// the cell of column 2 and row 3 is missing
+	mib := append(table[:6:6], table[7:]...)
+	mib = append(mib,
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.31.1.1.1.1.1"), snmpgo.NewInteger(1)))
+	agent := snmptest.NewAgentWithHandler(t, "public", snmptest.MibHandler(mib))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	rows, err := snmp.Table(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1"), []uint32{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Table() - has error %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("Table() - expected 4 rows, actual %d", len(rows))
+	}
+	for r, row := range rows {
+		for c := uint32(1); c <= 3; c++ {
+			val, ok := row[c]
+			if c == 2 && r+1 == 3 {
+				if ok {
+					t.Errorf("Table() - expected missing cell, actual %v", val)
+				}
+				continue
+			}
+			if i, ok := val.(*snmpgo.Integer); !ok || i.Value != int32(c*1000)+int32(r+1) {
+				t.Errorf("Table() - row %d, column %d, unexpected cell %v", r+1, c, val)
+			}
+		}
+	}
+
+	if _, err = snmp.Table(nil, []uint32{1}); err == nil {
+		t.Error("Table() - nil entry oid")
+	}
+}
+
+func TestSNMPSplitOnTooBig(t *testing.T) {
+	mib := newMockTable("1.3.6.1.2.1.2.2.1", 1, 10)
+	handler := snmptest.MibHandler(mib)
+	var count int32
+	agent := snmptest.NewAgentWithHandler(t, "public", countRequests(&count, func(req snmpgo.Pdu) snmpgo.Pdu {
+		if len(req.VarBinds()) > 4 {
+			res := snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, req.VarBinds())
+			res.SetErrorStatus(snmpgo.TooBig)
+			return res
+		}
+		return handler(req)
+	}))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	var oids snmpgo.Oids
+	for _, val := range mib {
+		oids = append(oids, val.Oid)
+	}
+
+	pdu, err := snmp.GetRequest(oids)
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if pdu.ErrorStatus() != snmpgo.TooBig {
+		t.Errorf("GetRequest() - expected TooBig without SplitOnTooBig, actual %s", pdu.ErrorStatus())
+	}
+
+	snmp, err = snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:       snmpgo.V2c,
+		Address:       agent.Address(),
+		Network:       "udp4",
+		Timeout:       200 * time.Millisecond,
+		Community:     "public",
+		SplitOnTooBig: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	atomic.StoreInt32(&count, 0)
+	pdu, err = snmp.GetRequest(oids)
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if pdu.ErrorStatus() != snmpgo.NoError || len(pdu.VarBinds()) != len(mib) {
+		t.Fatalf("GetRequest() - unexpected pdu %v", pdu)
+	}
+	for i, val := range pdu.VarBinds() {
+		if !val.Oid.Equal(mib[i].Oid) {
+			t.Errorf("GetRequest() - expected %v, actual %v", mib[i], val)
+		}
+	}
+	// 10 -> 5 + 5 -> (2 + 3) + (2 + 3)
+	if c := atomic.LoadInt32(&count); c != 7 {
+		t.Errorf("GetRequest() - expected 7 requests, actual %d", c)
+	}
+}
+
+func TestSNMPContextName(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:          snmpgo.V3,
+		Address:          conn.LocalAddr().String(),
+		Timeout:          50 * time.Millisecond,
+		UserName:         "MyName",
+		SecurityLevel:    snmpgo.NoAuthNoPriv,
+		SecurityEngineId: "8000000004736e6d70676f",
+		SkipDiscovery:    true,
+		ContextName:      "default",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	contextName := func() string {
+		buf := make([]byte, 2048)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, _, err := snmpgo.UnmarshalMessage(buf[:n])
+		if err != nil {
+			t.Fatalf("UnmarshalMessage() - has error %v", err)
+		}
+		if _, err = msg.Pdu().Unmarshal(msg.PduBytes()); err != nil {
+			t.Fatalf("Unmarshal() - has error %v", err)
+		}
+		return string(msg.Pdu().(*snmpgo.ScopedPdu).ContextName)
+	}
+
+	oids := snmpgo.Oids{snmpgo.OidSysUpTime}
+	for _, name := range []string{"vlan-100", "vlan-200"} {
+		snmp.GetRequestWithContextName(oids, name)
+		if actual := contextName(); actual != name {
+			t.Errorf("GetRequestWithContextName() - expected [%s], actual [%s]", name, actual)
+		}
+	}
+
+	snmp.GetRequest(oids)
+	if actual := contextName(); actual != "default" {
+		t.Errorf("GetRequest() - expected [default], actual [%s]", actual)
+	}
+
+	snmp.GetBulkWalkWithOptions(oids, 0, 1, snmpgo.WalkOptions{ContextName: "vlan-300"})
+	if actual := contextName(); actual != "vlan-300" {
+		t.Errorf("GetBulkWalkWithOptions() - expected [vlan-300], actual [%s]", actual)
+	}
+}
+
+func TestSNMPLateResponse(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// answers the late response to the previous request before the response
+	go func() {
+		mp := snmpgo.NewMessageProcessing(snmpgo.V2c)
+		sec := snmpgo.NewSecurity(&snmpgo.SNMPArguments{Version: snmpgo.V2c, Community: "public"})
+		buf := make([]byte, 2048)
+		n, src, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		msg, _, err := snmpgo.UnmarshalMessage(buf[:n])
+		if err != nil {
+			return
+		}
+		req, err := mp.PrepareDataElements(sec, msg, nil)
+		if err != nil {
+			return
+		}
+		for _, ticks := range []uint32{1, 100} {
+			res := snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, snmpgo.VarBinds{
+				snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(ticks)),
+			})
+			resMsg, err := mp.PrepareResponseMessage(sec, res, msg)
+			if err != nil {
+				return
+			}
+			if ticks == 1 {
+				res.SetRequestId(req.RequestId() - 1)
+				sec.GenerateResponseMessage(resMsg)
+			}
+			if b, err := resMsg.Marshal(); err == nil {
+				conn.WriteTo(b, src)
+			}
+		}
+	}()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   conn.LocalAddr().String(),
+		Network:   "udp4",
+		Timeout:   500 * time.Millisecond,
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	pdu, err := snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime})
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	varBinds := pdu.VarBinds()
+	if len(varBinds) != 1 || varBinds[0].Variable.(*snmpgo.TimeTicks).Value != 100 {
+		t.Errorf("GetRequest() - unexpected pdu %v", pdu)
+	}
+}
+
+func TestSNMPPing(t *testing.T) {
+	var silent int32
+	handler := snmptest.MibHandler(snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+	})
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		if atomic.LoadInt32(&silent) != 0 {
+			return nil
+		}
+		return handler(req)
+	})
+	defer agent.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:     snmpgo.V2c,
+		Address:     agent.Address(),
+		Network:     "udp4",
+		Timeout:     5 * time.Second,
+		PingTimeout: 100 * time.Millisecond,
+		Community:   "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	if err = snmp.Ping(); err != nil {
+		t.Errorf("Ping() - has error %v", err)
+	}
+
+	atomic.StoreInt32(&silent, 1)
+	start := time.Now()
+	err = snmp.Ping()
+	if e, ok := err.(*snmpgo.UnreachableError); !ok {
+		t.Errorf("Ping() - expected UnreachableError, actual %v", err)
+	} else if ne, ok := e.Cause.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("Ping() - expected timeout, actual %v", e.Cause)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Ping() - expected PingTimeout, actual %v", d)
+	}
+}
+
+func TestSNMPGetRequestTimed(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	handler := snmptest.MibHandler(snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+	})
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		time.Sleep(delay)
+		return handler(req)
+	})
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	defer snmp.Close()
+
+	pdu, elapsed, err := snmp.GetRequestTimed(snmpgo.Oids{snmpgo.OidSysUpTime})
+	if err != nil {
+		t.Fatalf("GetRequestTimed() - has error %v", err)
+	}
+	if pdu.VarBinds().MatchOid(snmpgo.OidSysUpTime) == nil {
+		t.Errorf("GetRequestTimed() - unexpected pdu %v", pdu)
+	}
+	if elapsed < delay || elapsed > 10*delay {
+		t.Errorf("GetRequestTimed() - expected about %v, actual %v", delay, elapsed)
+	}
+}
+
+func TestMultiGet(t *testing.T) {
+	handler := snmptest.MibHandler(snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+	})
+	var args []snmpgo.SNMPArguments
+	for i := 0; i < 3; i++ {
+		h := handler
+		if i == 1 {
+			// never answers
+			h = func(snmpgo.Pdu) snmpgo.Pdu { return nil }
+		}
+		agent := snmptest.NewAgentWithHandler(t, "public", h)
+		defer agent.Close()
+		args = append(args, snmpgo.SNMPArguments{
+			Version:   snmpgo.V2c,
+			Address:   agent.Address(),
+			Network:   "udp",
+			Timeout:   200 * time.Millisecond,
+			Community: "public",
+		})
+	}
+
+	results := snmpgo.MultiGet(args, snmpgo.Oids{snmpgo.OidSysUpTime}, 2)
+	if len(results) != len(args) {
+		t.Fatalf("MultiGet() - expected %d results, actual %d", len(args), len(results))
+	}
+	for i, r := range results {
+		if r.Address != args[i].Address {
+			t.Errorf("MultiGet() - expected address [%s], actual [%s]", args[i].Address, r.Address)
+		}
+		if i == 1 {
+			var netErr net.Error
+			if !errors.As(r.Err, &netErr) || !netErr.Timeout() || r.Pdu != nil {
+				t.Errorf("MultiGet() - expected timeout, actual %v, %v", r.Pdu, r.Err)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("MultiGet() - [%s] has error %v", r.Address, r.Err)
+		} else if r.Pdu.VarBinds().MatchOid(snmpgo.OidSysUpTime) == nil {
+			t.Errorf("MultiGet() - unexpected pdu %v", r.Pdu)
+		}
+	}
+}
+
+func TestSNMPCapMaxRepetitions(t *testing.T) {
+	var maxRepetitions int32
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		// the maxRepetitions is in the error-index field
+		atomic.StoreInt32(&maxRepetitions, int32(req.ErrorIndex()))
+		return snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, nil)
+	})
+	defer agent.Close()
+
+	oids := snmpgo.Oids{snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2")}
+	limit := snmpgo.MaxRepetitionsFor(484, oids, 0)
+	// (484 - 128) / (2 + 11 + 1 + 2)
+	if limit != 22 {
+		t.Errorf("MaxRepetitionsFor() - expected 22, actual %d", limit)
+	}
+	if n := snmpgo.MaxRepetitionsFor(484, oids, 1); n < math.MaxInt32 {
+		t.Errorf("MaxRepetitionsFor() without repeaters - expected unbounded, actual %d", n)
+	}
+
+	for _, capped := range []bool{false, true} {
+		logger := &recordLogger{}
+		snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+			Version:           snmpgo.V2c,
+			Address:           agent.Address(),
+			Network:           "udp4",
+			Timeout:           200 * time.Millisecond,
+			Community:         "public",
+			MessageMaxSize:    484,
+			CapMaxRepetitions: capped,
+			Logger:            logger,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if _, err = snmp.GetBulkRequest(oids, 0, 1000); err != nil {
+				t.Fatal(err)
+			}
+		}
+		snmp.Close()
+
+		exp, expLogs := int32(1000), 1
+		if capped {
+			exp, expLogs = int32(limit), 0
+		}
+		if n := atomic.LoadInt32(&maxRepetitions); n != exp {
+			t.Errorf("GetBulkRequest() - capped %v, expected maxRepetitions %d, actual %d", capped, exp, n)
+		}
+		if len(logger.logs) != expLogs {
+			t.Errorf("GetBulkRequest() - capped %v, expected %d warnings, actual %v",
+				capped, expLogs, logger.logs)
+		}
+	}
+}
+
+func TestSNMPPortUnreachable(t *testing.T) {
+	// a closed port
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := conn.LocalAddr().String()
+	conn.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   address,
+		Network:   "udp4",
+		Timeout:   2 * time.Second,
+		Retries:   2,
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	start := time.Now()
+	// the port unreachable is always notified on the loopback
+	_, err = snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime})
+	if e, ok := err.(*snmpgo.UnreachableError); !ok || e.Address != address {
+		t.Errorf("GetRequest() - expected UnreachableError, actual %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("GetRequest() - expected to fail immediately, actual %v", d)
+	}
+}
+
+func TestSNMPMaxVarBinds(t *testing.T) {
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu {
+		var varBinds snmpgo.VarBinds
+		for i := 0; i < 150; i++ {
+			varBinds = append(varBinds, snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewNull()))
+		}
+		return snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, varBinds)
+	})
+	defer agent.Close()
+
+	args := snmpgo.SNMPArguments{
+		Version:        snmpgo.V2c,
+		Address:        agent.Address(),
+		Network:        "udp4",
+		Timeout:        200 * time.Millisecond,
+		MessageMaxSize: 65535,
+		MaxVarBinds:    100,
+		Community:      "public",
+	}
+	snmp, err := snmpgo.NewSNMP(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	_, err = snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime})
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit of 100") {
+		t.Errorf("GetRequest() - expected the limit error, actual %v", err)
+	}
+
+	args.MaxVarBinds = 0
+	snmp, err = snmpgo.NewSNMP(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	pdu, err := snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime})
+	if err != nil || len(pdu.VarBinds()) != 150 {
+		t.Errorf("GetRequest() - expected 150 varbinds, actual %v, error %v", pdu, err)
+	}
+
+	args.MaxVarBinds = -1
+	if _, err = snmpgo.NewSNMP(args); err == nil {
+		t.Error("NewSNMP() - negative MaxVarBinds")
+	}
+}
+
+func TestSNMPBindToDevice(t *testing.T) {
+	agent := snmptest.NewAgentWithHandler(t, "public", snmptest.MibHandler(snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+	}))
+	defer agent.Close()
+
+	args := snmpgo.SNMPArguments{
+		Version:      snmpgo.V2c,
+		Address:      agent.Address(),
+		Network:      "udp4",
+		Timeout:      200 * time.Millisecond,
+		Community:    "public",
+		BindToDevice: "lo",
+	}
+	snmp, err := snmpgo.NewSNMP(args)
+	if runtime.GOOS != "linux" {
+		if err == nil {
+			t.Error("NewSNMP() - BindToDevice is accepted on an unsupported platform")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	if err = snmp.Open(); err != nil {
+		// SO_BINDTODEVICE requires CAP_NET_RAW before Linux 5.7
+		if errors.Is(err, syscall.EPERM) {
+			t.Skipf("BindToDevice - not permitted: %v", err)
+		}
+		t.Fatalf("Open() - has error %v", err)
+	}
+	if _, err = snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime}); err != nil {
+		t.Errorf("GetRequest() - has error %v", err)
+	}
+
+	// the option is passed to the socket
+	args.BindToDevice = "snmpgo-none0"
+	snmp, err = snmpgo.NewSNMP(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = snmp.Open(); !errors.Is(err, syscall.ENODEV) {
+		t.Errorf("Open() - expected ENODEV, actual %v", err)
+	}
+
+	args.BindToDevice = strings.Repeat("a", 16)
+	if _, err = snmpgo.NewSNMP(args); err == nil {
+		t.Error("NewSNMP() - oversized BindToDevice")
+	}
+}
+
+func TestSNMPRetries(t *testing.T) {
+	var count int32
+	agent := snmptest.NewAgentWithHandler(t, "public", countRequests(&count, func(req snmpgo.Pdu) snmpgo.Pdu {
+		return nil
+	}))
+	defer agent.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   agent.Address(),
+		Network:   "udp4",
+		Timeout:   50 * time.Millisecond,
+		Retries:   2,
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	if _, err = snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime}); err == nil {
+		t.Fatal("GetRequest() - no error")
+	}
+	// the first attempt and 2 retries
+	if n := atomic.LoadInt32(&count); n != 3 {
+		t.Errorf("GetRequest() - expected 3 attempts, actual %d", n)
+	}
+}
+
+func TestSNMPOpenContext(t *testing.T) {
+	// TEST-NET-1 address, which is not routed
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Network:   "tcp4",
+		Address:   "192.0.2.1:161",
+		Timeout:   10 * time.Second,
+		Retries:   2,
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err = snmp.OpenContext(ctx)
+	elapsed := time.Since(start)
+	if err == nil {
+		snmp.Close()
+		t.Fatal("OpenContext() - connected to the blackholed address")
+	}
+	if ctx.Err() == nil {
+		t.Skipf("OpenContext() - failed before canceling: %v", err)
+	}
+	if err != ctx.Err() {
+		t.Errorf("OpenContext() - expected [%v], actual [%v]", ctx.Err(), err)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("OpenContext() - returned after %v", elapsed)
+	}
+}
+
+func TestSNMPOpenContextDiscovery(t *testing.T) {
+	// an agent never responding
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:       snmpgo.V3,
+		Address:       conn.LocalAddr().String(),
+		Timeout:       10 * time.Second,
+		Retries:       2,
+		UserName:      "MyName",
+		SecurityLevel: snmpgo.NoAuthNoPriv,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err = snmp.OpenContext(ctx)
+	elapsed := time.Since(start)
+	if err != context.Canceled {
+		t.Errorf("OpenContext() - expected [%v], actual [%v]", context.Canceled, err)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("OpenContext() - returned after %v", elapsed)
+	}
+
+	// the deadline of the ctx shortens the Timeout
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	err = snmp.OpenContext(ctx)
+	elapsed = time.Since(start)
+	if err != context.DeadlineExceeded {
+		t.Errorf("OpenContext() - expected [%v], actual [%v]", context.DeadlineExceeded, err)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("OpenContext() - returned after %v", elapsed)
+	}
+}
+
+func TestSNMPDiscoveryOid(t *testing.T) {
+	// an agent never responding
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var sent [][]byte
+	args := snmpgo.SNMPArguments{
+		Version:      snmpgo.V3,
+		Address:      conn.LocalAddr().String(),
+		Network:      "udp4",
+		Timeout:      50 * time.Millisecond,
+		UserName:     "MyName",
+		DiscoveryOid: "1.3.6.1.2.1.1.2.0",
+		OnWire: func(dir snmpgo.Direction, b []byte) {
+			if dir == snmpgo.Outbound {
+				sent = append(sent, append([]byte(nil), b...))
+			}
+		},
+	}
+	snmp, err := snmpgo.NewSNMP(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	if err = snmp.Open(); err == nil {
+		t.Fatal("Open() - discovered the engine of no agent")
+	}
+	if len(sent) == 0 {
+		t.Fatal("Open() - no discovery is sent")
+	}
+	pdu, err := snmpgo.DecodeMessage(snmpgo.V3, sent[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := snmpgo.MustNewOid(args.DiscoveryOid)
+	if varBinds := pdu.VarBinds(); len(varBinds) != 1 || !varBinds[0].Oid.Equal(exp) {
+		t.Errorf("Discover() - expected [%s], actual %v", exp, varBinds)
+	}
+
+	args.DiscoveryOid = "1.3.6.x"
+	if _, err = snmpgo.NewSNMP(args); err == nil {
+		t.Error("NewSNMP() - invalid DiscoveryOid")
+	}
+}
+
+func TestNewSNMPWithConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	args := snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Timeout:   time.Second,
+		Community: "public",
+	}
+	go func() {
+		buf := make([]byte, 2048)
+		n, err := server.Read(buf)
+		if err != nil {
+			return
+		}
+		req, err := snmpgo.DecodeMessage(args.Version, buf[:n],
+			&snmpgo.SecurityEntry{Version: args.Version, Community: args.Community})
+		if err != nil {
+			return
+		}
+		res := snmpgo.NewPduWithVarBinds(args.Version, snmpgo.GetResponse, snmpgo.VarBinds{
+			snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+		})
+		res.SetRequestId(req.RequestId())
+		b, err := snmpgo.EncodeMessage(&args, res)
+		if err != nil {
+			return
+		}
+		server.Write(b)
+	}()
+
+	snmp, err := snmpgo.NewSNMPWithConn(args, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	pdu, err := snmp.GetRequest(snmpgo.Oids{snmpgo.OidSysUpTime})
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if varBind := pdu.VarBinds().MatchOid(snmpgo.OidSysUpTime); varBind == nil ||
+		varBind.Variable.String() != "0:00:01.00" {
+		t.Errorf("GetRequest() - expected sysUpTime, actual %v", pdu)
+	}
+
+	if _, err = snmpgo.NewSNMPWithConn(args, nil); err == nil {
+		t.Error("NewSNMPWithConn() - no connection")
+	}
+}
+
+type closeErrorConn struct {
+	net.Conn
+}
+
+func (c *closeErrorConn) Close() error {
+	c.Conn.Close()
+	return fmt.Errorf("close error")
+}
+
+// brokenConn closes the connection after reading the first response
+type brokenConn struct {
+	net.Conn
+	reads int
+}
+
+func (c *brokenConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if c.reads++; c.reads == 1 {
+		c.Conn.Close()
+	}
+	return n, err
+}
+
+func TestSNMPReconnectOnError(t *testing.T) {
+	mib := newMockTable("1.3.6.1.2.1.2.2.1", 1, 6)
+	agent := snmptest.NewAgentWithHandler(t, "public", snmptest.MibHandler(mib))
+	defer agent.Close()
+
+	oids := snmpgo.Oids{snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1")}
+	for _, reconnect := range []bool{false, true} {
+		conn, err := net.Dial("udp4", agent.Address())
+		if err != nil {
+			t.Fatal(err)
+		}
+		snmp, err := snmpgo.NewSNMPWithConn(snmpgo.SNMPArguments{
+			Version:          snmpgo.V2c,
+			Address:          agent.Address(),
+			Network:          "udp4",
+			Timeout:          200 * time.Millisecond,
+			Community:        "public",
+			ReconnectOnError: reconnect,
+		}, &brokenConn{Conn: conn})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pdu, err := snmp.GetBulkWalk(oids, 0, 2)
+		snmp.Close()
+		if !reconnect {
+			if err == nil {
+				t.Error("GetBulkWalk() - expected the error of the closed connection")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("GetBulkWalk() - has error %v", err)
+		}
+		if varBinds := pdu.VarBinds(); len(varBinds) != 6 {
+			t.Errorf("GetBulkWalk() - expected 6 varbinds, actual %v", varBinds)
+		}
+	}
+}
+
+func TestSNMPClose(t *testing.T) {
+	agent := snmptest.NewAgentWithHandler(t, "public", snmptest.MibHandler(nil))
+	defer agent.Close()
+
+	snmp := newMockSNMP(t, agent)
+	if err := snmp.Close(); err != nil {
+		t.Errorf("Close() - not opened, has error %v", err)
+	}
+	if err := snmp.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := snmp.Close(); err != nil {
+		t.Errorf("Close() - has error %v", err)
+	}
+	if err := snmp.Close(); err != nil {
+		t.Errorf("Close() - closed twice, has error %v", err)
+	}
+
+	client, server := net.Pipe()
+	defer server.Close()
+	snmp, err := snmpgo.NewSNMPWithConn(snmpgo.SNMPArguments{Version: snmpgo.V2c, Community: "public"},
+		&closeErrorConn{client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = snmp.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err = snmp.Close(); err == nil {
+		t.Error("Close() - expected the error of the connection")
+	}
+	if err = snmp.Close(); err != nil {
+		t.Errorf("Close() - closed twice, has error %v", err)
+	}
+}
+
+func TestSNMPErrorsAs(t *testing.T) {
+	// an agent that never responds
+	agent := snmptest.NewAgentWithHandler(t, "public", func(req snmpgo.Pdu) snmpgo.Pdu { return nil })
+	defer agent.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:     snmpgo.V2c,
+		Address:     agent.Address(),
+		Network:     "udp4",
+		PingTimeout: 100 * time.Millisecond,
+		Community:   "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	err = snmp.Ping()
+	var unreachable *snmpgo.UnreachableError
+	if !errors.As(err, &unreachable) {
+		t.Errorf("Ping() - expected UnreachableError, actual %v", err)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Ping() - expected the timeout to be detectable, actual %v", err)
+	}
+
+	msgErr := &snmpgo.MessageError{Message: "Failed", Cause: err}
+	if !errors.As(msgErr, &netErr) || !netErr.Timeout() {
+		t.Errorf("MessageError - expected the timeout to be detectable, actual %v", msgErr)
+	}
+	parseErr := &snmpgo.OidParseError{Cause: msgErr}
+	if !errors.Is(parseErr, msgErr) {
+		t.Errorf("OidParseError - expected the cause to be detectable, actual %v", parseErr)
+	}
+
+	t.Run("DialTimeout", func(t *testing.T) {
+		// TEST-NET-1 address, which is not routed
+		snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+			Version:   snmpgo.V2c,
+			Network:   "tcp4",
+			Address:   "192.0.2.1:161",
+			Timeout:   100 * time.Millisecond,
+			Community: "public",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = snmp.Open(); err == nil {
+			snmp.Close()
+			t.Fatal("Open() - connected to the blackholed address")
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENETUNREACH) ||
+			errors.Is(err, syscall.EHOSTUNREACH) {
+			t.Skipf("Open() - the address is rejected by the network: %v", err)
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Errorf("Open() - expected the dial timeout to be detectable, actual %v", err)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package snmpgo
 
 import (
+	"strings"
 	"time"
 )
 
@@ -25,6 +26,54 @@ func (s SNMPVersion) String() string {
 	}
 }
 
+// MarshalText returns the version as "v1", "v2c" or "v3"
+func (s SNMPVersion) MarshalText() ([]byte, error) {
+	switch s {
+	case V1, V2c, V3:
+		return []byte("v" + s.String()), nil
+	default:
+		return nil, &ArgumentError{Value: s, Message: "Unknown SNMP Version"}
+	}
+}
+
+// UnmarshalText parses the version case-insensitively, the "v" prefix is optional
+func (s *SNMPVersion) UnmarshalText(text []byte) error {
+	name := strings.TrimPrefix(strings.ToLower(string(text)), "v")
+	for _, v := range []SNMPVersion{V1, V2c, V3} {
+		if name == strings.ToLower(v.String()) {
+			*s = v
+			return nil
+		}
+	}
+	return &ArgumentError{Value: string(text), Message: "Unknown SNMP Version"}
+}
+
+// ParseSNMPVersion returns the SNMPVersion named by s (e.g. "v2c" or "2c"), case-insensitively
+func ParseSNMPVersion(s string) (SNMPVersion, error) {
+	var v SNMPVersion
+	err := v.UnmarshalText([]byte(s))
+	return v, err
+}
+
+// Direction of a message on the wire
+type Direction int
+
+const (
+	Outbound Direction = iota
+	Inbound
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Outbound:
+		return "Outbound"
+	case Inbound:
+		return "Inbound"
+	default:
+		return "Unknown"
+	}
+}
+
 type PduType int
 
 const (
@@ -136,6 +185,11 @@ func (e ErrorStatus) String() string {
 	}
 }
 
+// IsError returns true if the status is not the NoError
+func (e ErrorStatus) IsError() bool {
+	return e != NoError
+}
+
 type SecurityLevel int
 
 const (
@@ -157,6 +211,35 @@ func (s SecurityLevel) String() string {
 	}
 }
 
+// MarshalText returns the level as "noAuthNoPriv", "authNoPriv" or "authPriv"
+func (s SecurityLevel) MarshalText() ([]byte, error) {
+	switch s {
+	case NoAuthNoPriv, AuthNoPriv, AuthPriv:
+		name := s.String()
+		return []byte(strings.ToLower(name[:1]) + name[1:]), nil
+	default:
+		return nil, &ArgumentError{Value: s, Message: "Illegal SecurityLevel"}
+	}
+}
+
+// UnmarshalText parses the level case-insensitively
+func (s *SecurityLevel) UnmarshalText(text []byte) error {
+	for _, l := range []SecurityLevel{NoAuthNoPriv, AuthNoPriv, AuthPriv} {
+		if strings.EqualFold(string(text), l.String()) {
+			*s = l
+			return nil
+		}
+	}
+	return &ArgumentError{Value: string(text), Message: "Illegal SecurityLevel"}
+}
+
+// ParseSecurityLevel returns the SecurityLevel named by s (e.g. "authPriv"), case-insensitively
+func ParseSecurityLevel(s string) (SecurityLevel, error) {
+	var l SecurityLevel
+	err := l.UnmarshalText([]byte(s))
+	return l, err
+}
+
 type AuthProtocol string
 
 const (
@@ -164,6 +247,39 @@ const (
 	Sha AuthProtocol = "SHA"
 )
 
+func (a AuthProtocol) String() string {
+	return string(a)
+}
+
+// MarshalText returns the protocol as "MD5" or "SHA", or empty if not specified
+func (a AuthProtocol) MarshalText() ([]byte, error) {
+	switch a {
+	case "", Md5, Sha:
+		return []byte(a), nil
+	default:
+		return nil, &ArgumentError{Value: a, Message: "Illegal AuthProtocol"}
+	}
+}
+
+// UnmarshalText parses the protocol case-insensitively
+func (a *AuthProtocol) UnmarshalText(text []byte) error {
+	for _, p := range []AuthProtocol{"", Md5, Sha} {
+		if strings.EqualFold(string(text), string(p)) {
+			*a = p
+			return nil
+		}
+	}
+	return &ArgumentError{Value: string(text), Message: "Illegal AuthProtocol"}
+}
+
+// ParseAuthProtocol returns the AuthProtocol named by s (e.g. "sha"), case-insensitively.
+// An empty string is parsed as not specified.
+func ParseAuthProtocol(s string) (AuthProtocol, error) {
+	var a AuthProtocol
+	err := a.UnmarshalText([]byte(s))
+	return a, err
+}
+
 type PrivProtocol string
 
 const (
@@ -171,6 +287,39 @@ const (
 	Aes PrivProtocol = "AES"
 )
 
+func (p PrivProtocol) String() string {
+	return string(p)
+}
+
+// MarshalText returns the protocol as "DES" or "AES", or empty if not specified
+func (p PrivProtocol) MarshalText() ([]byte, error) {
+	switch p {
+	case "", Des, Aes:
+		return []byte(p), nil
+	default:
+		return nil, &ArgumentError{Value: p, Message: "Illegal PrivProtocol"}
+	}
+}
+
+// UnmarshalText parses the protocol case-insensitively
+func (p *PrivProtocol) UnmarshalText(text []byte) error {
+	for _, q := range []PrivProtocol{"", Des, Aes} {
+		if strings.EqualFold(string(text), string(q)) {
+			*p = q
+			return nil
+		}
+	}
+	return &ArgumentError{Value: string(text), Message: "Illegal PrivProtocol"}
+}
+
+// ParsePrivProtocol returns the PrivProtocol named by s (e.g. "aes"), case-insensitively.
+// An empty string is parsed as not specified.
+func ParsePrivProtocol(s string) (PrivProtocol, error) {
+	var p PrivProtocol
+	err := p.UnmarshalText([]byte(s))
+	return p, err
+}
+
 type securityModel int
 
 const (
@@ -194,12 +343,17 @@ func (s securityModel) String() string {
 }
 
 const (
-	timeoutDefault = 5 * time.Second
-	recvBufferSize = 1 << 11
-	msgSizeDefault = 1400
-	msgSizeMinimum = 484
-	tagMask        = 0x1f
-	mega           = 1 << 20
+	timeoutDefault        = 5 * time.Second
+	pingTimeoutDefault    = 1 * time.Second
+	recvBufferSize        = 1 << 11
+	msgSizeDefault        = 1400
+	msgSizeMinimum        = 484
+	maxRepetitionsDefault = 10
+	bulkOverheadSize      = 128 // headers of a GetBulkRequest response, enough for SNMP V3
+	maxVarBindsDefault    = 10000
+	retriesMaximum        = 10
+	tagMask               = 0x1f
+	mega                  = 1 << 20
 )
 
 // ASN.1 Class
@@ -223,8 +377,8 @@ const (
 	tagTimeTicks        = 0x43
 	tagOpaque           = 0x44
 	tagCounter64        = 0x46
-	tagNoSucheObject    = 0x80
-	tagNoSucheInstance  = 0x81
+	tagNoSuchObject     = 0x80
+	tagNoSuchInstance   = 0x81
 	tagEndOfMibView     = 0x82
 )
 
@@ -280,4 +434,17 @@ var (
 	OidSysUpTime          = MustNewOid("1.3.6.1.2.1.1.3.0")
 	OidSnmpTrap           = MustNewOid("1.3.6.1.6.3.1.1.4.1.0")
 	OidSnmpTrapEnterprise = MustNewOid("1.3.6.1.6.3.1.1.4.3.0")
+
+	// RFC 3418 Section 2, RFC 2863 Section 6
+	oidSnmpTraps             = MustNewOid("1.3.6.1.6.3.1.1.5")
+	OidColdStart             = MustNewOid("1.3.6.1.6.3.1.1.5.1")
+	OidWarmStart             = MustNewOid("1.3.6.1.6.3.1.1.5.2")
+	OidLinkDown              = MustNewOid("1.3.6.1.6.3.1.1.5.3")
+	OidLinkUp                = MustNewOid("1.3.6.1.6.3.1.1.5.4")
+	OidAuthenticationFailure = MustNewOid("1.3.6.1.6.3.1.1.5.5")
+
+	// RFC 2863 Section 6
+	OidIfIndex       = MustNewOid("1.3.6.1.2.1.2.2.1.1")
+	OidIfAdminStatus = MustNewOid("1.3.6.1.2.1.2.2.1.7")
+	OidIfOperStatus  = MustNewOid("1.3.6.1.2.1.2.2.1.8")
 )
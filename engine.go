@@ -1,6 +1,7 @@
 package snmpgo
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"time"
@@ -11,14 +12,22 @@ type snmpEngine struct {
 	sec security
 }
 
-func (e *snmpEngine) SendPdu(pdu Pdu, conn net.Conn, args *SNMPArguments) (result Pdu, err error) {
+func (e *snmpEngine) SendPdu(ctx context.Context, pdu Pdu, conn net.Conn, args *SNMPArguments,
+	opts sendOptions, stats *RequestStats) (result Pdu, src net.Addr, err error) {
+
 	size := args.MessageMaxSize
 	if size < recvBufferSize {
 		size = recvBufferSize
 	}
 
+	sec := e.sec
+	if opts.community != nil {
+		// the shared security is not changed by the community of the request
+		sec = &community{Community: opts.community}
+	}
+
 	var sendMsg message
-	sendMsg, err = e.mp.PrepareOutgoingMessage(e.sec, pdu, args)
+	sendMsg, err = e.mp.PrepareOutgoingMessage(sec, pdu, args)
 	if err != nil {
 		return
 	}
@@ -28,31 +37,68 @@ func (e *snmpEngine) SendPdu(pdu Pdu, conn net.Conn, args *SNMPArguments) (resul
 	if err != nil {
 		return
 	}
+	if l := len(buf); l > args.MessageMaxSize {
+		err = &ArgumentError{
+			Value: l,
+			Message: fmt.Sprintf("Message size exceeds MessageMaxSize(%d) by %d bytes "+
+				"with %d VarBinds, send fewer VarBinds per request or increase MessageMaxSize",
+				args.MessageMaxSize, l-args.MessageMaxSize, len(pdu.VarBinds())),
+		}
+		return
+	}
+	args.onWire(Outbound, buf)
 
-	if err = conn.SetDeadline(time.Now().Add(args.Timeout)); err != nil {
+	deadline := time.Now().Add(opts.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err = conn.SetDeadline(deadline); err != nil {
+		return
+	}
+	// checked after setting the deadline, which is not shortened on the later cancel
+	if err = ctx.Err(); err != nil {
 		return
 	}
-	_, err = conn.Write(buf)
+	n, err := conn.Write(buf)
+	stats.BytesSent += n
 	if !confirmedType(pdu.PduType()) || err != nil {
 		return
 	}
 
 	buf = make([]byte, size)
-	_, err = conn.Read(buf)
-	if err != nil {
-		return
-	}
+	for {
+		if pc, ok := conn.(net.PacketConn); ok {
+			n, src, err = pc.ReadFrom(buf)
+		} else {
+			n, err = conn.Read(buf)
+			src = conn.RemoteAddr()
+		}
+		stats.BytesReceived += n
+		if err != nil {
+			return
+		}
+		args.onWire(Inbound, buf[:n])
 
-	var recvMsg message
-	if recvMsg, _, err = unmarshalMessage(buf); err != nil {
-		return nil, &MessageError{
-			Cause:   err,
-			Message: "Failed to Unmarshal message",
-			Detail:  fmt.Sprintf("message Bytes - [%s]", toHexStr(buf, " ")),
+		var recvMsg message
+		if recvMsg, _, err = unmarshalMessage(buf); err != nil {
+			return nil, nil, &MessageError{
+				Cause:   err,
+				Message: "Failed to Unmarshal message",
+				Detail:  fmt.Sprintf("message Bytes - [%s]", toHexStr(buf, " ")),
+			}
 		}
-	}
 
-	result, err = e.mp.PrepareDataElements(e.sec, recvMsg, sendMsg)
+		limitVarBinds(recvMsg.Pdu(), args.MaxVarBinds)
+		result, err = e.mp.PrepareDataElements(sec, recvMsg, sendMsg)
+		// the late response to the previous request is discarded,
+		// and waits for the response to this request until the deadline
+		if _, ok := err.(*unmatchedMessageError); !ok {
+			break
+		}
+	}
+	if result != nil {
+		stats.responseSize = n
+	}
 	if result != nil && len(pdu.VarBinds()) > 0 {
 		if err = e.checkPdu(result, args); err != nil {
 			result = nil
@@ -64,7 +110,7 @@ func (e *snmpEngine) SendPdu(pdu Pdu, conn net.Conn, args *SNMPArguments) (resul
 func (e *snmpEngine) checkPdu(pdu Pdu, args *SNMPArguments) (err error) {
 	varBinds := pdu.VarBinds()
 	if args.Version == V3 && pdu.PduType() == Report && len(varBinds) > 0 {
-		oid := varBinds[0].Oid.String()
+		oid := varBinds[0].Oid.Value.String()
 		rep := reportStatusOid(oid)
 		err = &MessageError{
 			Message: fmt.Sprintf("Received a report from the agent - %s(%s)", rep, oid),
@@ -78,8 +124,8 @@ func (e *snmpEngine) checkPdu(pdu Pdu, args *SNMPArguments) (err error) {
 	return
 }
 
-func (e *snmpEngine) Discover(snmp *SNMP) error {
-	return e.sec.Discover(snmp)
+func (e *snmpEngine) Discover(ctx context.Context, snmp *SNMP) error {
+	return e.sec.Discover(ctx, snmp)
 }
 
 func (e *snmpEngine) String() string {
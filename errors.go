@@ -32,6 +32,63 @@ func (e *MessageError) Error() string {
 	}
 }
 
+// Unwrap returns the Cause for errors.Is and errors.As
+func (e *MessageError) Unwrap() error {
+	return e.Cause
+}
+
+// An UnreachableError suggests that the agent does not respond to Ping,
+// or the port of the agent is unreachable (the ICMP port unreachable is received)
+type UnreachableError struct {
+	Address string // Address of the agent
+	Cause   error  // Cause of the error
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("Agent `%s` is unreachable, cause `%v`", e.Address, e.Cause)
+}
+
+// Unwrap returns the Cause for errors.Is and errors.As
+// (e.g. the net.Error of the timeout)
+func (e *UnreachableError) Unwrap() error {
+	return e.Cause
+}
+
+// An OidParseError suggests that an OID in the list cannot be parsed
+type OidParseError struct {
+	Index int    // 0-based index of the OID string (Index of the line with ParseOids)
+	Value string // OID string that has a problem
+	Cause error  // Cause of the error
+}
+
+func (e *OidParseError) Error() string {
+	return fmt.Sprintf("Failed to parse the OID `%s` at index %d, cause `%v`", e.Value, e.Index, e.Cause)
+}
+
+// Unwrap returns the Cause for errors.Is and errors.As
+func (e *OidParseError) Unwrap() error {
+	return e.Cause
+}
+
+// A PartialPduError suggests that the received Pdu was decoded only partially,
+// the Pdu holds the fields and the VarBinds decoded before the failure
+type PartialPduError struct {
+	MessageError
+	Pdu Pdu // Partially decoded Pdu
+}
+
 type notInTimeWindowError struct {
 	error
 }
+
+// A walkLoopError suggests that a walked subtree is ended since the OIDs do not increase,
+// the walked VarBinds are returned with the wrapped error
+type walkLoopError struct {
+	error
+}
+
+// An unmatchedMessageError suggests that the received message is not the response
+// to the request (e.g. the late response to the previous request)
+type unmatchedMessageError struct {
+	error
+}
@@ -5,18 +5,26 @@ import (
 )
 
 var StripHexPrefix = stripHexPrefix
+var EngineIdToBytes = engineIdToBytes
 var ToHexStr = toHexStr
 var Retry = retry
 var GenRequestId = genRequestId
 var GenSalt32 = genSalt32
 var GenSalt64 = genSalt64
 var GenMessageId = genMessageId
+var MaxVarBindsDefault = maxVarBindsDefault
 var NewNotInTimeWindowError = func() error { return &notInTimeWindowError{&MessageError{}} }
 
 // For snmpgo testing
 var NewSNMPEngine = newSNMPEngine
 
 func ArgsValidate(args *SNMPArguments) error { return args.validate() }
+func ArgsAuthEngine(args *SNMPArguments) (int, int) {
+	return args.authEngineBoots, args.authEngineTime
+}
+func SetArgsAuthEngine(args *SNMPArguments, boots, eTime int) {
+	args.authEngineBoots, args.authEngineTime = boots, eTime
+}
 func CheckPdu(engine *snmpEngine, pdu Pdu, args *SNMPArguments) error {
 	return engine.checkPdu(pdu, args)
 }
@@ -34,19 +42,31 @@ func ToUsm(sec security) *usm            { return sec.(*usm) }
 // For security testing
 var NewSecurity = newSecurity
 var PasswordToKey = passwordToKey
+var KeyChangeWithRandom = keyChange
 var EncryptDES = encryptDES
 var EncryptAES = encryptAES
 var DecryptDES = decryptDES
 var DecryptAES = decryptAES
 var NewSecurityMap = newSecurityMap
 
+func SetUsmClock(u *usm, now func() time.Time) { u.now = now }
+func SetUsmRemoteReference(u *usm)             { u.DiscoveryStatus = remoteReference }
+
 func NewCommunity() *community { return &community{} }
 func NewUsm() *usm             { return &usm{} }
 
 // For server
 func ListeningUDPAddress(s *TrapServer) string {
+	return listeningAddress(s.transport)
+}
+
+func ListeningAgentAddress(a *Agent) string {
+	return listeningAddress(a.transport)
+}
+
+func listeningAddress(t transport) string {
 	for i := 0; i < 12; i++ {
-		if conn := s.transport.(*packetTransport).conn; conn != nil {
+		if conn := t.(*packetTransport).conn; conn != nil {
 			return conn.LocalAddr().String()
 		}
 		// XXX Wait until a connection is available, but this code is a kludge
@@ -1,6 +1,22 @@
 package snmpgo
 
+import (
+	"net"
+	"runtime"
+)
+
 type StdLogger interface {
 	Print(v ...interface{})
 	Printf(format string, v ...interface{})
 }
+
+// recoverPanic recovers from a panic, and logs it with the stack trace.
+// It must be called directly by defer.
+func recoverPanic(logf func(format string, args ...interface{}), message string, src net.Addr) {
+	if err := recover(); err != nil {
+		const size = 64 << 10
+		logBuf := make([]byte, size)
+		logBuf = logBuf[:runtime.Stack(logBuf, false)]
+		logf("%s %v: %v\n%s", message, src, err, logBuf)
+	}
+}
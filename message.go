@@ -2,7 +2,6 @@ package snmpgo
 
 import (
 	"encoding/asn1"
-	"encoding/hex"
 	"fmt"
 
 	"github.com/geoffgarside/ber"
@@ -42,8 +41,6 @@ func (msg *messageV1) SetPduBytes(b []byte) {
 }
 
 func (msg *messageV1) Marshal() (b []byte, err error) {
-	fmt.Println("Marshal")
-	fmt.Println(hex.Dump(msg.pduBytes))
 	var buf []byte
 	raw := asn1.RawValue{Class: classUniversal, Tag: tagSequence, IsCompound: true}
 
@@ -59,7 +56,6 @@ func (msg *messageV1) Marshal() (b []byte, err error) {
 	}
 	raw.Bytes = append(raw.Bytes, buf...)
 
-	fmt.Println(hex.Dump(msg.pduBytes))
 	raw.Bytes = append(raw.Bytes, msg.pduBytes...)
 	return asn1.Marshal(raw)
 }
@@ -353,6 +349,117 @@ func unmarshalMessage(b []byte) (message, []byte, error) {
 	return msg, rest, nil
 }
 
+// DecodeMessage decodes a raw SNMP message of the version (e.g. captured from the network)
+// without a connection, and returns the Pdu.
+// If sec is given, the message is verified (and decrypted with SNMP V3) by it as the receiver,
+// otherwise the Pdu is decoded as it is, which is not possible for an encrypted message.
+// With SNMP V3, the SecurityEngineId of sec defaults to the AuthEngineId of the message,
+// and the time window is not checked.
+func DecodeMessage(version SNMPVersion, b []byte, sec *SecurityEntry) (Pdu, error) {
+	msg, _, err := unmarshalMessage(b)
+	if err != nil {
+		return nil, &MessageError{
+			Cause:   err,
+			Message: "Failed to Unmarshal message",
+			Detail:  fmt.Sprintf("message Bytes - [%s]", toHexStr(b, " ")),
+		}
+	}
+	if msg.Version() != version {
+		return nil, &MessageError{
+			Message: fmt.Sprintf("SNMPVersion mismatch - expected [%v], actual [%v]",
+				version, msg.Version()),
+			Detail: fmt.Sprintf("Message - [%s]", msg),
+		}
+	}
+
+	if sec == nil {
+		if m, ok := msg.(*messageV3); ok && m.Privacy() {
+			return nil, &ArgumentError{
+				Value:   sec,
+				Message: "SecurityEntry is required to decrypt the message",
+			}
+		}
+		if _, err = msg.Pdu().Unmarshal(msg.PduBytes()); err != nil {
+			return nil, &MessageError{
+				Cause:   err,
+				Message: "Failed to Unmarshal Pdu",
+				Detail:  fmt.Sprintf("Pdu Bytes - [%s]", toHexStr(msg.PduBytes(), " ")),
+			}
+		}
+		return msg.Pdu(), nil
+	}
+
+	if sec.Version != version {
+		return nil, &ArgumentError{
+			Value:   sec.Version,
+			Message: fmt.Sprintf("SNMPVersion of SecurityEntry mismatch - expected [%v]", version),
+		}
+	}
+	if err = sec.validate(); err != nil {
+		return nil, err
+	}
+	s := newSecurityFromEntry(sec)
+	if u, ok := s.(*usm); ok {
+		engineId := u.AuthEngineId
+		if len(engineId) == 0 {
+			engineId = msg.(*messageV3).AuthEngineId
+		}
+		// synchronizes with the message instead of checking the time window
+		u.SetAuthEngineId(engineId)
+		u.DiscoveryStatus = noSynchronized
+	}
+	if err = s.ProcessIncomingMessage(msg); err != nil {
+		return nil, err
+	}
+	return msg.Pdu(), nil
+}
+
+// EncodeMessage encodes the Pdu into a raw SNMP message as the sender of the arguments
+// without a connection, the RequestId of the Pdu is kept as it is.
+// With SNMP V3, the SecurityEngineId is required since there is no discovery,
+// and the EngineBoots and EngineTime are used as the ones of the authoritative engine.
+func EncodeMessage(args *SNMPArguments, pdu Pdu) ([]byte, error) {
+	if args == nil {
+		return nil, &ArgumentError{
+			Value:   args,
+			Message: "SNMPArguments is required",
+		}
+	}
+	if pdu == nil {
+		return nil, &ArgumentError{
+			Value:   pdu,
+			Message: "Pdu is required",
+		}
+	}
+
+	a := args.Clone()
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	if a.Version == V3 && a.SecurityEngineId == "" {
+		return nil, &ArgumentError{
+			Value:   a.SecurityEngineId,
+			Message: "SecurityEngineId is required to encode the message",
+		}
+	}
+	a.setDefault()
+	requestId := pdu.RequestId()
+	a.RequestIdGenerator = func() int { return requestId }
+
+	sec := newSecurity(&a)
+	if u, ok := sec.(*usm); ok {
+		engineId, _ := engineIdToBytes(a.SecurityEngineId)
+		u.SetAuthEngineId(engineId)
+		u.SynchronizeEngineBootsTime(int64(a.EngineBoots), int64(a.EngineTime))
+		u.DiscoveryStatus = discovered
+	}
+	msg, err := newMessageProcessing(a.Version).PrepareOutgoingMessage(sec, pdu, &a)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Marshal()
+}
+
 func unmarshalMessageVersion(b []byte) (SNMPVersion, []byte, []byte, error) {
 
 	var raw asn1.RawValue
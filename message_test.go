@@ -242,3 +242,145 @@ func TestUnmarshalMessageV1BERLargeObjectIdentifier(t *testing.T) {
 		t.Errorf("unmarshalMessage() - message is not messageV1")
 	}
 }
+
+func TestDecodeMessage(t *testing.T) {
+	v2c := []byte{
+		0x30, 0x1d, 0x02, 0x01, 0x01, 0x04, 0x0b, 0x4d, 0x79, 0x43, 0x6f,
+		0x6d, 0x6d, 0x75, 0x6e, 0x69, 0x74, 0x79, 0xa2, 0x0b, 0x02, 0x01,
+		0x7b, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00, 0x30, 0x00,
+	}
+
+	pdu, err := snmpgo.DecodeMessage(snmpgo.V2c, v2c, nil)
+	if err != nil {
+		t.Fatalf("DecodeMessage() : %v", err)
+	}
+	if pdu.PduType() != snmpgo.GetResponse || pdu.RequestId() != 123 {
+		t.Errorf("DecodeMessage() - unexpected pdu [%s]", pdu)
+	}
+
+	sec := &snmpgo.SecurityEntry{Version: snmpgo.V2c, Community: "MyCommunity"}
+	if _, err = snmpgo.DecodeMessage(snmpgo.V2c, v2c, sec); err != nil {
+		t.Errorf("DecodeMessage() with community : %v", err)
+	}
+	sec.Community = "public"
+	if _, err = snmpgo.DecodeMessage(snmpgo.V2c, v2c, sec); err == nil {
+		t.Error("DecodeMessage() with wrong community - no error")
+	}
+	if _, err = snmpgo.DecodeMessage(snmpgo.V3, v2c, nil); err == nil {
+		t.Error("DecodeMessage() with version mismatch - no error")
+	}
+
+	// AuthPriv (SHA/AES) GetResponse, EngineId 8000000004736e6d70676f
+	v3 := []byte{
+		0x30, 0x7d, 0x02, 0x01, 0x03, 0x30, 0x0e, 0x02, 0x02, 0x16, 0x2e,
+		0x02, 0x02, 0x05, 0x78, 0x04, 0x01, 0x03, 0x02, 0x01, 0x03, 0x04,
+		0x36, 0x30, 0x34, 0x04, 0x0b, 0x80, 0x00, 0x00, 0x00, 0x04, 0x73,
+		0x6e, 0x6d, 0x70, 0x67, 0x6f, 0x02, 0x01, 0x03, 0x02, 0x02, 0x03,
+		0xe8, 0x04, 0x06, 0x4d, 0x79, 0x4e, 0x61, 0x6d, 0x65, 0x04, 0x0c,
+		0x1f, 0xb6, 0x14, 0x51, 0xaa, 0xe3, 0xbf, 0x02, 0x61, 0x3b, 0xc1,
+		0x29, 0x04, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x04, 0x30, 0x3c, 0x57, 0x05, 0xb8, 0x12, 0x56, 0x13, 0xcc, 0xfb,
+		0x27, 0x29, 0x52, 0x6b, 0xd6, 0x2f, 0xdd, 0xa8, 0x3d, 0x8b, 0x22,
+		0xa6, 0x07, 0xf6, 0x5c, 0x80, 0x0b, 0xc2, 0xec, 0x17, 0x60, 0xb7,
+		0xc5, 0x19, 0x7e, 0x09, 0x5b, 0x54, 0x0b, 0x68, 0x56, 0x9f, 0x23,
+		0x12, 0x0a, 0x8f, 0x56, 0x38, 0xa7,
+	}
+	sec = &snmpgo.SecurityEntry{
+		Version:       snmpgo.V3,
+		UserName:      "MyName",
+		SecurityLevel: snmpgo.AuthPriv,
+		AuthPassword:  "aaaaaaaa",
+		AuthProtocol:  snmpgo.Sha,
+		PrivPassword:  "bbbbbbbb",
+		PrivProtocol:  snmpgo.Aes,
+	}
+
+	pdu, err = snmpgo.DecodeMessage(snmpgo.V3, v3, sec)
+	if err != nil {
+		t.Fatalf("DecodeMessage() : %v", err)
+	}
+	if pdu.PduType() != snmpgo.GetResponse || pdu.RequestId() != 1234 {
+		t.Errorf("DecodeMessage() - unexpected pdu [%s]", pdu)
+	}
+	vbs := pdu.VarBinds()
+	if len(vbs) != 1 || !vbs[0].Oid.Equal(snmpgo.OidSysUpTime) || vbs[0].Variable.(*snmpgo.TimeTicks).Value != 12345 {
+		t.Errorf("DecodeMessage() - unexpected varbinds [%s]", vbs)
+	}
+
+	if _, err = snmpgo.DecodeMessage(snmpgo.V3, v3, nil); err == nil {
+		t.Error("DecodeMessage() without SecurityEntry - no error")
+	}
+	sec.PrivPassword = "cccccccc"
+	if _, err = snmpgo.DecodeMessage(snmpgo.V3, v3, sec); err == nil {
+		t.Error("DecodeMessage() with wrong password - no error")
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	varBinds := snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(12345)),
+		snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.NewOctetString([]byte("MyHost"))),
+	}
+	tests := []struct {
+		args *snmpgo.SNMPArguments
+		sec  *snmpgo.SecurityEntry
+	}{
+		{
+			args: &snmpgo.SNMPArguments{Version: snmpgo.V2c, Community: "public"},
+			sec:  &snmpgo.SecurityEntry{Version: snmpgo.V2c, Community: "public"},
+		},
+		{
+			args: &snmpgo.SNMPArguments{
+				Version:          snmpgo.V3,
+				UserName:         "MyName",
+				SecurityLevel:    snmpgo.AuthPriv,
+				AuthPassword:     "aaaaaaaa",
+				AuthProtocol:     snmpgo.Sha,
+				PrivPassword:     "bbbbbbbb",
+				PrivProtocol:     snmpgo.Aes,
+				SecurityEngineId: "8000000004736e6d70676f",
+				EngineBoots:      3,
+				EngineTime:       1000,
+			},
+			sec: &snmpgo.SecurityEntry{
+				Version:       snmpgo.V3,
+				UserName:      "MyName",
+				SecurityLevel: snmpgo.AuthPriv,
+				AuthPassword:  "aaaaaaaa",
+				AuthProtocol:  snmpgo.Sha,
+				PrivPassword:  "bbbbbbbb",
+				PrivProtocol:  snmpgo.Aes,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		pdu := snmpgo.NewPduWithVarBinds(test.args.Version, snmpgo.GetResponse, varBinds)
+		pdu.SetRequestId(1234)
+
+		b, err := snmpgo.EncodeMessage(test.args, pdu)
+		if err != nil {
+			t.Fatalf("EncodeMessage() - %v : %v", test.args.Version, err)
+		}
+		decoded, err := snmpgo.DecodeMessage(test.args.Version, b, test.sec)
+		if err != nil {
+			t.Fatalf("DecodeMessage() - %v : %v", test.args.Version, err)
+		}
+		if decoded.PduType() != snmpgo.GetResponse || decoded.RequestId() != 1234 {
+			t.Errorf("round trip - %v, unexpected pdu [%s]", test.args.Version, decoded)
+		}
+		if decoded.VarBinds().String() != varBinds.String() {
+			t.Errorf("round trip - %v, expected [%s], actual [%s]",
+				test.args.Version, varBinds, decoded.VarBinds())
+		}
+	}
+
+	args := &snmpgo.SNMPArguments{Version: snmpgo.V3, UserName: "MyName"}
+	if _, err := snmpgo.EncodeMessage(args, snmpgo.NewPdu(snmpgo.V3, snmpgo.GetRequest)); err == nil {
+		t.Error("EncodeMessage() without SecurityEngineId - no error")
+	}
+	args = &snmpgo.SNMPArguments{Version: snmpgo.V2c, Community: "public"}
+	if _, err := snmpgo.EncodeMessage(args, snmpgo.NewPdu(snmpgo.V3, snmpgo.GetRequest)); err == nil {
+		t.Error("EncodeMessage() with version mismatch - no error")
+	}
+}
@@ -30,7 +30,7 @@ func (mp *messageProcessingV1) PrepareOutgoingMessage(
 			Message: "Type of Pdu is not PduV1",
 		}
 	}
-	pdu.SetRequestId(genRequestId())
+	pdu.SetRequestId(args.requestId())
 	msg := newMessageWithPdu(mp.Version(), pdu)
 
 	if err := sec.GenerateRequestMessage(msg); err != nil {
@@ -83,11 +83,11 @@ func (mp *messageProcessingV1) PrepareDataElements(
 			}
 		}
 		if sendMsg.Pdu().RequestId() != pdu.RequestId() {
-			return nil, &MessageError{
+			return nil, &unmatchedMessageError{&MessageError{
 				Message: fmt.Sprintf("RequestId mismatch - expected [%d], actual [%d]",
 					sendMsg.Pdu().RequestId(), pdu.RequestId()),
 				Detail: fmt.Sprintf("%s vs %s", sendMsg, recvMsg),
-			}
+			}}
 		}
 	} else {
 		if t := pdu.PduType(); !confirmedType(t) && t != SNMPTrapV2 {
@@ -118,13 +118,14 @@ func (mp *messageProcessingV3) PrepareOutgoingMessage(
 			Message: "Type of Pdu is not ScopedPdu",
 		}
 	}
-	p.SetRequestId(genRequestId())
+	p.SetRequestId(args.requestId())
 	if args.ContextEngineId != "" {
 		p.ContextEngineId, _ = engineIdToBytes(args.ContextEngineId)
 	} else {
 		p.ContextEngineId = sec.(*usm).AuthEngineId
 	}
-	if args.ContextName != "" {
+	// the ContextName set on the pdu is kept
+	if len(p.ContextName) == 0 && args.ContextName != "" {
 		p.ContextName = []byte(args.ContextName)
 	}
 
@@ -154,8 +155,38 @@ func (mp *messageProcessingV3) PrepareOutgoingMessage(
 func (mp *messageProcessingV3) PrepareResponseMessage(
 	sec security, pdu Pdu, recvMsg message) (message, error) {
 
-	// TODO support for response message of v3
-	return nil, nil
+	p, ok := pdu.(*ScopedPdu)
+	if !ok {
+		return nil, &ArgumentError{
+			Value:   pdu,
+			Message: "Type of Pdu is not ScopedPdu",
+		}
+	}
+	rm := recvMsg.(*messageV3)
+	if rp, ok := rm.Pdu().(*ScopedPdu); ok {
+		p.SetRequestId(rp.RequestId())
+		p.ContextEngineId = rp.ContextEngineId
+		p.ContextName = rp.ContextName
+	}
+
+	msg := newMessageWithPdu(mp.Version(), pdu)
+	m := msg.(*messageV3)
+	m.MessageId = rm.MessageId
+	m.MessageMaxSize = msgSizeDefault
+	m.SecurityModel = securityUsm
+	// RFC3412 Section 7.1 3) uses the security level of the received message,
+	// but the report is not encrypted (RFC3414 Section 3.2 7) a))
+	if u, ok := sec.(*usm); ok && rm.Authentication() && len(u.AuthKey) > 0 {
+		m.SetAuthentication(true)
+		if rm.Privacy() && pdu.PduType() != Report {
+			m.SetPrivacy(true)
+		}
+	}
+
+	if err := sec.GenerateResponseMessage(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
 }
 
 func (mp *messageProcessingV3) PrepareDataElements(
@@ -173,12 +204,12 @@ func (mp *messageProcessingV3) PrepareDataElements(
 			}
 		}
 		if sm.MessageId != rm.MessageId {
-			return nil, &MessageError{
+			return nil, &unmatchedMessageError{&MessageError{
 				Message: fmt.Sprintf(
 					"MessageId mismatch - expected [%d], actual [%d]",
 					sm.MessageId, rm.MessageId),
 				Detail: fmt.Sprintf("%s vs %s", sm, rm),
-			}
+			}}
 		}
 	}
 	if rm.SecurityModel != securityUsm {
@@ -196,11 +227,11 @@ func (mp *messageProcessingV3) PrepareDataElements(
 		switch t := pdu.PduType(); t {
 		case GetResponse:
 			if sm.Pdu().RequestId() != pdu.RequestId() {
-				return nil, &MessageError{
+				return nil, &unmatchedMessageError{&MessageError{
 					Message: fmt.Sprintf("RequestId mismatch - expected [%d], actual [%d]",
 						sm.Pdu().RequestId(), pdu.RequestId()),
 					Detail: fmt.Sprintf("%s vs %s", sm, rm),
-				}
+				}}
 			}
 
 			sPdu := sm.Pdu().(*ScopedPdu)
@@ -221,7 +221,7 @@ func TestMessageProcessingV3Receive(t *testing.T) {
 	sec := snmpgo.NewSecurity(args)
 	usm := snmpgo.ToUsm(sec)
 	usm.SetAuthEngineId(secEngId)
-	usm.DiscoveryStatus = 3 // remoteReference
+	snmpgo.SetUsmRemoteReference(usm)
 
 	pdu := snmpgo.NewPdu(snmpgo.V3, snmpgo.GetResponse)
 	pduBytes, _ := pdu.Marshal()
@@ -247,3 +247,49 @@ func TestMessageProcessingV3Receive(t *testing.T) {
 		t.Errorf("PrepareDataElements() - has error %v", err)
 	}
 }
+
+func TestMessageProcessingRequestIdGenerator(t *testing.T) {
+	next := 100
+	gen := func() int {
+		next++
+		return next
+	}
+
+	args := &snmpgo.SNMPArguments{
+		Version:            snmpgo.V2c,
+		Community:          "public",
+		RequestIdGenerator: gen,
+	}
+	mp := snmpgo.NewMessageProcessing(args.Version)
+	sec := snmpgo.NewSecurity(args)
+	for _, expId := range []int{101, 102} {
+		pdu := snmpgo.NewPdu(snmpgo.V2c, snmpgo.GetRequest)
+		if _, err := mp.PrepareOutgoingMessage(sec, pdu, args); err != nil {
+			t.Fatalf("PrepareOutgoingMessage() - has error %v", err)
+		}
+		if pdu.RequestId() != expId {
+			t.Errorf("PrepareOutgoingMessage() - request id expected [%d], actual [%d]",
+				expId, pdu.RequestId())
+		}
+	}
+
+	args = &snmpgo.SNMPArguments{
+		Version:            snmpgo.V3,
+		UserName:           "myName",
+		RequestIdGenerator: gen,
+	}
+	mp = snmpgo.NewMessageProcessing(args.Version)
+	sec = snmpgo.NewSecurity(args)
+	pdu := snmpgo.NewPdu(snmpgo.V3, snmpgo.GetRequest)
+	if _, err := mp.PrepareOutgoingMessage(sec, pdu, args); err != nil {
+		t.Fatalf("PrepareOutgoingMessage() - has error %v", err)
+	}
+	if pdu.RequestId() != 103 {
+		t.Errorf("PrepareOutgoingMessage() - request id expected [%d], actual [%d]",
+			103, pdu.RequestId())
+	}
+
+	if args.String() == "" {
+		t.Error("String() - empty with RequestIdGenerator")
+	}
+}
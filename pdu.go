@@ -1,6 +1,7 @@
 package snmpgo
 
 import (
+	"bytes"
 	"encoding/asn1"
 	"fmt"
 	"sort"
@@ -15,7 +16,6 @@ type VarBind struct {
 }
 
 func (v *VarBind) Marshal() (b []byte, err error) {
-	fmt.Println("VarBind Marshal")
 	var buf []byte
 	raw := asn1.RawValue{Class: classUniversal, Tag: tagSequence, IsCompound: true}
 
@@ -109,11 +109,24 @@ func (v VarBinds) MatchBaseOids(prefix *Oid) VarBinds {
 	return result
 }
 
-// Sort a VarBind list by OID
+// Within returns the VarBinds under the base in the order of the list.
+// Unlike MatchBaseOids, the VarBind of the base itself is not included,
+// as the walk of the base does not return it.
+func (v VarBinds) Within(base *Oid) VarBinds {
+	result := make(VarBinds, 0)
+	for _, o := range v {
+		if o.Oid != nil && o.Oid.Contains(base) && !o.Oid.Equal(base) {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+// Sort a VarBind list by OID, the list is copied and not changed
 func (v VarBinds) Sort() VarBinds {
 	c := make(VarBinds, len(v))
 	copy(c, v)
-	sort.Sort(sortableVarBinds{c})
+	sort.Sort(c)
 	return c
 }
 
@@ -142,6 +155,53 @@ func (v VarBinds) Uniq() VarBinds {
 	})
 }
 
+// DiffVarBinds compares the VarBinds by OID, and returns the VarBinds of curr whose OIDs
+// are not in prev, the VarBinds of prev whose OIDs are not in curr,
+// and the VarBinds of curr whose values (type or encoded value) differ from prev.
+// The VarBinds without the OID are ignored.
+func DiffVarBinds(prev, curr VarBinds) (added, removed, changed VarBinds) {
+	prevs := make(map[string]*VarBind, len(prev))
+	for _, v := range prev {
+		if v.Oid != nil {
+			prevs[v.Oid.Value.String()] = v
+		}
+	}
+	currs := make(map[string]bool, len(curr))
+	for _, v := range curr {
+		if v.Oid == nil {
+			continue
+		}
+		key := v.Oid.Value.String()
+		currs[key] = true
+		if p, ok := prevs[key]; !ok {
+			added = append(added, v)
+		} else if !equalVariables(p.Variable, v.Variable) {
+			changed = append(changed, v)
+		}
+	}
+	for _, v := range prev {
+		if v.Oid != nil && !currs[v.Oid.Value.String()] {
+			removed = append(removed, v)
+		}
+	}
+	return
+}
+
+func equalVariables(a, b Variable) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	ab, aerr := a.Marshal()
+	bb, berr := b.Marshal()
+	if aerr != nil || berr != nil {
+		return a.String() == b.String()
+	}
+	return bytes.Equal(ab, bb)
+}
+
 func (v VarBinds) String() string {
 	varBinds := make([]string, len(v))
 	for i, o := range v {
@@ -150,21 +210,25 @@ func (v VarBinds) String() string {
 	return "[" + strings.Join(varBinds, ", ") + "]"
 }
 
-type sortableVarBinds struct {
-	VarBinds
-}
-
-func (v sortableVarBinds) Len() int {
-	return len(v.VarBinds)
+// Len, Swap and Less implement the sort.Interface ordering the VarBinds by OID,
+// the VarBinds without OID are placed at the end
+func (v VarBinds) Len() int {
+	return len(v)
 }
 
-func (v sortableVarBinds) Swap(i, j int) {
-	v.VarBinds[i], v.VarBinds[j] = v.VarBinds[j], v.VarBinds[i]
+func (v VarBinds) Swap(i, j int) {
+	v[i], v[j] = v[j], v[i]
 }
 
-func (v sortableVarBinds) Less(i, j int) bool {
-	t := v.VarBinds[i]
-	return t != nil && t.Oid != nil && t.Oid.Compare(v.VarBinds[j].Oid) < 1
+func (v VarBinds) Less(i, j int) bool {
+	a, b := v[i], v[j]
+	if a == nil || a.Oid == nil {
+		return false
+	}
+	if b == nil || b.Oid == nil {
+		return true
+	}
+	return a.Oid.Compare(b.Oid) < 0
 }
 
 // The protocol data unit of SNMP
@@ -192,6 +256,7 @@ type PduV1 struct {
 	errorStatus ErrorStatus
 	errorIndex  int
 	varBinds    VarBinds
+	maxVarBinds int // limit of the VarBinds to unmarshal, 0 is unlimited
 }
 
 type TrapPduV1 struct {
@@ -250,6 +315,13 @@ func (pdu *PduV1) VarBinds() VarBinds {
 	return pdu.varBinds
 }
 
+// Returns true if this response of GetBulkRequest has fewer VarBinds than
+// requested * maxRepetitions, requested being the number of the requested OIDs.
+// It happens when the agent truncates the response to fit the message size.
+func (pdu *PduV1) IsTruncated(requested, maxRepetitions int) bool {
+	return len(pdu.varBinds) < requested*maxRepetitions
+}
+
 func (pdu *PduV1) Marshal() (b []byte, err error) {
 	var buf []byte
 	raw := asn1.RawValue{Class: classContextSpecific, Tag: int(pdu.pduType), IsCompound: true}
@@ -335,6 +407,9 @@ func (pdu *PduV1) Unmarshal(b []byte) (rest []byte, err error) {
 
 	next = varBinds.Bytes
 	for len(next) > 0 {
+		if err = pdu.checkVarBindsLimit(); err != nil {
+			return
+		}
 		var varBind VarBind
 		next, err = (&varBind).Unmarshal(next)
 		if err != nil {
@@ -350,6 +425,86 @@ func (pdu *PduV1) Unmarshal(b []byte) (rest []byte, err error) {
 	return
 }
 
+// MarshalBinary implements the encoding.BinaryMarshaler interface,
+// the Pdu is encoded in BER without the message wrapper
+func (pdu *PduV1) MarshalBinary() ([]byte, error) {
+	return pdu.Marshal()
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface
+func (pdu *PduV1) UnmarshalBinary(b []byte) error {
+	decoded := PduV1{maxVarBinds: pdu.maxVarBinds}
+	rest, err := (&decoded).Unmarshal(b)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return asn1.SyntaxError{Msg: "trailing data after the Pdu"}
+	}
+	*pdu = decoded
+	return nil
+}
+
+// unmarshalPartial decodes the fields of the Pdu as far as possible,
+// and reports whether the Pdu header is recognized
+func (pdu *PduV1) unmarshalPartial(b []byte) bool {
+	class, tag, compound, next, err := unmarshalHeaderPartial(b)
+	if err != nil || class != classContextSpecific || !compound {
+		return false
+	}
+	pdu.pduType = PduType(tag)
+
+	var requestId int
+	if next, err = ber.Unmarshal(next, &requestId); err != nil {
+		return true
+	}
+	pdu.requestId = requestId
+
+	var errorStatus int
+	if next, err = ber.Unmarshal(next, &errorStatus); err != nil {
+		return true
+	}
+	pdu.errorStatus = ErrorStatus(errorStatus)
+
+	var errorIndex int
+	if next, err = ber.Unmarshal(next, &errorIndex); err != nil {
+		return true
+	}
+	pdu.errorIndex = errorIndex
+
+	class, tag, compound, next, err = unmarshalHeaderPartial(next)
+	if err != nil || class != classUniversal || tag != tagSequence || !compound {
+		return true
+	}
+	for len(next) > 0 && pdu.checkVarBindsLimit() == nil {
+		var varBind VarBind
+		if next, err = (&varBind).Unmarshal(next); err != nil {
+			break
+		}
+		pdu.varBinds = append(pdu.varBinds, &varBind)
+	}
+	return true
+}
+
+// checkVarBindsLimit returns an error if no more VarBinds can be unmarshaled
+func (pdu *PduV1) checkVarBindsLimit() error {
+	if pdu.maxVarBinds > 0 && len(pdu.varBinds) >= pdu.maxVarBinds {
+		return asn1.StructuralError{fmt.Sprintf(
+			"The number of VarBinds exceeds the limit of %d", pdu.maxVarBinds)}
+	}
+	return nil
+}
+
+// limitVarBinds sets the maximum number of VarBinds to unmarshal into the pdu
+func limitVarBinds(pdu Pdu, max int) {
+	switch p := pdu.(type) {
+	case *PduV1:
+		p.maxVarBinds = max
+	case *ScopedPdu:
+		p.maxVarBinds = max
+	}
+}
+
 func (pdu *PduV1) String() string {
 	return fmt.Sprintf(
 		`{"Type": "%s", "RequestId": "%d", "ErrorStatus": "%s", `+
@@ -429,6 +584,50 @@ func (pdu *ScopedPdu) Unmarshal(b []byte) (rest []byte, err error) {
 	return
 }
 
+// MarshalBinary implements the encoding.BinaryMarshaler interface,
+// the ScopedPdu is encoded in BER without the message wrapper
+func (pdu *ScopedPdu) MarshalBinary() ([]byte, error) {
+	return pdu.Marshal()
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface
+func (pdu *ScopedPdu) UnmarshalBinary(b []byte) error {
+	decoded := ScopedPdu{PduV1: PduV1{maxVarBinds: pdu.maxVarBinds}}
+	rest, err := (&decoded).Unmarshal(b)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return asn1.SyntaxError{Msg: "trailing data after the ScopedPdu"}
+	}
+	*pdu = decoded
+	return nil
+}
+
+// unmarshalPartial decodes the fields of the ScopedPdu as far as possible,
+// and reports whether the ScopedPdu header is recognized
+func (pdu *ScopedPdu) unmarshalPartial(b []byte) bool {
+	class, tag, compound, next, err := unmarshalHeaderPartial(b)
+	if err != nil || class != classUniversal || tag != tagSequence || !compound {
+		return false
+	}
+
+	var contextEngineId []byte
+	if next, err = ber.Unmarshal(next, &contextEngineId); err != nil {
+		return true
+	}
+	pdu.ContextEngineId = contextEngineId
+
+	var contextName []byte
+	if next, err = ber.Unmarshal(next, &contextName); err != nil {
+		return true
+	}
+	pdu.ContextName = contextName
+
+	pdu.PduV1.unmarshalPartial(next)
+	return true
+}
+
 func (pdu *ScopedPdu) String() string {
 	return fmt.Sprintf(
 		`{"Type": "%s", "RequestId": "%d", "ErrorStatus": "%s", "ErrorIndex": "%d", `+
@@ -2,6 +2,8 @@ package snmpgo_test
 
 import (
 	"bytes"
+	"encoding"
+	"sort"
 	"testing"
 
 	"github.com/k-sone/snmpgo"
@@ -73,6 +75,42 @@ func TestVarBind(t *testing.T) {
 	}
 }
 
+func TestVarBindNullOid(t *testing.T) {
+	tests := []struct {
+		buf    []byte
+		expOid string
+	}{
+		// 0.0 (zeroDotZero)
+		{[]byte{0x30, 0x05, 0x06, 0x01, 0x00, 0x05, 0x00}, "0.0"},
+		// zero-length OID
+		{[]byte{0x30, 0x04, 0x06, 0x00, 0x05, 0x00}, ""},
+	}
+
+	for _, test := range tests {
+		var v snmpgo.VarBind
+		rest, err := (&v).Unmarshal(test.buf)
+		if len(rest) != 0 || err != nil {
+			t.Errorf("Unmarshal() - len[%d] err[%v]", len(rest), err)
+			continue
+		}
+		if v.Oid.String() != test.expOid {
+			t.Errorf("Unmarshal() - expected oid [%s], actual [%s]", test.expOid, v.Oid)
+		}
+		testVarBind(t, &v, `{"Oid": "`+test.expOid+`", "Variable": {"Type": "Null", "Value": ""}}`)
+
+		buf, err := v.Marshal()
+		if err != nil || !bytes.Equal(test.buf, buf) {
+			t.Errorf("Marshal() - expected [%s], actual [%s], err[%v]",
+				snmpgo.ToHexStr(test.buf, " "), snmpgo.ToHexStr(buf, " "), err)
+		}
+	}
+
+	oid, err := snmpgo.NewOid("0.0")
+	if err != nil || oid.String() != "0.0" {
+		t.Errorf("NewOid(0.0) - expected [0.0], actual [%v], err[%v]", oid, err)
+	}
+}
+
 func TestVarBinds(t *testing.T) {
 	var v snmpgo.VarBinds
 
@@ -164,6 +202,75 @@ func TestVarBinds(t *testing.T) {
 	}
 }
 
+func TestVarBindsWithin(t *testing.T) {
+	var v snmpgo.VarBinds
+	for _, o := range []string{
+		"1.3.6.1.2.1.2.2.1.1.1",
+		"1.3.6.1.2.1.2.2.1.2.1",
+		"1.3.6.1.2.1.2.2.1.1.2",
+		"1.3.6.1.2.1.2.2.1.1",
+		"1.3.6.1.2.1.2.2.1.10.1",
+		"1.3.6.1.2.1.1.3.0",
+	} {
+		v = append(v, snmpgo.NewVarBind(snmpgo.MustNewOid(o), snmpgo.NewNull()))
+	}
+
+	// neither the base itself nor the sibling subtree with the same prefix string
+	base := snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1")
+	varBinds := v.Within(base)
+	exp := []string{"1.3.6.1.2.1.2.2.1.1.1", "1.3.6.1.2.1.2.2.1.1.2"}
+	if len(varBinds) != len(exp) {
+		t.Fatalf("Within() - expected %v, actual %v", exp, varBinds)
+	}
+	for i, val := range varBinds {
+		if val.Oid.String() != exp[i] {
+			t.Errorf("Within() - expected [%s], actual [%s]", exp[i], val.Oid)
+		}
+	}
+
+	if varBinds = v.Within(snmpgo.MustNewOid("1.3.6.1.2.1.1.3.0")); len(varBinds) != 0 {
+		t.Errorf("Within() - expected no VarBinds, actual %v", varBinds)
+	}
+	if varBinds = v.Within(nil); len(varBinds) != 0 {
+		t.Errorf("Within() - nil, actual %v", varBinds)
+	}
+}
+
+func TestDiffVarBinds(t *testing.T) {
+	prev := snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2.1"), snmpgo.NewOctetString([]byte("lo"))),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2.2"), snmpgo.NewOctetString([]byte("eth0"))),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.8.1"), snmpgo.NewInteger(1)),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.8.2"), snmpgo.NewInteger(1)),
+	}
+	curr := snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2.1"), snmpgo.NewOctetString([]byte("lo"))),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2.3"), snmpgo.NewOctetString([]byte("eth1"))),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.8.1"), snmpgo.NewInteger(1)),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.8.2"), snmpgo.NewInteger(2)),
+	}
+
+	added, removed, changed := snmpgo.DiffVarBinds(prev, curr)
+	if len(added) != 1 || added[0] != curr[1] {
+		t.Errorf("DiffVarBinds() - expected added %v, actual %v", curr[1:2], added)
+	}
+	if len(removed) != 1 || removed[0] != prev[1] {
+		t.Errorf("DiffVarBinds() - expected removed %v, actual %v", prev[1:2], removed)
+	}
+	if len(changed) != 1 || changed[0] != curr[3] {
+		t.Errorf("DiffVarBinds() - expected changed %v, actual %v", curr[3:], changed)
+	}
+
+	// the same value of the different type is changed
+	curr = snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.8.1"), snmpgo.NewGauge32(1)),
+	}
+	added, removed, changed = snmpgo.DiffVarBinds(prev[2:3], curr)
+	if len(added) != 0 || len(removed) != 0 || len(changed) != 1 {
+		t.Errorf("DiffVarBinds() - expected changed type, actual %v, %v, %v", added, removed, changed)
+	}
+}
+
 func TestNewPdu(t *testing.T) {
 	pdu := snmpgo.NewPdu(snmpgo.V1, snmpgo.GetRequest)
 	if _, ok := pdu.(*snmpgo.PduV1); !ok {
@@ -215,7 +322,7 @@ func TestPduV1(t *testing.T) {
 		`"ErrorStatus": "TooBig", "ErrorIndex": "2", "VarBinds": [` +
 		`{"Oid": "1.3.6.1.2.1.1.1.0", "Variable": {"Type": "OctetString", "Value": "MyHost"}}, ` +
 		`{"Oid": "1.3.6.1.2.1.1.2.0", "Variable": {"Type": "Null", "Value": ""}}, ` +
-		`{"Oid": "1.3.6.1.2.1.1.3.0", "Variable": {"Type": "TimeTicks", "Value": "11111"}}]}`
+		`{"Oid": "1.3.6.1.2.1.1.3.0", "Variable": {"Type": "TimeTicks", "Value": "0:01:51.11"}}]}`
 	var w snmpgo.PduV1
 	rest, err := (&w).Unmarshal(buf)
 	if len(rest) != 0 || err != nil {
@@ -252,6 +359,46 @@ func TestPduV1LargeObjectIdentifier(t *testing.T) {
 	}
 }
 
+func TestPduV1UnknownVariable(t *testing.T) {
+	buf := []byte{
+		0xa2, 0x3a, 0x02, 0x01, 0x01, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+		0x30, 0x2f, 0x30, 0x0d, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01,
+		0x01, 0x01, 0x00, 0x02, 0x01, 0x05, 0x30, 0x0e, 0x06, 0x08, 0x2b,
+		0x06, 0x01, 0x04, 0x01, 0x09, 0x01, 0x00, 0x47, 0x02, 0xab, 0xcd,
+		0x30, 0x0e, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x03,
+		0x00, 0x43, 0x02, 0x2b, 0x67,
+	}
+
+	var pdu snmpgo.PduV1
+	rest, err := (&pdu).Unmarshal(buf)
+	if len(rest) != 0 || err != nil {
+		t.Fatalf("Unmarshal() - len[%d] err[%v]", len(rest), err)
+	}
+	varBinds := pdu.VarBinds()
+	if len(varBinds) != 3 {
+		t.Fatalf("Unmarshal() - expected 3 varbinds, actual %v", varBinds)
+	}
+	if _, ok := varBinds[0].Variable.(*snmpgo.Integer); !ok {
+		t.Errorf("Unmarshal() - expected Integer, actual %v", varBinds[0])
+	}
+	if _, ok := varBinds[2].Variable.(*snmpgo.TimeTicks); !ok {
+		t.Errorf("Unmarshal() - expected TimeTicks, actual %v", varBinds[2])
+	}
+
+	v, ok := varBinds[1].Variable.(*snmpgo.UnknownVariable)
+	if !ok {
+		t.Fatalf("Unmarshal() - expected UnknownVariable, actual %v", varBinds[1])
+	}
+	if v.Tag != 7 || !bytes.Equal(v.Value, []byte{0xab, 0xcd}) || v.Type() != "Unknown" {
+		t.Errorf("Unmarshal() - unexpected variable %v", v)
+	}
+	b, err := v.Marshal()
+	if expBuf := []byte{0x47, 0x02, 0xab, 0xcd}; err != nil || !bytes.Equal(expBuf, b) {
+		t.Errorf("Marshal() - expected [%s], actual [%s], err[%v]",
+			snmpgo.ToHexStr(expBuf, " "), snmpgo.ToHexStr(b, " "), err)
+	}
+}
+
 func TestScopedPdu(t *testing.T) {
 	pdu := snmpgo.NewPdu(snmpgo.V3, snmpgo.GetRequest)
 	pdu.SetRequestId(123)
@@ -294,7 +441,7 @@ func TestScopedPdu(t *testing.T) {
 		`"VarBinds": [` +
 		`{"Oid": "1.3.6.1.2.1.1.1.0", "Variable": {"Type": "OctetString", "Value": "MyHost"}}, ` +
 		`{"Oid": "1.3.6.1.2.1.1.2.0", "Variable": {"Type": "Null", "Value": ""}}, ` +
-		`{"Oid": "1.3.6.1.2.1.1.3.0", "Variable": {"Type": "TimeTicks", "Value": "11111"}}]}`
+		`{"Oid": "1.3.6.1.2.1.1.3.0", "Variable": {"Type": "TimeTicks", "Value": "0:01:51.11"}}]}`
 	var w snmpgo.ScopedPdu
 	rest, err := (&w).Unmarshal(buf)
 	if len(rest) != 0 || err != nil {
@@ -304,3 +451,133 @@ func TestScopedPdu(t *testing.T) {
 		t.Errorf("Unmarshal() - expected [%s], actual [%s]", expStr, w.String())
 	}
 }
+
+func TestPduBinaryMarshaler(t *testing.T) {
+	varBinds := snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.1.1.0"), snmpgo.NewOctetString([]byte("MyHost"))),
+		snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(11111)),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.1.1"), snmpgo.NewInteger(-1)),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.4.20.1.1.1"), snmpgo.NewIpaddress(192, 0, 2, 1)),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.31.1.1.1.6.1"), snmpgo.NewCounter64(1<<40)),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.1.2.0"), snmpgo.OidLinkUp),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.1.9.0"), snmpgo.NewNoSuchInstance()),
+	}
+
+	for _, version := range []snmpgo.SNMPVersion{snmpgo.V2c, snmpgo.V3} {
+		pdu := snmpgo.NewPduWithVarBinds(version, snmpgo.GetResponse, varBinds)
+		pdu.SetRequestId(123)
+		pdu.SetErrorStatus(snmpgo.NoSuchName)
+		pdu.SetErrorIndex(7)
+
+		// implemented by the concrete types, not required by the Pdu interface
+		m, ok := pdu.(encoding.BinaryMarshaler)
+		if !ok {
+			t.Fatalf("MarshalBinary() - %v : not implemented by %T", version, pdu)
+		}
+		b, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary() - %v : %v", version, err)
+		}
+
+		decoded := snmpgo.NewPdu(version, snmpgo.GetRequest)
+		u, ok := decoded.(encoding.BinaryUnmarshaler)
+		if !ok {
+			t.Fatalf("UnmarshalBinary() - %v : not implemented by %T", version, decoded)
+		}
+		if err = u.UnmarshalBinary(b); err != nil {
+			t.Fatalf("UnmarshalBinary() - %v : %v", version, err)
+		}
+		if decoded.String() != pdu.String() {
+			t.Errorf("UnmarshalBinary() - %v : expected [%s], actual [%s]", version, pdu, decoded)
+		}
+
+		if err = u.UnmarshalBinary(append(b, 0x00)); err == nil {
+			t.Errorf("UnmarshalBinary() - %v : trailing data", version)
+		}
+		if err = u.UnmarshalBinary(b[:len(b)-1]); err == nil {
+			t.Errorf("UnmarshalBinary() - %v : truncated data", version)
+		}
+	}
+}
+
+func TestPduIsTruncated(t *testing.T) {
+	oids, _ := snmpgo.NewOids([]string{
+		"1.3.6.1.2.1.2.2.1.2.1", "1.3.6.1.2.1.2.2.1.3.1",
+		"1.3.6.1.2.1.2.2.1.2.2", "1.3.6.1.2.1.2.2.1.3.2",
+		"1.3.6.1.2.1.2.2.1.2.3", "1.3.6.1.2.1.2.2.1.3.3",
+	})
+
+	// implemented by the concrete types, not required by the Pdu interface
+	type truncatable interface {
+		IsTruncated(requested, maxRepetitions int) bool
+	}
+
+	for _, ver := range []snmpgo.SNMPVersion{snmpgo.V2c, snmpgo.V3} {
+		pdu, ok := snmpgo.NewPduWithOids(ver, snmpgo.GetResponse, oids).(truncatable)
+		if !ok {
+			t.Fatalf("IsTruncated() - not implemented [%s]", ver)
+		}
+		if pdu.IsTruncated(2, 3) {
+			t.Errorf("IsTruncated() - full response [%s]", ver)
+		}
+		if pdu.IsTruncated(1, 3) {
+			t.Errorf("IsTruncated() - more than requested [%s]", ver)
+		}
+
+		pdu = snmpgo.NewPduWithOids(ver, snmpgo.GetResponse, oids[:5]).(truncatable)
+		if !pdu.IsTruncated(2, 3) {
+			t.Errorf("IsTruncated() - truncated response [%s]", ver)
+		}
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	// RFC3416 Section 3, error-status
+	expNames := []string{
+		"NoError", "TooBig", "NoSuchName", "BadValue", "ReadOnly", "GenError",
+		"NoAccess", "WrongType", "WrongLength", "WrongEncoding", "WrongValue",
+		"NoCreation", "InconsistentValue", "ResourceUnavailable", "CommitFailed",
+		"UndoFailed", "AuthorizationError", "NotWritable", "InconsistentName",
+	}
+	for i, expName := range expNames {
+		e := snmpgo.ErrorStatus(i)
+		if s := e.String(); s != expName {
+			t.Errorf("String() - status %d, expected [%s], actual [%s]", i, expName, s)
+		}
+		if e.IsError() != (i != 0) {
+			t.Errorf("IsError() - status %d, expected %v", i, i != 0)
+		}
+	}
+
+	e := snmpgo.ErrorStatus(len(expNames))
+	if s := e.String(); s != "Unknown" {
+		t.Errorf("String() - status %d, expected [Unknown], actual [%s]", e, s)
+	}
+	if !e.IsError() {
+		t.Errorf("IsError() - status %d, expected true", e)
+	}
+}
+
+func TestVarBindsSortInterface(t *testing.T) {
+	v := snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2.1"), snmpgo.NewInteger(1)),
+		&snmpgo.VarBind{Variable: snmpgo.NewInteger(2)},
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.1.3.0"), snmpgo.NewInteger(3)),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2.1"), snmpgo.NewInteger(4)),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.10.1"), snmpgo.NewInteger(5)),
+		snmpgo.NewVarBind(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2.1"), snmpgo.NewInteger(6)),
+	}
+
+	// the VarBinds of the same OID keep the order, and the VarBind without OID is the last
+	sort.Stable(v)
+	exp := []string{"3", "1", "4", "6", "5", "2"}
+	for i, val := range v {
+		if val.Variable.String() != exp[i] {
+			t.Errorf("sort.Stable() - expected %v, actual %v", exp, v)
+			break
+		}
+	}
+	if !sort.IsSorted(v) {
+		t.Errorf("sort.IsSorted() - expected sorted, actual %v", v)
+	}
+}
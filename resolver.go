@@ -0,0 +1,181 @@
+package snmpgo
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OidFormat specifies how an OID is rendered by the Oid.String()
+type OidFormat int
+
+const (
+	OidNumeric  OidFormat = iota // Only sub-identifiers (e.g. "1.3.6.1.2.1.2.2.1.2.1")
+	OidSymbolic                  // Names of all the known nodes (e.g. "1.3.6.1.2.1.2.2.1.ifDescr.1")
+	OidSuffix                    // Name of the nearest known node (e.g. "ifDescr.1")
+)
+
+func (f OidFormat) String() string {
+	switch f {
+	case OidNumeric:
+		return "Numeric"
+	case OidSymbolic:
+		return "Symbolic"
+	case OidSuffix:
+		return "Suffix"
+	default:
+		return "Unknown"
+	}
+}
+
+// OidResolver translates OIDs into names and vice versa, which are registered without MIB files
+type OidResolver struct {
+	lock  *sync.RWMutex
+	names map[string]string
+	oids  map[string]*Oid
+}
+
+// Register a name of the OID node.
+// The name must start with a letter and must not contain dots.
+func (r *OidResolver) Register(name string, oid *Oid) error {
+	if name == "" || strings.Contains(name, ".") || (name[0] >= '0' && name[0] <= '9') {
+		return &ArgumentError{
+			Value:   name,
+			Message: "Name must start with a letter and must not contain dots",
+		}
+	}
+	if oid == nil {
+		return &ArgumentError{
+			Value:   oid,
+			Message: "Oid is required",
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	key := oid.Value.String()
+	if old, ok := r.oids[name]; ok {
+		delete(r.names, old.Value.String())
+	}
+	if old, ok := r.names[key]; ok {
+		delete(r.oids, old)
+	}
+	r.names[key] = name
+	r.oids[name] = oid.Copy()
+	return nil
+}
+
+// Gets a registered name of the OID node
+func (r *OidResolver) Name(oid *Oid) (string, bool) {
+	if oid == nil {
+		return "", false
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	name, ok := r.names[oid.Value.String()]
+	return name, ok
+}
+
+// Gets the OID of the registered name, which may be followed by the sub-identifiers
+// of the index (e.g. "sysDescr.0", "ifDescr.1")
+func (r *OidResolver) Oid(name string) (*Oid, error) {
+	base, index := name, ""
+	if i := strings.Index(name, "."); i >= 0 {
+		base, index = name[:i], name[i:]
+	}
+
+	r.lock.RLock()
+	oid, ok := r.oids[base]
+	r.lock.RUnlock()
+	if !ok {
+		return nil, &ArgumentError{
+			Value:   name,
+			Message: "Unknown name",
+		}
+	}
+	if index == "" {
+		return oid.Copy(), nil
+	}
+	return NewOid(oid.Value.String() + index)
+}
+
+// Returns a string of the OID in the format
+func (r *OidResolver) Format(oid *Oid, format OidFormat) string {
+	if oid == nil {
+		return ""
+	}
+	if format == OidNumeric {
+		return oid.Value.String()
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	// names of each prefix of the OID
+	labels := make([]string, len(oid.Value))
+	var prefix bytes.Buffer
+	nearest := -1
+	for i, id := range oid.Value {
+		if i > 0 {
+			prefix.WriteByte('.')
+		}
+		prefix.WriteString(strconv.Itoa(id))
+		if name, ok := r.names[prefix.String()]; ok {
+			labels[i] = name
+			nearest = i
+		} else {
+			labels[i] = strconv.Itoa(id)
+		}
+	}
+
+	switch {
+	case nearest < 0:
+		return oid.Value.String()
+	case format == OidSuffix:
+		return strings.Join(append([]string{labels[nearest]}, numbers(oid.Value[nearest+1:])...), ".")
+	default:
+		return strings.Join(labels, ".")
+	}
+}
+
+func numbers(ids []int) []string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(id)
+	}
+	return s
+}
+
+func NewOidResolver() *OidResolver {
+	return &OidResolver{
+		lock:  new(sync.RWMutex),
+		names: map[string]string{},
+		oids:  map[string]*Oid{},
+	}
+}
+
+var oidFormat OidFormat
+var oidResolver *OidResolver
+var oidFormatMutex sync.RWMutex
+
+// SetOidFormat sets the format of the Oid.String() on the package.
+// The names of the symbolic formats are looked up in the resolver,
+// OIDs are rendered numerically when the resolver is nil.
+func SetOidFormat(format OidFormat, resolver *OidResolver) {
+	oidFormatMutex.Lock()
+	defer oidFormatMutex.Unlock()
+	oidFormat = format
+	oidResolver = resolver
+}
+
+func formatOid(oid *Oid) string {
+	oidFormatMutex.RLock()
+	format, resolver := oidFormat, oidResolver
+	oidFormatMutex.RUnlock()
+
+	if format == OidNumeric || resolver == nil {
+		return oid.Value.String()
+	}
+	return resolver.Format(oid, format)
+}
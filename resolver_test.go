@@ -0,0 +1,142 @@
+package snmpgo_test
+
+import (
+	"testing"
+
+	"github.com/k-sone/snmpgo"
+)
+
+func TestOidResolver(t *testing.T) {
+	r := snmpgo.NewOidResolver()
+	if err := r.Register("ifDescr", snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2")); err != nil {
+		t.Errorf("Register() - has error %v", err)
+	}
+	if err := r.Register("mib-2", snmpgo.MustNewOid("1.3.6.1.2.1")); err != nil {
+		t.Errorf("Register() - has error %v", err)
+	}
+	for _, name := range []string{"", "if.Descr", "1ifDescr"} {
+		if err := r.Register(name, snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2")); err == nil {
+			t.Errorf("Register() - invalid name [%s]", name)
+		}
+	}
+	if err := r.Register("ifDescr", nil); err == nil {
+		t.Error("Register() - nil oid")
+	}
+
+	if name, ok := r.Name(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2")); !ok || name != "ifDescr" {
+		t.Errorf("Name() - expected [ifDescr], actual [%s]", name)
+	}
+	if _, ok := r.Name(snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2.1")); ok {
+		t.Error("Name() - unregistered oid")
+	}
+
+	tests := []struct {
+		oid    string
+		format snmpgo.OidFormat
+		str    string
+	}{
+		{"1.3.6.1.2.1.2.2.1.2.1", snmpgo.OidNumeric, "1.3.6.1.2.1.2.2.1.2.1"},
+		{"1.3.6.1.2.1.2.2.1.2.1", snmpgo.OidSymbolic, "1.3.6.1.2.mib-2.2.2.1.ifDescr.1"},
+		{"1.3.6.1.2.1.2.2.1.2.1", snmpgo.OidSuffix, "ifDescr.1"},
+		{"1.3.6.1.2.1.2.2.1.2", snmpgo.OidSuffix, "ifDescr"},
+		{"1.3.6.1.2.1.1.3.0", snmpgo.OidSuffix, "mib-2.1.3.0"},
+		{"1.3.6.1.4.1.9", snmpgo.OidSymbolic, "1.3.6.1.4.1.9"},
+		{"1.3.6.1.4.1.9", snmpgo.OidSuffix, "1.3.6.1.4.1.9"},
+	}
+	for _, test := range tests {
+		if s := r.Format(snmpgo.MustNewOid(test.oid), test.format); s != test.str {
+			t.Errorf("Format(%s) - expected [%s], actual [%s]", test.format, test.str, s)
+		}
+	}
+	for _, format := range []snmpgo.OidFormat{snmpgo.OidNumeric, snmpgo.OidSymbolic, snmpgo.OidSuffix} {
+		if s := r.Format(nil, format); s != "" {
+			t.Errorf("Format(%s) - nil oid, expected empty, actual [%s]", format, s)
+		}
+	}
+}
+
+func TestOidResolverOid(t *testing.T) {
+	r := snmpgo.NewOidResolver()
+	r.Register("sysDescr", snmpgo.MustNewOid("1.3.6.1.2.1.1.1"))
+	r.Register("ifDescr", snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2"))
+
+	tests := []struct {
+		name string
+		oid  string
+	}{
+		{"sysDescr", "1.3.6.1.2.1.1.1"},
+		{"sysDescr.0", "1.3.6.1.2.1.1.1.0"},
+		{"ifDescr.10.1", "1.3.6.1.2.1.2.2.1.2.10.1"},
+	}
+	for _, test := range tests {
+		oid, err := r.Oid(test.name)
+		if err != nil {
+			t.Errorf("Oid(%s) - has error %v", test.name, err)
+		} else if oid.Value.String() != test.oid {
+			t.Errorf("Oid(%s) - expected [%s], actual [%s]", test.name, test.oid, oid.Value.String())
+		}
+	}
+
+	for _, name := range []string{"", "ifName", "ifName.1", "sysDescr.x", "sysDescr."} {
+		if _, err := r.Oid(name); err == nil {
+			t.Errorf("Oid(%s) - expected error", name)
+		}
+	}
+
+	// re-registered name
+	r.Register("sysDescr", snmpgo.MustNewOid("1.3.6.1.2.1.1.5"))
+	if oid, err := r.Oid("sysDescr"); err != nil || oid.Value.String() != "1.3.6.1.2.1.1.5" {
+		t.Errorf("Oid(sysDescr) - expected [1.3.6.1.2.1.1.5], actual [%v], err %v", oid, err)
+	}
+	if _, ok := r.Name(snmpgo.MustNewOid("1.3.6.1.2.1.1.1")); ok {
+		t.Error("Name() - expected the previous oid to be unregistered")
+	}
+
+	// neither the registered nor the returned OID is shared with the resolver
+	registered := snmpgo.MustNewOid("1.3.6.1.2.1.1.3")
+	r.Register("sysUpTime", registered)
+	registered.Value[len(registered.Value)-1] = 9
+	returned, _ := r.Oid("sysUpTime")
+	returned.Value[0] = 2
+	if oid, err := r.Oid("sysUpTime"); err != nil || oid.Value.String() != "1.3.6.1.2.1.1.3" {
+		t.Errorf("Oid(sysUpTime) - expected [1.3.6.1.2.1.1.3], actual [%v], err %v", oid, err)
+	}
+}
+
+func TestSetOidFormat(t *testing.T) {
+	defer snmpgo.SetOidFormat(snmpgo.OidNumeric, nil)
+
+	r := snmpgo.NewOidResolver()
+	r.Register("ifDescr", snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2"))
+	oid := snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2.1")
+	varBind := snmpgo.NewVarBind(oid, snmpgo.NewOctetString([]byte("eth0")))
+
+	tests := []struct {
+		format   snmpgo.OidFormat
+		resolver *snmpgo.OidResolver
+		str      string
+	}{
+		{snmpgo.OidNumeric, nil, "1.3.6.1.2.1.2.2.1.2.1"},
+		{snmpgo.OidSymbolic, nil, "1.3.6.1.2.1.2.2.1.2.1"},
+		{snmpgo.OidSuffix, nil, "1.3.6.1.2.1.2.2.1.2.1"},
+		{snmpgo.OidNumeric, r, "1.3.6.1.2.1.2.2.1.2.1"},
+		{snmpgo.OidSymbolic, r, "1.3.6.1.2.1.2.2.1.ifDescr.1"},
+		{snmpgo.OidSuffix, r, "ifDescr.1"},
+	}
+	for _, test := range tests {
+		snmpgo.SetOidFormat(test.format, test.resolver)
+		if s := oid.String(); s != test.str {
+			t.Errorf("String(%s) - expected [%s], actual [%s]", test.format, test.str, s)
+		}
+		exp := `{"Oid": "` + test.str + `", "Variable": {"Type": "OctetString", "Value": "eth0"}}`
+		if s := varBind.String(); s != exp {
+			t.Errorf("VarBind.String(%s) - expected [%s], actual [%s]", test.format, exp, s)
+		}
+	}
+
+	// sub-identifiers are kept numeric
+	snmpgo.SetOidFormat(snmpgo.OidSuffix, r)
+	if o, err := oid.AppendSubIds([]int{5}); err != nil || o.Value.String() != "1.3.6.1.2.1.2.2.1.2.1.5" {
+		t.Errorf("AppendSubIds() - unexpected %v, %v", o, err)
+	}
+}
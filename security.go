@@ -2,15 +2,16 @@ package snmpgo
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/des"
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/rand"
 	"crypto/sha1"
 	"encoding/asn1"
 	"encoding/binary"
-	"encoding/hex"
 	"fmt"
 	"hash"
 	"math"
@@ -25,7 +26,7 @@ type security interface {
 	GenerateRequestMessage(message) error
 	GenerateResponseMessage(message) error
 	ProcessIncomingMessage(message) error
-	Discover(*SNMP) error
+	Discover(context.Context, *SNMP) error
 	String() string
 }
 
@@ -45,7 +46,6 @@ func (c *community) GenerateRequestMessage(sendMsg message) (err error) {
 	if err != nil {
 		return
 	}
-	fmt.Println("GenerateRequestMessage", hex.Dump(b))
 	m.SetPduBytes(b)
 
 	return
@@ -78,7 +78,7 @@ func (c *community) ProcessIncomingMessage(recvMsg message) (err error) {
 	return
 }
 
-func (c *community) Discover(snmp *SNMP) error {
+func (c *community) Discover(ctx context.Context, snmp *SNMP) error {
 	return nil
 }
 
@@ -96,6 +96,7 @@ const (
 
 	// for server side
 	remoteReference
+	localReference
 )
 
 func (d discoveryStatus) String() string {
@@ -108,6 +109,8 @@ func (d discoveryStatus) String() string {
 		return "discovered"
 	case remoteReference:
 		return "remoteReference"
+	case localReference:
+		return "localReference"
 	default:
 		return "Unknown"
 	}
@@ -126,6 +129,16 @@ type usm struct {
 	PrivKey         []byte
 	PrivPassword    string
 	PrivProtocol    PrivProtocol
+	SaltGenerator   func() int64
+
+	now func() time.Time // clock of the engine time (The default is time.Now)
+}
+
+func (u *usm) timeNow() time.Time {
+	if u.now != nil {
+		return u.now()
+	}
+	return time.Now()
 }
 
 func (u *usm) Identifier() string {
@@ -144,7 +157,13 @@ func (u *usm) GenerateRequestMessage(sendMsg message) (err error) {
 		m.UserName = u.UserName
 		m.AuthEngineId = u.AuthEngineId
 	}
-	if u.DiscoveryStatus > noSynchronized {
+	if u.DiscoveryStatus == localReference {
+		// the usm of the local engine is shared by the received messages, so is not updated
+		m.AuthEngineBoots, m.AuthEngineTime, _, err = u.currentEngineBootsTime()
+		if err != nil {
+			return
+		}
+	} else if u.DiscoveryStatus > noSynchronized {
 		err = u.UpdateEngineBootsTime()
 		if err != nil {
 			return
@@ -163,7 +182,7 @@ func (u *usm) GenerateRequestMessage(sendMsg message) (err error) {
 	if m.Authentication() {
 		// encrypt Pdu
 		if m.Privacy() {
-			err = encrypt(m, u.PrivProtocol, u.PrivKey)
+			err = encrypt(m, u.PrivProtocol, u.PrivKey, u.genSalt())
 			if err != nil {
 				return
 			}
@@ -236,8 +255,8 @@ func (u *usm) ProcessIncomingMessage(recvMsg message) (err error) {
 		}
 		if !hmac.Equal(rm.AuthParameter, digest) {
 			return &MessageError{
-				Message: fmt.Sprintf("Failed to authenticate - expected [%s], actual [%s]",
-					toHexStr(rm.AuthParameter, ""), toHexStr(digest, "")),
+				Message: fmt.Sprintf("Failed to authenticate - expected [%s], actual [%s], %s",
+					toHexStr(rm.AuthParameter, ""), toHexStr(digest, ""), u.securityInfo(rm)),
 			}
 		}
 
@@ -247,7 +266,7 @@ func (u *usm) ProcessIncomingMessage(recvMsg message) (err error) {
 			if e != nil {
 				return &MessageError{
 					Cause:   e,
-					Message: "Can't decrypt a message",
+					Message: fmt.Sprintf("Can't decrypt a message, %s", u.securityInfo(rm)),
 				}
 			}
 		}
@@ -255,12 +274,23 @@ func (u *usm) ProcessIncomingMessage(recvMsg message) (err error) {
 
 	// update boots & time
 	switch u.DiscoveryStatus {
+	case localReference:
+		if rm.Authentication() {
+			if err = u.CheckLocalTimeliness(rm.AuthEngineBoots, rm.AuthEngineTime); err != nil {
+				return
+			}
+		}
 	case remoteReference:
 		if rm.Authentication() {
 			if err = u.CheckTimeliness(rm.AuthEngineBoots, rm.AuthEngineTime); err != nil {
-				return
+				// perhaps a replayed message
+				return &notInTimeWindowError{err}
+			}
+			// RFC3414 Section 3.2 7) b), only the newer message updates the notion
+			if rm.AuthEngineBoots > u.AuthEngineBoots ||
+				(rm.AuthEngineBoots == u.AuthEngineBoots && rm.AuthEngineTime > u.AuthEngineTime) {
+				u.SynchronizeEngineBootsTime(rm.AuthEngineBoots, rm.AuthEngineTime)
 			}
-			u.SynchronizeEngineBootsTime(rm.AuthEngineBoots, rm.AuthEngineTime)
 		}
 	case discovered:
 		if rm.Authentication() {
@@ -286,32 +316,51 @@ func (u *usm) ProcessIncomingMessage(recvMsg message) (err error) {
 	if err != nil {
 		var note string
 		if rm.Privacy() {
-			note = " (probably Pdu was unable to decrypt)"
+			note = fmt.Sprintf(" (probably Pdu was unable to decrypt, %s)", u.securityInfo(rm))
 		}
-		return &MessageError{
+		e := MessageError{
 			Cause:   err,
 			Message: fmt.Sprintf("Failed to Unmarshal Pdu%s", note),
-			Detail:  fmt.Sprintf("Pdu Bytes - [%s]", toHexStr(rm.PduBytes(), " ")),
+			Detail:  fmt.Sprintf("Message - [%s], Pdu Bytes - [%s]", rm, toHexStr(rm.PduBytes(), " ")),
+		}
+		partial := &ScopedPdu{}
+		if p, ok := rm.Pdu().(*ScopedPdu); ok {
+			partial.maxVarBinds = p.maxVarBinds
+		}
+		if partial.unmarshalPartial(rm.PduBytes()) {
+			return &PartialPduError{MessageError: e, Pdu: partial}
 		}
+		return &e
 	}
 	return
 }
 
-func (u *usm) Discover(snmp *SNMP) (err error) {
+// securityInfo describes the engines and the security name of the received message
+// to tell which credential or engine mismatched
+func (u *usm) securityInfo(rm *messageV3) string {
+	return fmt.Sprintf("local AuthEngineId [%s], received AuthEngineId [%s], UserName [%s]",
+		toHexStr(u.AuthEngineId, ""), toHexStr(rm.AuthEngineId, ""), rm.UserName)
+}
+
+func (u *usm) Discover(ctx context.Context, snmp *SNMP) (err error) {
 	if snmp.args.SecurityEngineId != "" {
 		securityEngineId, _ := engineIdToBytes(snmp.args.SecurityEngineId)
 		u.SetAuthEngineId(securityEngineId)
 		u.DiscoveryStatus = noSynchronized
+		if snmp.args.SkipDiscovery {
+			u.SynchronizeEngineBootsTime(
+				int64(snmp.args.EngineBoots), int64(snmp.args.EngineTime))
+			u.DiscoveryStatus = discovered
+		}
 		return
 	}
 
 	if u.DiscoveryStatus == noDiscovered {
-		// Send an empty Pdu with the NoAuthNoPriv
+		// Send the probe with the NoAuthNoPriv
 		orgSecLevel := snmp.args.SecurityLevel
 		snmp.args.SecurityLevel = NoAuthNoPriv
 
-		pdu := NewPdu(snmp.args.Version, GetRequest)
-		_, err = snmp.sendPdu(pdu)
+		err = u.sendProbe(ctx, snmp)
 
 		snmp.args.SecurityLevel = orgSecLevel
 		if err != nil {
@@ -319,18 +368,33 @@ func (u *usm) Discover(snmp *SNMP) (err error) {
 		}
 	}
 
+	return u.Synchronize(ctx, snmp)
+}
+
+// Synchronize gets the boots and time of the authoritative engine,
+// if they are not synchronized yet
+func (u *usm) Synchronize(ctx context.Context, snmp *SNMP) (err error) {
 	if u.DiscoveryStatus == noSynchronized && snmp.args.SecurityLevel > NoAuthNoPriv {
-		// Send an empty Pdu
-		pdu := NewPdu(snmp.args.Version, GetRequest)
-		_, err = snmp.sendPdu(pdu)
-		if err != nil {
-			return
-		}
+		err = u.sendProbe(ctx, snmp)
 	}
-
 	return
 }
 
+// sendProbe sends a GetRequest of the DiscoveryOid, or an empty Pdu by default.
+// The agent answers it with a report, which is not an error if the discovery advances.
+func (u *usm) sendProbe(ctx context.Context, snmp *SNMP) error {
+	pdu := NewPdu(snmp.args.Version, GetRequest)
+	if snmp.args.DiscoveryOid != "" {
+		oid, _ := NewOid(snmp.args.DiscoveryOid)
+		pdu = NewPduWithOids(snmp.args.Version, GetRequest, Oids{oid})
+	}
+	status := u.DiscoveryStatus
+	if _, err := snmp.sendPduContext(ctx, pdu, snmp.sendOptions()); err != nil && u.DiscoveryStatus <= status {
+		return err
+	}
+	return nil
+}
+
 func (u *usm) SetAuthEngineId(authEngineId []byte) {
 	u.AuthEngineId = authEngineId
 	if len(u.AuthPassword) > 0 {
@@ -341,41 +405,89 @@ func (u *usm) SetAuthEngineId(authEngineId []byte) {
 	}
 }
 
-func (u *usm) UpdateEngineBootsTime() error {
-	now := time.Now()
-	u.AuthEngineTime += int64(now.Sub(u.UpdatedTime).Seconds())
-	if u.AuthEngineTime > math.MaxInt32 {
-		u.AuthEngineBoots++
+func (u *usm) UpdateEngineBootsTime() (err error) {
+	var elapsed time.Duration
+	u.AuthEngineBoots, u.AuthEngineTime, elapsed, err = u.currentEngineBootsTime()
+	// carry over the fraction of a second to the next update
+	u.UpdatedTime = u.UpdatedTime.Add(elapsed)
+	return
+}
+
+// currentEngineBootsTime returns the boots and time advanced since the UpdatedTime
+// without updating them, and the elapsed whole seconds
+func (u *usm) currentEngineBootsTime() (
+	engineBoots, engineTime int64, elapsed time.Duration, err error) {
+
+	elapsed = u.timeNow().Sub(u.UpdatedTime).Truncate(time.Second)
+	engineBoots, engineTime = u.AuthEngineBoots, u.AuthEngineTime+int64(elapsed/time.Second)
+	if engineTime > math.MaxInt32 {
+		engineBoots++
 		// RFC3414 2.2.2
-		if u.AuthEngineBoots == math.MaxInt32 {
-			return fmt.Errorf("EngineBoots reached the max value, [%d]", math.MaxInt32)
+		if engineBoots == math.MaxInt32 {
+			err = fmt.Errorf("EngineBoots reached the max value, [%d]", math.MaxInt32)
 		}
-		u.AuthEngineTime -= math.MaxInt32
+		engineTime -= math.MaxInt32
 	}
-	u.UpdatedTime = now
-	return nil
+	return
 }
 
 func (u *usm) SynchronizeEngineBootsTime(engineBoots, engineTime int64) {
 	u.AuthEngineBoots = engineBoots
 	u.AuthEngineTime = engineTime
-	u.UpdatedTime = time.Now()
+	u.UpdatedTime = u.timeNow()
 }
 
+// CheckTimeliness checks the timeliness of a message,
+// when the remote engine is authoritative.
+// The local notion of the remote engine time advances since the last synchronization.
 func (u *usm) CheckTimeliness(engineBoots, engineTime int64) error {
+	localTime := u.AuthEngineTime
+	if !u.UpdatedTime.IsZero() {
+		localTime += int64(u.timeNow().Sub(u.UpdatedTime) / time.Second)
+	}
 	// RFC3414 Section 3.2 7) b)
 	if engineBoots == math.MaxInt32 ||
 		engineBoots < u.AuthEngineBoots ||
-		(engineBoots == u.AuthEngineBoots && u.AuthEngineTime-engineTime > 150) {
+		(engineBoots == u.AuthEngineBoots && localTime-engineTime > 150) {
 		return &MessageError{
 			Message: fmt.Sprintf(
 				"The message is not in the time window - local [%d/%d], remote [%d/%d]",
-				engineBoots, engineTime, u.AuthEngineBoots, u.AuthEngineTime),
+				u.AuthEngineBoots, localTime, engineBoots, engineTime),
 		}
 	}
 	return nil
 }
 
+func (u *usm) genSalt() int64 {
+	if u.SaltGenerator != nil {
+		return u.SaltGenerator()
+	}
+	if u.PrivProtocol == Des {
+		return int64(genSalt32())
+	}
+	return genSalt64()
+}
+
+// CheckLocalTimeliness checks the timeliness of a message,
+// when the local engine is authoritative
+func (u *usm) CheckLocalTimeliness(engineBoots, engineTime int64) error {
+	localBoots, localTime, _, err := u.currentEngineBootsTime()
+	if err != nil {
+		return err
+	}
+	// RFC3414 Section 3.2 7) a)
+	if localBoots == math.MaxInt32 ||
+		engineBoots != localBoots ||
+		engineTime-localTime > 150 || localTime-engineTime > 150 {
+		return &notInTimeWindowError{&MessageError{
+			Message: fmt.Sprintf(
+				"The message is not in the time window - local [%d/%d], remote [%d/%d]",
+				localBoots, localTime, engineBoots, engineTime),
+		}}
+	}
+	return nil
+}
+
 func (u *usm) String() string {
 	return fmt.Sprintf(
 		`{"UserName": "%s", "DiscoveryStatus": "%s", "AuthEngineId": "%s", `+
@@ -406,16 +518,16 @@ func mac(msg *messageV3, proto AuthProtocol, key []byte) ([]byte, error) {
 	return h.Sum(nil)[:12], nil
 }
 
-func encrypt(msg *messageV3, proto PrivProtocol, key []byte) (err error) {
+func encrypt(msg *messageV3, proto PrivProtocol, key []byte, salt int64) (err error) {
 	var dst, priv []byte
 	src := msg.PduBytes()
 
 	switch proto {
 	case Des:
-		dst, priv, err = encryptDES(src, key, int32(msg.AuthEngineBoots), genSalt32())
+		dst, priv, err = encryptDES(src, key, int32(msg.AuthEngineBoots), int32(salt))
 	case Aes:
 		dst, priv, err = encryptAES(
-			src, key, int32(msg.AuthEngineBoots), int32(msg.AuthEngineTime), genSalt64())
+			src, key, int32(msg.AuthEngineBoots), int32(msg.AuthEngineTime), salt)
 	}
 	if err != nil {
 		return
@@ -507,6 +619,9 @@ func decryptDES(src, key, privParam []byte) (dst []byte, err error) {
 	return
 }
 
+// RFC 3826 Section 3.1.2.1, AES-128 in the CFB mode with the 128-bit IV of
+// the 32-bit engineBoots, the 32-bit engineTime and the 64-bit salt (privParameters),
+// each in the network byte order. The CFB mode requires no padding (Section 3.1.3).
 func encryptAES(src, key []byte, engineBoots, engineTime int32, salt int64) (
 	dst, privParam []byte, err error) {
 
@@ -523,7 +638,6 @@ func encryptAES(src, key []byte, engineBoots, engineTime int32, salt int64) (
 	binary.Write(&buf2, binary.BigEndian, engineTime)
 	iv := append(buf2.Bytes(), privParam...)
 
-	src = padding(src, aes.BlockSize)
 	dst = make([]byte, len(src))
 
 	mode := cipher.NewCFBEncrypter(block, iv)
@@ -577,15 +691,82 @@ func passwordToKey(proto AuthProtocol, password string, engineId []byte) []byte
 	if remain > 0 {
 		h.Write(pass[:remain])
 	}
-	ku := h.Sum(nil)
+	return localizeKey(proto, h.Sum(nil), engineId)
+}
 
-	h.Reset()
+// localizeKey localizes the master key to the engine (RFC 3414 Section 2.6)
+func localizeKey(proto AuthProtocol, ku, engineId []byte) []byte {
+	h := newDigest(proto)
 	h.Write(ku)
 	h.Write(engineId)
 	h.Write(ku)
 	return h.Sum(nil)
 }
 
+func newDigest(proto AuthProtocol) hash.Hash {
+	if proto == Sha {
+		return sha1.New()
+	}
+	return md5.New()
+}
+
+// KeyChange returns the value of the KeyChange textual convention (RFC 3414 Section 5),
+// which changes the oldKey of a user to the newKey, digested by the proto.
+// The oldKey and newKey are the localized keys having the same length
+// (e.g. the first 16 octets of the localized key for the DES and AES),
+// or if the engineId is not nil, the master keys (Ku) localized to the engineId.
+//
+// The value is set to the usmUserAuthKeyChange or usmUserPrivKeyChange of the user
+// by the SetRequest, e.g.
+//
+//	oid, _ := snmpgo.NewOid("1.3.6.1.6.3.15.1.2.2.1.6.<engineId>.<userName>")
+//	snmp.SetRequest(snmpgo.VarBinds{snmpgo.NewVarBind(oid, snmpgo.NewOctetString(value))})
+func KeyChange(proto AuthProtocol, oldKey, newKey, engineId []byte) ([]byte, error) {
+	if proto != Md5 && proto != Sha {
+		return nil, &ArgumentError{
+			Value:   proto,
+			Message: "Illegal AuthProtocol",
+		}
+	}
+	if engineId != nil {
+		oldKey = localizeKey(proto, oldKey, engineId)
+		newKey = localizeKey(proto, newKey, engineId)
+	}
+	if len(oldKey) == 0 || len(oldKey) != len(newKey) {
+		return nil, &ArgumentError{
+			Value:   len(newKey),
+			Message: "Keys must have the same non-zero length",
+		}
+	}
+
+	randomValue := make([]byte, len(newKey))
+	if _, err := rand.Read(randomValue); err != nil {
+		return nil, err
+	}
+	return keyChange(proto, oldKey, newKey, randomValue), nil
+}
+
+// keyChange computes the random || delta of the KeyChange
+func keyChange(proto AuthProtocol, oldKey, newKey, randomValue []byte) []byte {
+	h := newDigest(proto)
+	delta := make([]byte, 0, len(newKey))
+	temp := oldKey
+	for len(delta) < len(newKey) {
+		h.Reset()
+		h.Write(temp)
+		h.Write(randomValue)
+		temp = h.Sum(nil)
+
+		i := len(delta)
+		n := len(newKey) - i
+		if n > len(temp) {
+			n = len(temp)
+		}
+		delta = append(delta, xor(temp[:n], newKey[i:i+n])...)
+	}
+	return append(randomValue, delta...)
+}
+
 func newSecurity(args *SNMPArguments) security {
 	switch args.Version {
 	case V1, V2c:
@@ -594,7 +775,8 @@ func newSecurity(args *SNMPArguments) security {
 		}
 	case V3:
 		sec := &usm{
-			UserName: []byte(args.UserName),
+			UserName:      []byte(args.UserName),
+			SaltGenerator: args.SaltGenerator,
 		}
 		switch args.SecurityLevel {
 		case AuthPriv:
@@ -2,7 +2,12 @@ package snmpgo_test
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"hash"
 	"math"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -38,6 +43,98 @@ func TestPasswordToKey(t *testing.T) {
 	}
 }
 
+// applyKeyChange is the processing of the KeyChange on the agent (RFC3414 Section 5)
+func applyKeyChange(h hash.Hash, oldKey, value []byte) []byte {
+	keyLen := len(value) / 2
+	random, delta := value[:keyLen], value[keyLen:]
+	newKey := make([]byte, 0, keyLen)
+	temp := oldKey
+	for len(newKey) < keyLen {
+		h.Reset()
+		h.Write(temp)
+		h.Write(random)
+		temp = h.Sum(nil)
+		for i := 0; i < len(temp) && len(newKey) < keyLen; i++ {
+			newKey = append(newKey, temp[i]^delta[len(newKey)])
+		}
+	}
+	return newKey
+}
+
+func TestKeyChange(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{0x11}, 16)
+	newKey := bytes.Repeat([]byte{0x22}, 16)
+	random := bytes.Repeat([]byte{0x33}, 16)
+
+	// random || (MD5(oldKey || random) XOR newKey)
+	digest := md5.Sum(append(append([]byte{}, oldKey...), random...))
+	expBuf := append([]byte{}, random...)
+	for i := range newKey {
+		expBuf = append(expBuf, digest[i]^newKey[i])
+	}
+	value := snmpgo.KeyChangeWithRandom(snmpgo.Md5, oldKey, newKey, random)
+	if !bytes.Equal(expBuf, value) {
+		t.Errorf("keyChange(Md5) - expected [%s], actual [%s]",
+			snmpgo.ToHexStr(expBuf, " "), snmpgo.ToHexStr(value, " "))
+	}
+
+	// longer keys than the digest are digested repeatedly
+	oldKey = bytes.Repeat([]byte{0x11}, 40)
+	newKey = bytes.Repeat([]byte{0x22}, 40)
+	random = bytes.Repeat([]byte{0x33}, 40)
+	value = snmpgo.KeyChangeWithRandom(snmpgo.Sha, oldKey, newKey, random)
+	if key := applyKeyChange(sha1.New(), oldKey, value); !bytes.Equal(newKey, key) {
+		t.Errorf("keyChange(Sha) - expected [%s], actual [%s]",
+			snmpgo.ToHexStr(newKey, " "), snmpgo.ToHexStr(key, " "))
+	}
+
+	// the privacy key of SHA is shorter than the digest
+	engineId := []byte{
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+	}
+	oldKey = snmpgo.PasswordToKey(snmpgo.Sha, "maplesyrup", engineId)[:16]
+	newKey = snmpgo.PasswordToKey(snmpgo.Sha, "newsyrup", engineId)[:16]
+	value, err := snmpgo.KeyChange(snmpgo.Sha, oldKey, newKey, nil)
+	if err != nil {
+		t.Fatalf("KeyChange() - has error %v", err)
+	}
+	if len(value) != 32 {
+		t.Errorf("KeyChange() - expected 32 octets, actual %d", len(value))
+	}
+	if key := applyKeyChange(sha1.New(), oldKey, value); !bytes.Equal(newKey, key) {
+		t.Errorf("KeyChange() - expected [%s], actual [%s]",
+			snmpgo.ToHexStr(newKey, " "), snmpgo.ToHexStr(key, " "))
+	}
+
+	// the master key of "maplesyrup" (RFC3414 A.3.1) is localized to the engineId
+	ku := []byte{
+		0x9f, 0xaf, 0x32, 0x83, 0x88, 0x4e, 0x92, 0x83,
+		0x4e, 0xbc, 0x98, 0x47, 0xd8, 0xed, 0xd9, 0x63,
+	}
+	value, err = snmpgo.KeyChange(snmpgo.Md5, ku, bytes.Repeat([]byte{0x22}, 16), engineId)
+	if err != nil {
+		t.Fatalf("KeyChange() - has error %v", err)
+	}
+	oldKey = snmpgo.PasswordToKey(snmpgo.Md5, "maplesyrup", engineId)
+	key := applyKeyChange(md5.New(), oldKey, value)
+	h := md5.New()
+	h.Write(bytes.Repeat([]byte{0x22}, 16))
+	h.Write(engineId)
+	h.Write(bytes.Repeat([]byte{0x22}, 16))
+	if expBuf = h.Sum(nil); !bytes.Equal(expBuf, key) {
+		t.Errorf("KeyChange() - expected [%s], actual [%s]",
+			snmpgo.ToHexStr(expBuf, " "), snmpgo.ToHexStr(key, " "))
+	}
+
+	if _, err = snmpgo.KeyChange("SHA256", oldKey, oldKey, nil); err == nil {
+		t.Error("KeyChange() - illegal protocol is accepted")
+	}
+	if _, err = snmpgo.KeyChange(snmpgo.Md5, oldKey, oldKey[:8], nil); err == nil {
+		t.Error("KeyChange() - keys of the different length are accepted")
+	}
+}
+
 func TestCipher(t *testing.T) {
 	original := []byte("my private message.")
 	password := "maplesyrup"
@@ -67,11 +164,128 @@ func TestCipher(t *testing.T) {
 	if err != nil {
 		t.Errorf("AES Decrypt err %v", err)
 	}
-	if bytes.Equal(original, result) {
+	if !bytes.Equal(original, result) {
 		t.Errorf("AES Encrypt, Decrypt - expected [%s], actual [%s]", original, result)
 	}
 }
 
+// RFC 3826 Section 3.1.2.1, the IV is engineBoots(4) || engineTime(4) || salt(8)
+func TestCipherAESKnownVector(t *testing.T) {
+	original := []byte("my private message of 32 octets.")
+	engineId := []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02}
+	key := snmpgo.PasswordToKey(snmpgo.Sha, "maplesyrup", engineId)
+
+	// AES-128-CFB, key 6695febc9288e36282235fc7151f1284, IV 000000640012d6870102030405060708
+	expPriv := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	expCipher := []byte{
+		0xd5, 0x94, 0xdf, 0x7f, 0xdf, 0xfe, 0x37, 0xad, 0x1a, 0xb7, 0xa2, 0xd6, 0xa9, 0x75, 0xe2, 0x72,
+		0xcd, 0x7a, 0xaa, 0x71, 0x33, 0x9e, 0x02, 0xe1, 0xd6, 0xaa, 0x28, 0xf4, 0x41, 0x35, 0x21, 0x91,
+	}
+
+	cipher, priv, err := snmpgo.EncryptAES(original, key, 100, 1234567, 0x0102030405060708)
+	if err != nil {
+		t.Fatalf("AES Encrypt err %v", err)
+	}
+	if !bytes.Equal(expPriv, priv) {
+		t.Errorf("AES Encrypt privParam - expected [%s], actual [%s]",
+			snmpgo.ToHexStr(expPriv, " "), snmpgo.ToHexStr(priv, " "))
+	}
+	if !bytes.Equal(expCipher, cipher) {
+		t.Errorf("AES Encrypt - expected [%s], actual [%s]",
+			snmpgo.ToHexStr(expCipher, " "), snmpgo.ToHexStr(cipher, " "))
+	}
+
+	result, err := snmpgo.DecryptAES(expCipher, key, expPriv, 100, 1234567)
+	if err != nil {
+		t.Fatalf("AES Decrypt err %v", err)
+	}
+	if !bytes.Equal(original, result) {
+		t.Errorf("AES Decrypt - expected [%s], actual [%s]", original, result)
+	}
+
+	// the engineBoots, engineTime and salt are all part of the IV
+	for _, p := range []struct{ boots, time int32 }{{101, 1234567}, {100, 1234568}} {
+		result, err = snmpgo.DecryptAES(expCipher, key, expPriv, p.boots, p.time)
+		if err != nil || bytes.Equal(original, result) {
+			t.Errorf("AES Decrypt - expected not to decrypt with %v, error %v", p, err)
+		}
+	}
+	result, err = snmpgo.DecryptAES(expCipher, key, []byte{1, 2, 3, 4, 5, 6, 7, 9}, 100, 1234567)
+	if err != nil || bytes.Equal(original, result) {
+		t.Errorf("AES Decrypt - expected not to decrypt with the other salt, error %v", err)
+	}
+}
+
+func TestUsmSaltGenerator(t *testing.T) {
+	original := []byte("my private message.")
+	salt := int64(0x0102030405060708)
+	args := &snmpgo.SNMPArguments{
+		Version:       snmpgo.V3,
+		UserName:      "myName",
+		SecurityLevel: snmpgo.AuthPriv,
+		AuthPassword:  "aaaaaaaa",
+		AuthProtocol:  snmpgo.Sha,
+		PrivPassword:  "bbbbbbbb",
+		SaltGenerator: func() int64 { return salt },
+	}
+
+	encrypt := func(privProtocol snmpgo.PrivProtocol) (privParam, pduBytes []byte) {
+		args.PrivProtocol = privProtocol
+		sec := snmpgo.ToUsm(snmpgo.NewSecurity(args))
+		sec.SetAuthEngineId([]byte{0x80, 0x00, 0x00, 0x00, 0x01})
+		snmpgo.SetUsmRemoteReference(sec)
+		sec.SynchronizeEngineBootsTime(100, 1234567)
+
+		pdu := snmpgo.NewPdu(snmpgo.V3, snmpgo.GetRequest)
+		pdu.SetRequestId(1)
+		msg := snmpgo.ToMessageV3(snmpgo.NewMessageWithPdu(snmpgo.V3, pdu))
+		msg.SetAuthentication(true)
+		msg.SetPrivacy(true)
+		if err := sec.GenerateRequestMessage(msg); err != nil {
+			t.Fatalf("GenerateRequestMessage() - has error %v", err)
+		}
+		return msg.PrivParameter, msg.PduBytes()
+	}
+
+	priv, _ := encrypt(snmpgo.Aes)
+	if exp := []byte{1, 2, 3, 4, 5, 6, 7, 8}; !bytes.Equal(priv, exp) {
+		t.Errorf("GenerateRequestMessage(Aes) - expected salt [%s], actual [%s]",
+			snmpgo.ToHexStr(exp, " "), snmpgo.ToHexStr(priv, " "))
+	}
+	priv, _ = encrypt(snmpgo.Des)
+	if exp := []byte{0, 0, 0, 100, 5, 6, 7, 8}; !bytes.Equal(priv, exp) {
+		t.Errorf("GenerateRequestMessage(Des) - expected salt [%s], actual [%s]",
+			snmpgo.ToHexStr(exp, " "), snmpgo.ToHexStr(priv, " "))
+	}
+
+	// injected salts are reproducible, and the different salts make the different ciphers
+	_, pdu1 := encrypt(snmpgo.Aes)
+	_, pdu2 := encrypt(snmpgo.Aes)
+	if !bytes.Equal(pdu1, pdu2) {
+		t.Error("GenerateRequestMessage() - the same salt makes a different cipher")
+	}
+	salt++
+	_, pdu2 = encrypt(snmpgo.Aes)
+	if bytes.Equal(pdu1, pdu2) {
+		t.Error("GenerateRequestMessage() - the different salts make the same cipher")
+	}
+
+	key := snmpgo.PasswordToKey(snmpgo.Sha, "bbbbbbbb", []byte{0x80, 0x00, 0x00, 0x00, 0x01})
+	for _, s := range []int64{1, 2} {
+		cipher, priv, err := snmpgo.EncryptAES(original, key, 100, 1234567, s)
+		if err != nil {
+			t.Fatalf("AES Encrypt err %v", err)
+		}
+		result, err := snmpgo.DecryptAES(cipher, key, priv, 100, 1234567)
+		if err != nil {
+			t.Fatalf("AES Decrypt err %v", err)
+		}
+		if !bytes.Equal(original, result[:len(original)]) {
+			t.Errorf("AES Encrypt, Decrypt - expected [%s], actual [%s]", original, result)
+		}
+	}
+}
+
 func TestCommunity(t *testing.T) {
 	expCom := "public"
 	sec := snmpgo.NewCommunity()
@@ -260,6 +474,115 @@ func TestUsm(t *testing.T) {
 	}
 }
 
+// truncatedPdu drops the trailing bytes of the marshaled Pdu
+type truncatedPdu struct {
+	*snmpgo.ScopedPdu
+	drop int
+}
+
+func (pdu *truncatedPdu) Marshal() ([]byte, error) {
+	b, err := pdu.ScopedPdu.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return b[:len(b)-pdu.drop], nil
+}
+
+func TestUsmPartialPdu(t *testing.T) {
+	expEngId := []byte{0x80, 0x00, 0x00, 0x00, 0x01}
+	sec := snmpgo.NewUsm()
+	sec.UserName = []byte("myUser")
+	sec.AuthProtocol = snmpgo.Md5
+	sec.AuthKey = snmpgo.PasswordToKey(snmpgo.Md5, "aaaaaaaa", expEngId)
+	sec.PrivProtocol = snmpgo.Des
+	sec.PrivKey = snmpgo.PasswordToKey(snmpgo.Md5, "bbbbbbbb", expEngId)
+
+	oid1, _ := snmpgo.NewOid("1.3.6.1.2.1.1.1.0")
+	oid2, _ := snmpgo.NewOid("1.3.6.1.2.1.1.5.0")
+	pdu := snmpgo.NewPdu(snmpgo.V3, snmpgo.GetResponse).(*snmpgo.ScopedPdu)
+	pdu.ContextEngineId = expEngId
+	pdu.SetRequestId(123)
+	pdu.AppendVarBind(oid1, snmpgo.NewOctetString([]byte("MyHost")))
+	pdu.AppendVarBind(oid2, snmpgo.NewOctetString([]byte("MyName")))
+
+	smsg := snmpgo.ToMessageV3(snmpgo.NewMessageWithPdu(snmpgo.V3, &truncatedPdu{pdu, 12}))
+	smsg.AuthEngineId = expEngId
+	smsg.SetAuthentication(true)
+	smsg.SetPrivacy(true)
+	if err := sec.GenerateRequestMessage(smsg); err != nil {
+		t.Fatalf("GenerateRequestMessage() - has error %v", err)
+	}
+	b, err := smsg.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() - has error %v", err)
+	}
+	msg, _, err := snmpgo.UnmarshalMessage(b)
+	if err != nil {
+		t.Fatalf("UnmarshalMessage() - has error %v", err)
+	}
+
+	err = sec.ProcessIncomingMessage(msg)
+	perr, ok := err.(*snmpgo.PartialPduError)
+	if !ok {
+		t.Fatalf("ProcessIncomingMessage() - expected PartialPduError, actual %v", err)
+	}
+	if perr.Cause == nil || !strings.Contains(perr.Error(), "Failed to Unmarshal Pdu") {
+		t.Errorf("ProcessIncomingMessage() - error message [%s]", perr)
+	}
+
+	partial := perr.Pdu.(*snmpgo.ScopedPdu)
+	if !bytes.Equal(partial.ContextEngineId, expEngId) {
+		t.Errorf("PartialPduError - expected [%s], actual [%s]",
+			snmpgo.ToHexStr(expEngId, ""), snmpgo.ToHexStr(partial.ContextEngineId, ""))
+	}
+	if partial.PduType() != snmpgo.GetResponse || partial.RequestId() != 123 {
+		t.Errorf("PartialPduError - unexpected Pdu header %s", partial)
+	}
+	if vbs := partial.VarBinds(); len(vbs) != 1 || !vbs[0].Oid.Equal(oid1) {
+		t.Errorf("PartialPduError - unexpected VarBinds %s", vbs)
+	}
+}
+
+func TestUsmDecryptionFailure(t *testing.T) {
+	const engineId = "8000000004736e6d70676f"
+	args := &snmpgo.SNMPArguments{
+		Version:          snmpgo.V3,
+		UserName:         "MyName",
+		SecurityLevel:    snmpgo.AuthPriv,
+		AuthPassword:     "aaaaaaaa",
+		AuthProtocol:     snmpgo.Sha,
+		PrivPassword:     "bbbbbbbb",
+		PrivProtocol:     snmpgo.Aes,
+		SecurityEngineId: engineId,
+		SaltGenerator:    func() int64 { return 1 },
+	}
+	pdu := snmpgo.NewPduWithVarBinds(snmpgo.V3, snmpgo.GetResponse, snmpgo.VarBinds{
+		snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100)),
+	})
+	b, err := snmpgo.EncodeMessage(args, pdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = snmpgo.DecodeMessage(snmpgo.V3, b, &snmpgo.SecurityEntry{
+		Version:       snmpgo.V3,
+		UserName:      "MyName",
+		SecurityLevel: snmpgo.AuthPriv,
+		AuthPassword:  "aaaaaaaa",
+		AuthProtocol:  snmpgo.Sha,
+		PrivPassword:  "cccccccc",
+		PrivProtocol:  snmpgo.Aes,
+	})
+	if err == nil {
+		t.Fatal("DecodeMessage() - expected error with the wrong PrivPassword")
+	}
+	for _, s := range []string{"decrypt", engineId, "MyName"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("DecodeMessage() - expected error to contain [%s], actual [%v]", s, err)
+		}
+	}
+}
+
 func TestUsmUpdateEngineBootsTime(t *testing.T) {
 	sec := snmpgo.NewUsm()
 
@@ -316,6 +639,60 @@ func TestUsmTimeliness(t *testing.T) {
 	if err != nil {
 		t.Errorf("Timeliness() - has error %v", err)
 	}
+
+	// the local notion of the engine time advances
+	now := time.Unix(1000000, 0)
+	snmpgo.SetUsmClock(sec, func() time.Time { return now })
+	sec.SynchronizeEngineBootsTime(0, 1000)
+	now = now.Add(200 * time.Second)
+	err = sec.CheckTimeliness(0, 1000)
+	if err == nil {
+		t.Error("Timeliness() - lose the elapsed authEngineTime")
+	}
+	err = sec.CheckTimeliness(0, 1050)
+	if err != nil {
+		t.Errorf("Timeliness() - has error %v", err)
+	}
+}
+
+func TestUsmClock(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	sec := snmpgo.NewUsm()
+	snmpgo.SetUsmClock(sec, func() time.Time { return now })
+	notInTimeWindow := reflect.TypeOf(snmpgo.NewNotInTimeWindowError())
+
+	sec.SynchronizeEngineBootsTime(1, 100)
+	now = now.Add(100 * time.Second)
+	if err := sec.CheckLocalTimeliness(1, 200); err != nil {
+		t.Errorf("CheckLocalTimeliness() - has error %v", err)
+	}
+	// the usm shared by the received messages is not updated
+	if sec.AuthEngineTime != 100 {
+		t.Errorf("CheckLocalTimeliness() - expected time 100, actual %d", sec.AuthEngineTime)
+	}
+
+	now = now.Add(1500 * time.Millisecond)
+	err := sec.CheckLocalTimeliness(1, 50)
+	if reflect.TypeOf(err) != notInTimeWindow {
+		t.Errorf("CheckLocalTimeliness() - expected not in time window, actual %v", err)
+	}
+	// the fraction of a second is carried over
+	now = now.Add(500 * time.Millisecond)
+	if err = sec.CheckLocalTimeliness(1, 353); reflect.TypeOf(err) != notInTimeWindow {
+		t.Errorf("CheckLocalTimeliness() - expected not in time window, actual %v", err)
+	}
+	if err = sec.CheckLocalTimeliness(1, 352); err != nil {
+		t.Errorf("CheckLocalTimeliness() - has error %v", err)
+	}
+
+	sec.SynchronizeEngineBootsTime(1, math.MaxInt32-5)
+	now = now.Add(10 * time.Second)
+	if err = sec.CheckLocalTimeliness(1, math.MaxInt32); reflect.TypeOf(err) != notInTimeWindow {
+		t.Errorf("CheckLocalTimeliness() - expected not in time window, actual %v", err)
+	}
+	if err = sec.CheckLocalTimeliness(2, 5); err != nil {
+		t.Errorf("CheckLocalTimeliness() - has error %v", err)
+	}
 }
 
 func TestSecurityMap(t *testing.T) {
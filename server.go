@@ -1,12 +1,15 @@
 package snmpgo
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"math"
 	"net"
-	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,6 +23,22 @@ type ServerArguments struct {
 	LocalAddr      string        // See net.Dial parameter
 	WriteTimeout   time.Duration // Timeout for writing a response (The default is 5sec)
 	MessageMaxSize int           // Maximum size of a SNMP message (The default is 2048)
+	MaxVarBinds    int           // Maximum number of VarBinds in a received message (The default is 10000)
+
+	// Engine ID of the server, which is authoritative for the received InformRequest.
+	// The SecurityEntry of the InformRequest sender must have this ID as SecurityEngineId.
+	// (V3 specific)
+	SecurityEngineId string
+	EngineBoots      int // Number of times the server engine has (re-)initialized (The default is 1, V3 specific)
+
+	// Set the SO_REUSEADDR and SO_REUSEPORT to the listening socket,
+	// so that another server can bind the same address (e.g. for a restart without downtime).
+	// It is ignored with NewTrapServerWithConn.
+	ReusePort bool
+
+	// Drop the traps matching no SecurityEntry (or of an unsupported version)
+	// instead of delivering them to the listener with the Error
+	RejectUnknown bool
 }
 
 func (a *ServerArguments) setDefault() {
@@ -32,6 +51,12 @@ func (a *ServerArguments) setDefault() {
 	if a.MessageMaxSize == 0 {
 		a.MessageMaxSize = maxTrapSize
 	}
+	if a.MaxVarBinds == 0 {
+		a.MaxVarBinds = maxVarBindsDefault
+	}
+	if a.EngineBoots == 0 {
+		a.EngineBoots = 1
+	}
 }
 
 func (a *ServerArguments) validate() error {
@@ -50,6 +75,31 @@ func (a *ServerArguments) validate() error {
 				msgSizeMinimum, math.MaxInt32),
 		}
 	}
+	if a.MaxVarBinds < 0 {
+		return &ArgumentError{
+			Value:   a.MaxVarBinds,
+			Message: "MaxVarBinds must be a non-negative integer",
+		}
+	}
+	if a.ReusePort && !reusePortSupported {
+		return &ArgumentError{
+			Value:   a.ReusePort,
+			Message: "ReusePort is not supported on this platform",
+		}
+	}
+	if a.SecurityEngineId != "" {
+		a.SecurityEngineId = stripHexPrefix(a.SecurityEngineId)
+		if _, err := engineIdToBytes(a.SecurityEngineId); err != nil {
+			return err
+		}
+	}
+	// RFC3414 Section 2.2.2, the boots of 2147483647 is not usable
+	if b := a.EngineBoots; b < 0 || b >= math.MaxInt32 {
+		return &ArgumentError{
+			Value:   b,
+			Message: fmt.Sprintf("EngineBoots is range %d..%d", 0, math.MaxInt32-1),
+		}
+	}
 
 	return nil
 }
@@ -78,44 +128,16 @@ func (a *SecurityEntry) validate() error {
 			Message: "Unsupported SNMP Version",
 		}
 	}
-	// TODO Refactor(this copied from `SNMPArguments.validate()`)
-	if a.Version == V3 {
-		// RFC3414 Section 5
-		if l := len(a.UserName); l < 1 || l > 32 {
-			return &ArgumentError{
-				Value:   a.UserName,
-				Message: "UserName length is range 1..32",
-			}
-		}
-		if a.SecurityLevel > NoAuthNoPriv {
-			// RFC3414 Section 11.2
-			if len(a.AuthPassword) < 8 {
-				return &ArgumentError{
-					Value:   a.AuthPassword,
-					Message: "AuthPassword is at least 8 characters in length",
-				}
-			}
-			if p := a.AuthProtocol; p != Md5 && p != Sha {
-				return &ArgumentError{
-					Value:   a.AuthProtocol,
-					Message: "Illegal AuthProtocol",
-				}
-			}
+	if a.Version == V2c {
+		if err := validateCommunity(a.Community); err != nil {
+			return err
 		}
-		if a.SecurityLevel > AuthNoPriv {
-			// RFC3414 Section 11.2
-			if len(a.PrivPassword) < 8 {
-				return &ArgumentError{
-					Value:   a.PrivPassword,
-					Message: "PrivPassword is at least 8 characters in length",
-				}
-			}
-			if p := a.PrivProtocol; p != Des && p != Aes {
-				return &ArgumentError{
-					Value:   a.PrivProtocol,
-					Message: "Illegal PrivProtocol",
-				}
-			}
+	}
+	if a.Version == V3 {
+		err := validateUsm(a.UserName, a.SecurityLevel,
+			a.AuthPassword, a.AuthProtocol, a.PrivPassword, a.PrivProtocol)
+		if err != nil {
+			return err
 		}
 		if a.SecurityEngineId != "" {
 			a.SecurityEngineId = stripHexPrefix(a.SecurityEngineId)
@@ -135,6 +157,7 @@ func (a *SecurityEntry) String() string {
 // TrapListener defines method that need to be implemented by Trap listeners.
 // If OnTRAP panics, the server (caller of OnTRAP) assumes that affect of the panic
 // is temporary and recovers by the panic and logs trace to the error log.
+// The panic does not affect the delivery to the other listeners.
 type TrapListener interface {
 	OnTRAP(trap *TrapRequest)
 }
@@ -147,15 +170,71 @@ type TrapRequest struct {
 	// The source address of trap
 	Source net.Addr
 
+	// The context of the ScopedPdu, which is empty except with SNMP V3
+	ContextEngineId string // hex string
+	ContextName     string
+
+	// The msgFlags of the message, which are all false except with SNMP V3
+	MessageFlags MessageFlags
+
 	// Error is an optional field used to indicate
 	// errors which may occur during the decoding
 	// of the received packet
 	Error error
 }
 
+// MessageFlags is the msgFlags of the SNMP V3 message (RFC3412 Section 6.4)
+type MessageFlags struct {
+	Authentication bool // authFlag
+	Privacy        bool // privFlag
+	Reportable     bool // reportableFlag, set on the confirmed class PDUs such as InformRequest
+}
+
+func (f MessageFlags) String() string {
+	return fmt.Sprintf(`{"Authentication": %t, "Privacy": %t, "Reportable": %t}`,
+		f.Authentication, f.Privacy, f.Reportable)
+}
+
+// Uptime returns the sysUpTime.0, which is the first VarBind of the notification.
+// Returns false if the PDU does not start with the sysUpTime.0 of the TimeTicks.
+func (t *TrapRequest) Uptime() (*TimeTicks, bool) {
+	vb := t.notificationVarBind(0, OidSysUpTime)
+	if vb == nil {
+		return nil, false
+	}
+	v, ok := vb.Variable.(*TimeTicks)
+	return v, ok
+}
+
+// TrapOid returns the snmpTrapOID.0, which is the second VarBind of the notification.
+// Returns false if the PDU does not follow with the snmpTrapOID.0 of the OBJECT IDENTIFIER.
+func (t *TrapRequest) TrapOid() (*Oid, bool) {
+	vb := t.notificationVarBind(1, OidSnmpTrap)
+	if vb == nil {
+		return nil, false
+	}
+	v, ok := vb.Variable.(*Oid)
+	return v, ok
+}
+
+// notificationVarBind returns the VarBind at the index if its OID is the oid (RFC3416 Section 4.2.6)
+func (t *TrapRequest) notificationVarBind(index int, oid *Oid) *VarBind {
+	if t.Pdu == nil {
+		return nil
+	}
+	varBinds := t.Pdu.VarBinds()
+	if len(varBinds) <= index || varBinds[index].Oid == nil || !varBinds[index].Oid.Equal(oid) {
+		return nil
+	}
+	return varBinds[index]
+}
+
 // A TrapServer defines parameters for running of TRAP daemon that listens for incoming
 // trap messages.
 type TrapServer struct {
+	malformed uint64 // accessed atomically, keep 64-bit aligned
+	unmatched uint64 // accessed atomically, keep 64-bit aligned
+	untimely  uint64 // accessed atomically, keep 64-bit aligned
 	args      *ServerArguments
 	mps       map[SNMPVersion]messageProcessing
 	secs      map[SNMPVersion]*securityMap
@@ -163,6 +242,16 @@ type TrapServer struct {
 	servingMu sync.RWMutex
 	serving   bool
 
+	listenersMu sync.RWMutex
+	listener    TrapListener   // passed to Serve
+	listeners   []TrapListener // registered by AddListener
+
+	// local engine for InformRequest (V3 specific)
+	engineId         []byte
+	startTime        time.Time
+	unknownEngineIds uint32 // accessed atomically
+	notInTimeWindows uint32 // accessed atomically
+
 	// Error Logger which will be used for logging of default errors
 	ErrorLog StdLogger
 }
@@ -171,10 +260,83 @@ func (s *TrapServer) AddSecurity(entry *SecurityEntry) error {
 	if err := entry.validate(); err != nil {
 		return err
 	}
-	s.secs[entry.Version].Set(newSecurityFromEntry(entry))
+	s.secs[entry.Version].Set(s.newSecurity(entry))
 	return nil
 }
 
+// SetSecurity replaces all the registered entries with the entries at once.
+// The entries are validated before replacing, if any of them is invalid,
+// the registered entries are left intact and the error is returned.
+// The state of the unchanged entries (e.g. the time of the remote engine) is kept.
+func (s *TrapServer) SetSecurity(entries []*SecurityEntry) error {
+	for _, entry := range entries {
+		if err := entry.validate(); err != nil {
+			return err
+		}
+	}
+
+	objs := make(map[SNMPVersion]map[string]security, len(s.secs))
+	for v := range s.secs {
+		objs[v] = map[string]security{}
+	}
+	for _, entry := range entries {
+		sec := s.newSecurity(entry)
+		objs[entry.Version][sec.Identifier()] = sec
+	}
+
+	// lock all the versions in a fixed order, so that no trap sees a part of the entries
+	versions := []SNMPVersion{V2c, V3}
+	for _, v := range versions {
+		s.secs[v].lock.Lock()
+	}
+	for _, v := range versions {
+		m := s.secs[v]
+		// keeps the engine boots and time of the unchanged entries
+		for id, sec := range objs[v] {
+			if old, ok := m.objs[id]; ok && sameSecurity(old, sec) {
+				objs[v][id] = old
+			}
+		}
+		m.objs = objs[v]
+	}
+	for _, v := range versions {
+		s.secs[v].lock.Unlock()
+	}
+	return nil
+}
+
+// sameSecurity returns true if the securities are created from the same entry
+func sameSecurity(a, b security) bool {
+	switch x := a.(type) {
+	case *community:
+		y, ok := b.(*community)
+		return ok && bytes.Equal(x.Community, y.Community)
+	case *usm:
+		y, ok := b.(*usm)
+		return ok && bytes.Equal(x.UserName, y.UserName) && bytes.Equal(x.AuthEngineId, y.AuthEngineId) &&
+			x.AuthPassword == y.AuthPassword && x.AuthProtocol == y.AuthProtocol &&
+			x.PrivPassword == y.PrivPassword && x.PrivProtocol == y.PrivProtocol
+	}
+	return false
+}
+
+// newSecurity creates the security of the validated entry
+func (s *TrapServer) newSecurity(entry *SecurityEntry) security {
+	// a diagnostic, which is logged only to the ErrorLog
+	if entry.Version == V3 && s.ErrorLog != nil {
+		if names := ignoredUsmCredentials(entry.SecurityLevel, entry.AuthPassword,
+			entry.AuthProtocol, entry.PrivPassword, entry.PrivProtocol); len(names) > 0 {
+			s.logf("snmpgo: SecurityLevel %s ignores %s", entry.SecurityLevel, strings.Join(names, ", "))
+		}
+	}
+	sec := newSecurityFromEntry(entry)
+	if u, ok := sec.(*usm); ok && s.engineId != nil && bytes.Equal(u.AuthEngineId, s.engineId) {
+		u.DiscoveryStatus = localReference
+		u.SynchronizeEngineBootsTime(s.engineBootsTime())
+	}
+	return sec
+}
+
 func (s *TrapServer) DeleteSecurity(entry *SecurityEntry) error {
 	if err := entry.validate(); err != nil {
 		return err
@@ -183,54 +345,97 @@ func (s *TrapServer) DeleteSecurity(entry *SecurityEntry) error {
 	return nil
 }
 
+// AddListener registers a listener that receives every trap
+// in addition to the listener passed to Serve.
+func (s *TrapServer) AddListener(listener TrapListener) error {
+	if listener == nil {
+		return &ArgumentError{Message: "listener is nil"}
+	}
+	s.listenersMu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.listenersMu.Unlock()
+	return nil
+}
+
 // Serve starts the SNMP trap receiver.
 // Serve blocks, the caller should call Close when finished, to shut it down.
+// The listener may be nil if the listeners are registered by AddListener.
 func (s *TrapServer) Serve(listener TrapListener) error {
-	if listener == nil {
+	if err := s.startServing(listener); err != nil {
+		return err
+	}
+	return s.serve()
+}
+
+func (s *TrapServer) startServing(listener TrapListener) error {
+	s.listenersMu.Lock()
+	s.listener = listener
+	n := len(s.listeners)
+	s.listenersMu.Unlock()
+	if listener == nil && n == 0 {
 		return &ArgumentError{Message: "listener is nil"}
 	}
 	s.servingMu.Lock()
 	s.serving = true
 	s.servingMu.Unlock()
-	size := s.args.MessageMaxSize
-	if size < recvBufferSize {
-		size = recvBufferSize
-	}
-
-	for {
-		conn, err := s.transport.Listen()
-		s.servingMu.RLock()
-		serving := s.serving
-		s.servingMu.RUnlock()
-		if !serving {
-			return nil
-		}
-		if err != nil {
-			if e, ok := err.(net.Error); ok && e.Temporary() {
-				continue
+	return nil
+}
+
+func (s *TrapServer) serve() error {
+	return serveTransport(s.transport, s.args.MessageMaxSize, s.isServing, s.logf, "trap",
+		func(conn interface{}, msg message, src net.Addr, err error) {
+			if err != nil {
+				atomic.AddUint64(&s.malformed, 1)
 			}
-			return err
-		}
+			go s.handle(conn, msg, src, err)
+		})
+}
 
-		go func(conn interface{}) {
-			defer s.transport.Close(conn)
-			buf := make([]byte, size)
-			for {
-				_, src, msg, err := s.transport.Read(conn, buf)
-				if _, ok := err.(net.Error); ok {
-					s.servingMu.RLock()
-					serving := s.serving
-					s.servingMu.RUnlock()
-					if serving {
-						s.logf("trap: failed to read packet: %v", err)
-					}
-					return
-				}
+// ServeContext is like Serve, but the server is closed when the ctx is canceled,
+// and returns the ctx.Err(). Closing the server unblocks the read loop immediately.
+func (s *TrapServer) ServeContext(ctx context.Context, listener TrapListener) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-				go s.handle(listener, conn, msg, src, err)
-			}
-		}(conn)
+	// started before watching the ctx, so that the cancel is not overwritten
+	if err := s.startServing(listener); err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-stop:
+		}
+	}()
+
+	err := s.serve()
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
+	return err
+}
+
+// MalformedPackets returns the number of received packets that could not be decoded.
+// The malformed packets are delivered to the listener as a TrapRequest with the Error.
+func (s *TrapServer) MalformedPackets() uint64 {
+	return atomic.LoadUint64(&s.malformed)
+}
+
+// UnmatchedTraps returns the number of received traps that matched no SecurityEntry,
+// including the traps of an unsupported version.
+func (s *TrapServer) UnmatchedTraps() uint64 {
+	return atomic.LoadUint64(&s.unmatched)
+}
+
+// NotInTimeWindowTraps returns the number of received V3 traps that were rejected
+// since they are not in the time window of the sender engine (e.g. the replayed traps).
+// The rejected traps are delivered to the listener as a TrapRequest with the Error.
+func (s *TrapServer) NotInTimeWindowTraps() uint64 {
+	return atomic.LoadUint64(&s.untimely)
 }
 
 // Close shuts down the server.
@@ -241,17 +446,15 @@ func (s *TrapServer) Close() error {
 	return s.transport.Close(nil)
 }
 
-// handle a newly received trap
-func (s *TrapServer) handle(listener TrapListener, conn interface{}, msg message, src net.Addr, err error) {
-	defer func() {
-		if err := recover(); err != nil {
-			const size = 64 << 10
-			logBuf := make([]byte, size)
-			logBuf = logBuf[:runtime.Stack(logBuf, false)]
-			s.logf("trap: panic while receiving %v: %v\n%s", src, err, logBuf)
+func (s *TrapServer) isServing() bool {
+	s.servingMu.RLock()
+	defer s.servingMu.RUnlock()
+	return s.serving
+}
 
-		}
-	}()
+// handle a newly received trap
+func (s *TrapServer) handle(conn interface{}, msg message, src net.Addr, err error) {
+	defer recoverPanic(s.logf, "trap: panic while receiving", src)
 
 	var pdu Pdu
 	var mp messageProcessing
@@ -259,14 +462,25 @@ func (s *TrapServer) handle(listener TrapListener, conn interface{}, msg message
 	if msg != nil {
 		var ok bool
 		v := msg.Version()
+		limitVarBinds(msg.Pdu(), s.args.MaxVarBinds)
 		if mp, ok = s.mps[v]; ok {
+			if s.isDiscovery(msg) {
+				s.reportUnknownEngineId(conn, src, mp, msg)
+				return
+			}
 			if sec = s.secs[v].Lookup(msg); sec != nil {
 				pdu, err = mp.PrepareDataElements(sec, msg, nil)
-			} else {
-				err = &MessageError{
-					Message: "Authentication failure",
-					Detail:  fmt.Sprintf("Message - [%s]", msg),
+				if e, ok := err.(*notInTimeWindowError); ok {
+					if u, ok := sec.(*usm); ok && u.DiscoveryStatus == localReference {
+						s.reportNotInTimeWindow(conn, src, mp, sec, msg)
+						return
+					}
+					// the trap of the remote engine, which is not reportable
+					atomic.AddUint64(&s.untimely, 1)
+					err = e.error
 				}
+			} else {
+				err = unmatchedSecurityError(msg)
 			}
 		} else {
 			err = &MessageError{
@@ -274,6 +488,12 @@ func (s *TrapServer) handle(listener TrapListener, conn interface{}, msg message
 				Detail:  fmt.Sprintf("Message - [%s]", msg),
 			}
 		}
+		if sec == nil {
+			atomic.AddUint64(&s.unmatched, 1)
+			if s.args.RejectUnknown {
+				return
+			}
+		}
 	}
 
 	if pdu != nil {
@@ -288,20 +508,124 @@ func (s *TrapServer) handle(listener TrapListener, conn interface{}, msg message
 		}
 	}
 
-	listener.OnTRAP(&TrapRequest{Pdu: pdu, Source: src, Error: err})
+	s.listenersMu.RLock()
+	listeners := s.listeners
+	if s.listener != nil {
+		listeners = append([]TrapListener{s.listener}, listeners...)
+	}
+	s.listenersMu.RUnlock()
+	var contextEngineId, contextName string
+	if p, ok := pdu.(*ScopedPdu); ok {
+		contextEngineId, contextName = toHexStr(p.ContextEngineId, ""), string(p.ContextName)
+	}
+	var flags MessageFlags
+	if m, ok := msg.(*messageV3); ok {
+		flags = MessageFlags{
+			Authentication: m.Authentication(),
+			Privacy:        m.Privacy(),
+			Reportable:     m.Reportable(),
+		}
+	}
+	for _, listener := range listeners {
+		s.dispatch(listener, &TrapRequest{
+			Pdu:             pdu,
+			Source:          src,
+			Error:           err,
+			ContextEngineId: contextEngineId,
+			ContextName:     contextName,
+			MessageFlags:    flags,
+		})
+	}
 
 	if pdu != nil && pdu.PduType() == InformRequest {
-		if err = s.informResponse(conn, src, mp, sec, msg); err != nil && s.serving {
+		if err = s.informResponse(conn, src, mp, sec, msg); err != nil && s.isServing() {
 			s.logf("trap: failed to send response %v: %v", src, err)
 		}
 	}
 }
 
+// unmatchedSecurityError returns the error describing why no SecurityEntry matches the message
+func unmatchedSecurityError(msg message) error {
+	var reason string
+	switch m := msg.(type) {
+	case *messageV1:
+		reason = "no SecurityEntry matches the community"
+	case *messageV3:
+		reason = fmt.Sprintf("no SecurityEntry matches the user name [%s] and the engine ID [%s]",
+			m.UserName, toHexStr(m.AuthEngineId, ""))
+		if m.Authentication() {
+			reason += " at the authenticated security level"
+		}
+	}
+	return &MessageError{
+		Message: fmt.Sprintf("Authentication failure, %s", reason),
+		Detail:  fmt.Sprintf("Message - [%s]", msg),
+	}
+}
+
 func (s *TrapServer) informResponse(
 	conn interface{}, src net.Addr, mp messageProcessing, sec security, msg message) error {
 
 	respPdu := NewPduWithVarBinds(msg.Version(), GetResponse, msg.Pdu().VarBinds())
-	respMsg, err := mp.PrepareResponseMessage(sec, respPdu, msg)
+	return s.respond(conn, src, mp, sec, msg, respPdu)
+}
+
+// isDiscovery returns true if the message is a request to discover the local engine
+func (s *TrapServer) isDiscovery(msg message) bool {
+	m, ok := msg.(*messageV3)
+	return ok && s.engineId != nil && m.Reportable() && len(m.AuthEngineId) == 0
+}
+
+// RFC3414 Section 3.2 3) b), reports the local engine ID to the discovery request
+func (s *TrapServer) reportUnknownEngineId(
+	conn interface{}, src net.Addr, mp messageProcessing, msg message) {
+
+	m := msg.(*messageV3)
+	if !m.Privacy() {
+		// try to get the request id
+		m.Pdu().Unmarshal(m.PduBytes())
+	}
+
+	sec := &usm{
+		UserName:        m.UserName,
+		AuthEngineId:    s.engineId,
+		DiscoveryStatus: localReference,
+	}
+	sec.SynchronizeEngineBootsTime(s.engineBootsTime())
+
+	n := atomic.AddUint32(&s.unknownEngineIds, 1)
+	if err := s.report(conn, src, mp, sec, msg, usmStatsUnknownEngineIDs, n); err != nil {
+		s.logf("trap: failed to send report %v: %v", src, err)
+	}
+}
+
+// RFC3414 Section 3.2 7) a), reports the local engine boots and time
+func (s *TrapServer) reportNotInTimeWindow(
+	conn interface{}, src net.Addr, mp messageProcessing, sec security, msg message) {
+
+	n := atomic.AddUint32(&s.notInTimeWindows, 1)
+	if err := s.report(conn, src, mp, sec, msg, usmStatsNotInTimeWindows, n); err != nil {
+		s.logf("trap: failed to send report %v: %v", src, err)
+	}
+}
+
+func (s *TrapServer) report(conn interface{}, src net.Addr, mp messageProcessing,
+	sec security, msg message, oid reportStatusOid, count uint32) error {
+
+	o, err := NewOid(string(oid))
+	if err != nil {
+		return err
+	}
+	repPdu := NewPduWithVarBinds(msg.Version(), Report, VarBinds{
+		NewVarBind(o, NewCounter32(count)),
+	})
+	return s.respond(conn, src, mp, sec, msg, repPdu)
+}
+
+func (s *TrapServer) respond(conn interface{}, src net.Addr, mp messageProcessing,
+	sec security, msg message, pdu Pdu) error {
+
+	respMsg, err := mp.PrepareResponseMessage(sec, pdu, msg)
 	if err != nil {
 		return err
 	}
@@ -312,6 +636,16 @@ func (s *TrapServer) informResponse(
 	return s.transport.Write(conn, pkt, src)
 }
 
+// dispatch a trap to the listener, isolating the panic of the listener
+func (s *TrapServer) dispatch(listener TrapListener, trap *TrapRequest) {
+	defer recoverPanic(s.logf, "trap: panic in listener while receiving", trap.Source)
+	listener.OnTRAP(trap)
+}
+
+func (s *TrapServer) engineBootsTime() (int64, int64) {
+	return int64(s.args.EngineBoots), int64(time.Since(s.startTime) / time.Second)
+}
+
 func (s *TrapServer) logf(format string, args ...interface{}) {
 	if l := s.ErrorLog; l != nil {
 		l.Printf(format, args...)
@@ -327,8 +661,15 @@ func NewTrapServer(args ServerArguments) (*TrapServer, error) {
 	}
 	args.setDefault()
 
+	var engineId []byte
+	if args.SecurityEngineId != "" {
+		engineId, _ = engineIdToBytes(args.SecurityEngineId)
+	}
+
 	return &TrapServer{
-		args: &args,
+		engineId:  engineId,
+		startTime: time.Now(),
+		args:      &args,
 		mps: map[SNMPVersion]messageProcessing{
 			V2c: newMessageProcessing(V2c),
 			V3:  newMessageProcessing(V3),
@@ -340,3 +681,20 @@ func NewTrapServer(args ServerArguments) (*TrapServer, error) {
 		transport: newTransport(&args),
 	}, nil
 }
+
+// NewTrapServerWithConn is like NewTrapServer, but receives on the already bound conn
+// (e.g. passed by the socket activation) instead of listening on the LocalAddr.
+// The conn is closed when the server is closed.
+func NewTrapServerWithConn(conn net.PacketConn, args ServerArguments) (*TrapServer, error) {
+	if conn == nil {
+		return nil, &ArgumentError{Message: "conn is nil"}
+	}
+	args.LocalAddr = conn.LocalAddr().String()
+
+	s, err := NewTrapServer(args)
+	if err != nil {
+		return nil, err
+	}
+	s.transport.(*packetTransport).boundConn = conn
+	return s, nil
+}
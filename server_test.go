@@ -1,8 +1,13 @@
 package snmpgo_test
 
 import (
+	"context"
+	"math/rand"
 	"net"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -54,7 +59,7 @@ func TestSendV2TrapAndReceiveIt(t *testing.T) {
 		t.Fatalf("expected trapv2, got: %s", pdu.PduType())
 	}
 
-	if !reflect.DeepEqual(pdu.VarBinds(), varBinds) {
+	if !reflect.DeepEqual(pdu.VarBinds()[1:], varBinds) {
 		t.Fatalf("expected pdu bindings %v, got %v", varBinds, pdu.VarBinds())
 	}
 }
@@ -99,7 +104,7 @@ func TestSendInformRequestAndReceiveIt(t *testing.T) {
 		t.Fatalf("expected inform, got: %s", pdu.PduType())
 	}
 
-	if !reflect.DeepEqual(pdu.VarBinds(), varBinds) {
+	if !reflect.DeepEqual(pdu.VarBinds()[1:], varBinds) {
 		t.Fatalf("expected pdu bindings %v, got %v", varBinds, pdu.VarBinds())
 	}
 }
@@ -173,7 +178,7 @@ func TestSendV3TrapAndReceiveIt(t *testing.T) {
 		t.Fatalf("expected trapv2, got: %s", pdu.PduType())
 	}
 
-	if !reflect.DeepEqual(pdu.VarBinds(), varBinds) {
+	if !reflect.DeepEqual(pdu.VarBinds()[1:], varBinds) {
 		t.Fatalf("expected pdu bindings %v, got %v", varBinds, pdu.VarBinds())
 	}
 
@@ -246,3 +251,1134 @@ func TestSendV3TimeWindow(t *testing.T) {
 		t.Fatal("turn back the engine time")
 	}
 }
+
+func TestTrapServerWithConn(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = snmpgo.NewTrapServerWithConn(nil, snmpgo.ServerArguments{}); err == nil {
+		t.Error("NewTrapServerWithConn() - nil conn")
+	}
+
+	s, err := snmpgo.NewTrapServerWithConn(conn, snmpgo.ServerArguments{})
+	if err != nil {
+		t.Fatalf("NewTrapServerWithConn() - has error %v", err)
+	}
+	s.AddSecurity(&snmpgo.SecurityEntry{
+		Version:   snmpgo.V2c,
+		Community: "public",
+	})
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest)}
+	go s.Serve(trapQueue)
+	defer s.Close()
+
+	if addr := snmpgo.ListeningUDPAddress(s); addr != conn.LocalAddr().String() {
+		t.Fatalf("listening address - expected [%s], actual [%s]", conn.LocalAddr(), addr)
+	}
+
+	var varBinds snmpgo.VarBinds
+	oid, _ := snmpgo.NewOid("1.3.6.1.6.3.1.1.5.3")
+	varBinds = append(varBinds, snmpgo.NewVarBind(snmpgo.OidSnmpTrap, oid))
+
+	trapSender := snmptest.NewTrapSender(t, conn.LocalAddr().String())
+	trapSender.SendV2TrapWithBindings(true, "public", varBinds)
+
+	trap := trapQueue.takeNextTrap()
+	if trap == nil {
+		t.Fatalf("trap is not received")
+	}
+	if trap.Error != nil {
+		t.Fatalf("trap has error: %v", trap.Error)
+	}
+}
+
+func TestTrapServerAddSecurity(t *testing.T) {
+	s, _ := snmpgo.NewTrapServer(snmpgo.ServerArguments{LocalAddr: "localhost:0"})
+
+	tests := []struct {
+		entry   snmpgo.SecurityEntry
+		invalid bool
+	}{
+		{snmpgo.SecurityEntry{Version: snmpgo.V2c, Community: "public"}, false},
+		{snmpgo.SecurityEntry{Version: snmpgo.V2c}, true},
+		{snmpgo.SecurityEntry{Version: snmpgo.V1, Community: "public"}, true},
+		{snmpgo.SecurityEntry{
+			Version:          snmpgo.V3,
+			UserName:         "MyName",
+			SecurityLevel:    snmpgo.AuthPriv,
+			AuthPassword:     "aaaaaaaa",
+			AuthProtocol:     snmpgo.Sha,
+			PrivPassword:     "bbbbbbbb",
+			PrivProtocol:     snmpgo.Aes,
+			SecurityEngineId: "0x8000000004736e6d70676f",
+		}, false},
+		{snmpgo.SecurityEntry{
+			Version:       snmpgo.V3,
+			UserName:      "MyName",
+			SecurityLevel: snmpgo.AuthNoPriv,
+			AuthPassword:  "aaaaaaa",
+			AuthProtocol:  snmpgo.Sha,
+		}, true},
+		{snmpgo.SecurityEntry{
+			Version:       snmpgo.V3,
+			UserName:      "MyName",
+			SecurityLevel: snmpgo.AuthNoPriv,
+			AuthPassword:  "aaaaaaaa",
+			AuthProtocol:  "SHA1",
+		}, true},
+		{snmpgo.SecurityEntry{
+			Version:       snmpgo.V3,
+			UserName:      "MyName",
+			SecurityLevel: snmpgo.SecurityLevel(3),
+		}, true},
+		{snmpgo.SecurityEntry{
+			Version:          snmpgo.V3,
+			UserName:         "MyName",
+			SecurityEngineId: "8000000004736e6d70676z",
+		}, true},
+		{snmpgo.SecurityEntry{
+			Version:          snmpgo.V3,
+			UserName:         "MyName",
+			SecurityEngineId: "80000000",
+		}, true},
+	}
+
+	for i, test := range tests {
+		err := s.AddSecurity(&test.entry)
+		if !test.invalid {
+			if err != nil {
+				t.Errorf("AddSecurity() [%d] - has error %v", i, err)
+			}
+			continue
+		}
+		if _, ok := err.(*snmpgo.ArgumentError); !ok {
+			t.Errorf("AddSecurity() [%d] - expected ArgumentError, actual %v", i, err)
+		}
+	}
+}
+
+func TestTrapServerSetSecurity(t *testing.T) {
+	s, err := snmpgo.NewTrapServer(snmpgo.ServerArguments{LocalAddr: "localhost:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.AddSecurity(&snmpgo.SecurityEntry{
+		Version:   snmpgo.V2c,
+		Community: "public",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest)}
+	go s.Serve(trapQueue)
+	defer s.Close()
+
+	sendTrap := func(community string) *snmpgo.TrapRequest {
+		snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+			Version:   snmpgo.V2c,
+			Address:   snmpgo.ListeningUDPAddress(s),
+			Community: community,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer snmp.Close()
+		varBinds := snmpgo.VarBinds{snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp)}
+		if err = snmp.V2Trap(varBinds); err != nil {
+			t.Fatal(err)
+		}
+		trap := trapQueue.takeNextTrap()
+		if trap == nil {
+			t.Fatalf("trap is not received - community %s", community)
+		}
+		return trap
+	}
+
+	// an invalid entry in the batch leaves the registered entries intact
+	err = s.SetSecurity([]*snmpgo.SecurityEntry{
+		{Version: snmpgo.V2c, Community: "private"},
+		{Version: snmpgo.V1, Community: "public"},
+	})
+	if _, ok := err.(*snmpgo.ArgumentError); !ok {
+		t.Errorf("SetSecurity() - expected ArgumentError, actual %v", err)
+	}
+	if trap := sendTrap("public"); trap.Error != nil {
+		t.Errorf("trap has error: %v", trap.Error)
+	}
+	if trap := sendTrap("private"); trap.Error == nil {
+		t.Error("trap of the community in the invalid batch is accepted")
+	}
+
+	err = s.SetSecurity([]*snmpgo.SecurityEntry{
+		{Version: snmpgo.V2c, Community: "private"},
+		{
+			Version:       snmpgo.V3,
+			UserName:      "MyName",
+			SecurityLevel: snmpgo.NoAuthNoPriv,
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetSecurity() - has error %v", err)
+	}
+	if trap := sendTrap("private"); trap.Error != nil {
+		t.Errorf("trap has error: %v", trap.Error)
+	}
+	if trap := sendTrap("public"); trap.Error == nil {
+		t.Error("trap of the replaced community is accepted")
+	}
+}
+
+func TestSendRandomPacketsBeforeTrap(t *testing.T) {
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest)}
+	s := snmptest.NewTrapServer("localhost:0", trapQueue)
+	defer s.Close()
+
+	conn, err := net.Dial("udp4", snmpgo.ListeningUDPAddress(s))
+	if err != nil {
+		t.Fatalf("dial error %v", err)
+	}
+	defer conn.Close()
+
+	r := rand.New(rand.NewSource(1))
+	packets := [][]byte{
+		{0x30},
+		{0x30, 0x84, 0xff, 0xff, 0xff, 0xff},
+		{0x30, 0x03, 0x02, 0x01, 0x01},
+	}
+	for i := 0; i < 20; i++ {
+		buf := make([]byte, 1+r.Intn(256))
+		r.Read(buf)
+		packets = append(packets, buf)
+	}
+	for _, buf := range packets {
+		if _, err = conn.Write(buf); err != nil {
+			t.Fatalf("send packet error %v", err)
+		}
+	}
+
+	var varBinds snmpgo.VarBinds
+	varBinds = append(varBinds, snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp))
+	trapSender := snmptest.NewTrapSender(t, snmpgo.ListeningUDPAddress(s))
+	trapSender.SendV2TrapWithBindings(true, "public", varBinds)
+
+	for i := 0; i <= len(packets); i++ {
+		trap := trapQueue.takeNextTrap()
+		if trap == nil {
+			t.Fatalf("valid trap is not received")
+		}
+		if trap.Error == nil {
+			if !reflect.DeepEqual(trap.Pdu.VarBinds()[1:], varBinds) {
+				t.Errorf("expected pdu bindings %v, got %v", varBinds, trap.Pdu.VarBinds())
+			}
+			if n := s.MalformedPackets(); n != uint64(len(packets)) {
+				t.Errorf("MalformedPackets() - expected %d, actual %d", len(packets), n)
+			}
+			return
+		}
+	}
+	t.Fatal("valid trap is not received")
+}
+
+func TestSendV3InformRequestAndReceiveIt(t *testing.T) {
+	const engineId = "8000000004736e6d70676f"
+	s, err := snmpgo.NewTrapServer(snmpgo.ServerArguments{
+		LocalAddr:        "localhost:0",
+		SecurityEngineId: engineId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddSecurity(&snmpgo.SecurityEntry{
+		Version:          snmpgo.V3,
+		UserName:         "MyName",
+		SecurityLevel:    snmpgo.AuthPriv,
+		AuthPassword:     "aaaaaaaa",
+		AuthProtocol:     snmpgo.Sha,
+		PrivPassword:     "bbbbbbbb",
+		PrivProtocol:     snmpgo.Aes,
+		SecurityEngineId: engineId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest, 1)}
+	go s.Serve(trapQueue)
+	defer s.Close()
+
+	varBinds := snmpgo.VarBinds{snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp)}
+
+	// discovers the engine of the server (with the DiscoveryOid), or uses the configured engine id
+	for _, c := range []struct{ secEngineId, discoveryOid string }{
+		{"", ""}, {engineId, ""}, {"", "1.3.6.1.2.1.1.2.0"},
+	} {
+		secEngineId := c.secEngineId
+		snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+			Version:          snmpgo.V3,
+			Address:          snmpgo.ListeningUDPAddress(s),
+			Network:          "udp4",
+			Timeout:          time.Second,
+			UserName:         "MyName",
+			SecurityLevel:    snmpgo.AuthPriv,
+			AuthPassword:     "aaaaaaaa",
+			AuthProtocol:     snmpgo.Sha,
+			PrivPassword:     "bbbbbbbb",
+			PrivProtocol:     snmpgo.Aes,
+			SecurityEngineId: secEngineId,
+			DiscoveryOid:     c.discoveryOid,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = snmp.InformRequest(varBinds); err != nil {
+			t.Errorf("InformRequest() - engine id [%s], has error %v", secEngineId, err)
+		}
+		snmp.Close()
+
+		trap := trapQueue.takeNextTrap()
+		if trap == nil {
+			t.Fatalf("inform is not received")
+		}
+		if trap.Error != nil {
+			t.Fatalf("inform has error: %v", trap.Error)
+		}
+		if trap.Pdu.PduType() != snmpgo.InformRequest {
+			t.Errorf("expected inform, got: %s", trap.Pdu.PduType())
+		}
+		if !reflect.DeepEqual(trap.Pdu.VarBinds()[1:], varBinds) {
+			t.Errorf("expected pdu bindings %v, got %v", varBinds, trap.Pdu.VarBinds())
+		}
+		exp := snmpgo.MessageFlags{Authentication: true, Privacy: true, Reportable: true}
+		if trap.MessageFlags != exp {
+			t.Errorf("MessageFlags - expected %v, actual %v", exp, trap.MessageFlags)
+		}
+	}
+}
+
+func TestSendV3InformRequestConcurrently(t *testing.T) {
+	const engineId = "8000000004736e6d70676f"
+	const senders, informs = 4, 5
+	s, err := snmpgo.NewTrapServer(snmpgo.ServerArguments{
+		LocalAddr:        "localhost:0",
+		SecurityEngineId: engineId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddSecurity(&snmpgo.SecurityEntry{
+		Version:          snmpgo.V3,
+		UserName:         "MyName",
+		SecurityLevel:    snmpgo.AuthNoPriv,
+		AuthPassword:     "aaaaaaaa",
+		AuthProtocol:     snmpgo.Sha,
+		SecurityEngineId: engineId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest, senders*informs)}
+	go s.Serve(trapQueue)
+	defer s.Close()
+
+	// the informs of the same user are checked and acknowledged in parallel
+	varBinds := snmpgo.VarBinds{snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp)}
+	errs := make(chan error, senders*informs)
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+			Version:          snmpgo.V3,
+			Address:          snmpgo.ListeningUDPAddress(s),
+			Network:          "udp4",
+			Timeout:          time.Second,
+			UserName:         "MyName",
+			SecurityLevel:    snmpgo.AuthNoPriv,
+			AuthPassword:     "aaaaaaaa",
+			AuthProtocol:     snmpgo.Sha,
+			SecurityEngineId: engineId,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer snmp.Close()
+			for j := 0; j < informs; j++ {
+				errs <- snmp.InformRequest(varBinds)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("InformRequest() - has error %v", err)
+		}
+	}
+	for i := 0; i < senders*informs; i++ {
+		if trap := trapQueue.takeNextTrap(); trap == nil || trap.Error != nil {
+			t.Fatalf("inform is not received: %v", trap)
+		}
+	}
+}
+
+func TestTrapServerNotInTimeWindow(t *testing.T) {
+	const engineId = "8000000004736e6d70676f"
+	s, err := snmpgo.NewTrapServer(snmpgo.ServerArguments{
+		LocalAddr: "localhost:0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &snmpgo.SecurityEntry{
+		Version:          snmpgo.V3,
+		UserName:         "MyName",
+		SecurityLevel:    snmpgo.AuthPriv,
+		AuthPassword:     "aaaaaaaa",
+		AuthProtocol:     snmpgo.Sha,
+		PrivPassword:     "bbbbbbbb",
+		PrivProtocol:     snmpgo.Aes,
+		SecurityEngineId: engineId,
+	}
+	if err = s.AddSecurity(entry); err != nil {
+		t.Fatal(err)
+	}
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest, 1)}
+	go s.Serve(trapQueue)
+	defer s.Close()
+
+	conn, err := net.Dial("udp", snmpgo.ListeningUDPAddress(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	send := func(engineTime int) *snmpgo.TrapRequest {
+		pdu := snmpgo.NewPduWithVarBinds(snmpgo.V3, snmpgo.SNMPTrapV2, snmpgo.VarBinds{
+			snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp),
+		})
+		b, err := snmpgo.EncodeMessage(&snmpgo.SNMPArguments{
+			Version:          snmpgo.V3,
+			UserName:         "MyName",
+			SecurityLevel:    snmpgo.AuthPriv,
+			AuthPassword:     "aaaaaaaa",
+			AuthProtocol:     snmpgo.Sha,
+			PrivPassword:     "bbbbbbbb",
+			PrivProtocol:     snmpgo.Aes,
+			SecurityEngineId: engineId,
+			EngineBoots:      1,
+			EngineTime:       engineTime,
+		}, pdu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = conn.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		trap := trapQueue.takeNextTrap()
+		if trap == nil {
+			t.Fatal("trap is not received")
+		}
+		return trap
+	}
+
+	if trap := send(1000); trap.Error != nil {
+		t.Fatalf("trap has error: %v", trap.Error)
+	}
+	// within the time window
+	if trap := send(900); trap.Error != nil {
+		t.Errorf("trap has error: %v", trap.Error)
+	}
+	if n := s.NotInTimeWindowTraps(); n != 0 {
+		t.Errorf("NotInTimeWindowTraps() - expected 0, actual %d", n)
+	}
+
+	// replayed with the old engine time
+	if trap := send(800); trap.Error == nil || trap.Pdu != nil {
+		t.Errorf("trap is not rejected: %v", trap.Pdu)
+	}
+	if n := s.NotInTimeWindowTraps(); n != 1 {
+		t.Errorf("NotInTimeWindowTraps() - expected 1, actual %d", n)
+	}
+
+	// the engine time is kept by setting the same entry
+	if err = s.SetSecurity([]*snmpgo.SecurityEntry{entry}); err != nil {
+		t.Fatalf("SetSecurity() - has error %v", err)
+	}
+	if trap := send(800); trap.Error == nil || trap.Pdu != nil {
+		t.Errorf("trap is not rejected after SetSecurity(): %v", trap.Pdu)
+	}
+	if n := s.NotInTimeWindowTraps(); n != 2 {
+		t.Errorf("NotInTimeWindowTraps() - expected 2, actual %d", n)
+	}
+}
+
+func TestTrapRequestUptimeAndTrapOid(t *testing.T) {
+	trap := &snmpgo.TrapRequest{
+		Pdu: snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.SNMPTrapV2, snmpgo.VarBinds{
+			snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(12345)),
+			snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp),
+		}),
+	}
+	if v, ok := trap.Uptime(); !ok || v.Value != 12345 {
+		t.Errorf("Uptime() - expected [12345], actual [%v], %t", v, ok)
+	}
+	if v, ok := trap.TrapOid(); !ok || !v.Equal(snmpgo.OidLinkUp) {
+		t.Errorf("TrapOid() - expected [%s], actual [%v], %t", snmpgo.OidLinkUp, v, ok)
+	}
+
+	for i, varBinds := range []snmpgo.VarBinds{
+		nil,
+		// swapped
+		{
+			snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp),
+			snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(12345)),
+		},
+		// wrong types
+		{
+			snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewInteger(12345)),
+			snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.NewOctetString([]byte("linkUp"))),
+		},
+	} {
+		trap.Pdu = snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.SNMPTrapV2, varBinds)
+		if v, ok := trap.Uptime(); ok {
+			t.Errorf("Uptime() [%d] - expected false, actual [%v]", i, v)
+		}
+		if v, ok := trap.TrapOid(); ok {
+			t.Errorf("TrapOid() [%d] - expected false, actual [%v]", i, v)
+		}
+	}
+
+	trap = &snmpgo.TrapRequest{Error: &snmpgo.MessageError{Message: "malformed"}}
+	if _, ok := trap.Uptime(); ok {
+		t.Error("Uptime() - expected false without the PDU")
+	}
+	if _, ok := trap.TrapOid(); ok {
+		t.Error("TrapOid() - expected false without the PDU")
+	}
+}
+
+func TestTrapServerContext(t *testing.T) {
+	const engineId = "8000000004736e6d70676f"
+	s, err := snmpgo.NewTrapServer(snmpgo.ServerArguments{
+		LocalAddr: "localhost:0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddSecurity(&snmpgo.SecurityEntry{
+		Version:          snmpgo.V3,
+		UserName:         "MyName",
+		SecurityLevel:    snmpgo.AuthPriv,
+		AuthPassword:     "aaaaaaaa",
+		AuthProtocol:     snmpgo.Sha,
+		PrivPassword:     "bbbbbbbb",
+		PrivProtocol:     snmpgo.Aes,
+		SecurityEngineId: engineId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest, 1)}
+	go s.Serve(trapQueue)
+	defer s.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:          snmpgo.V3,
+		Address:          snmpgo.ListeningUDPAddress(s),
+		Network:          "udp4",
+		UserName:         "MyName",
+		SecurityLevel:    snmpgo.AuthPriv,
+		AuthPassword:     "aaaaaaaa",
+		AuthProtocol:     snmpgo.Sha,
+		PrivPassword:     "bbbbbbbb",
+		PrivProtocol:     snmpgo.Aes,
+		SecurityEngineId: engineId,
+		ContextName:      "vlan10",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	if err = snmp.V2Trap(snmpgo.VarBinds{snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp)}); err != nil {
+		t.Fatal(err)
+	}
+	trap := trapQueue.takeNextTrap()
+	if trap == nil {
+		t.Fatal("trap is not received")
+	}
+	if trap.Error != nil {
+		t.Fatalf("trap has error: %v", trap.Error)
+	}
+	if trap.ContextName != "vlan10" {
+		t.Errorf("ContextName - expected [vlan10], actual [%s]", trap.ContextName)
+	}
+	if trap.ContextEngineId != engineId {
+		t.Errorf("ContextEngineId - expected [%s], actual [%s]", engineId, trap.ContextEngineId)
+	}
+	// the trap is not reportable
+	if exp := (snmpgo.MessageFlags{Authentication: true, Privacy: true}); trap.MessageFlags != exp {
+		t.Errorf("MessageFlags - expected %v, actual %v", exp, trap.MessageFlags)
+	}
+}
+
+func TestSNMPSecurityEngineId(t *testing.T) {
+	const engineId = "8000000004736e6d70676f"
+	s, err := snmpgo.NewTrapServer(snmpgo.ServerArguments{
+		LocalAddr:        "localhost:0",
+		SecurityEngineId: engineId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddSecurity(&snmpgo.SecurityEntry{
+		Version:          snmpgo.V3,
+		UserName:         "MyName",
+		SecurityLevel:    snmpgo.NoAuthNoPriv,
+		SecurityEngineId: engineId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(&receiveQueue{make(chan *snmpgo.TrapRequest, 1)})
+	defer s.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:       snmpgo.V3,
+		Address:       snmpgo.ListeningUDPAddress(s),
+		Network:       "udp4",
+		Timeout:       time.Second,
+		UserName:      "MyName",
+		SecurityLevel: snmpgo.NoAuthNoPriv,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	if id := snmp.SecurityEngineId(); id != "" {
+		t.Errorf("SecurityEngineId() - expected empty before Open(), actual [%s]", id)
+	}
+	if err = snmp.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if id := snmp.SecurityEngineId(); id != engineId {
+		t.Errorf("SecurityEngineId() - expected [%s], actual [%s]", engineId, id)
+	}
+	if snmp.Authoritative() {
+		t.Error("Authoritative() - expected false with the discovered engine")
+	}
+	if str := snmp.String(); !strings.Contains(str, engineId) {
+		t.Errorf("String() - expected to contain [%s], actual %s", engineId, str)
+	}
+
+	trapSnmp, _ := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:          snmpgo.V3,
+		Address:          snmpgo.ListeningUDPAddress(s),
+		UserName:         "MyName",
+		SecurityLevel:    snmpgo.NoAuthNoPriv,
+		SecurityEngineId: engineId,
+	})
+	defer trapSnmp.Close()
+	if trapSnmp.Authoritative() {
+		t.Error("Authoritative() - expected false before sending")
+	}
+	if err = trapSnmp.SendTrap(0, snmpgo.OidColdStart, snmpgo.VarBinds{}); err != nil {
+		t.Fatal(err)
+	}
+	if !trapSnmp.Authoritative() {
+		t.Error("Authoritative() - expected true after sending the trap")
+	}
+}
+
+func TestSendV2TrapOverIPv6(t *testing.T) {
+	if conn, err := net.ListenPacket("udp6", "[::1]:0"); err != nil {
+		t.Skipf("IPv6 loopback is not available: %v", err)
+	} else {
+		conn.Close()
+	}
+
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest)}
+	s := snmptest.NewTrapServer("[::1]:0", trapQueue)
+	defer s.Close()
+
+	address := snmpgo.ListeningUDPAddress(s)
+	if host, _, err := net.SplitHostPort(address); err != nil || host != "::1" {
+		t.Fatalf("unexpected listening address %s", address)
+	}
+
+	varBinds := snmpgo.VarBinds{snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidColdStart)}
+	trapSender := snmptest.NewTrapSender(t, address)
+	trapSender.SendV2TrapWithBindings(true, "public", varBinds)
+
+	trap := trapQueue.takeNextTrap()
+	if trap == nil {
+		t.Fatalf("trap is not received")
+	}
+	if trap.Error != nil {
+		t.Fatalf("trap has error: %v", trap.Error)
+	}
+	if !reflect.DeepEqual(trap.Pdu.VarBinds()[1:], varBinds) {
+		t.Fatalf("expected pdu bindings %v, got %v", varBinds, trap.Pdu.VarBinds())
+	}
+	if host, _, _ := net.SplitHostPort(trap.Source.String()); host != "::1" {
+		t.Errorf("unexpected source address %v", trap.Source)
+	}
+}
+
+type panicListener struct{}
+
+func (l *panicListener) OnTRAP(trap *snmpgo.TrapRequest) {
+	panic("listener is broken")
+}
+
+func TestTrapServerAddListener(t *testing.T) {
+	s := snmptest.NewTrapServer("localhost:0", &panicListener{})
+	defer s.Close()
+
+	queues := []*receiveQueue{
+		{make(chan *snmpgo.TrapRequest, 1)},
+		{make(chan *snmpgo.TrapRequest, 1)},
+	}
+	for _, q := range queues {
+		if err := s.AddListener(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddListener(nil); err == nil {
+		t.Error("AddListener() - nil listener")
+	}
+
+	oid, _ := snmpgo.NewOid("1.3.6.1.6.3.1.1.5.3")
+	varBinds := snmpgo.VarBinds{snmpgo.NewVarBind(snmpgo.OidSnmpTrap, oid)}
+	trapSender := snmptest.NewTrapSender(t, snmpgo.ListeningUDPAddress(s))
+	trapSender.SendV2TrapWithBindings(true, "public", varBinds)
+
+	for i, q := range queues {
+		trap := q.takeNextTrap()
+		if trap == nil {
+			t.Fatalf("[%d] trap is not received", i)
+		}
+		if trap.Error != nil {
+			t.Fatalf("[%d] trap has error: %v", i, trap.Error)
+		}
+		if !reflect.DeepEqual(trap.Pdu.VarBinds()[1:], varBinds) {
+			t.Errorf("[%d] expected pdu bindings %v, got %v", i, varBinds, trap.Pdu.VarBinds())
+		}
+	}
+}
+
+func TestTrapServerMaxVarBinds(t *testing.T) {
+	s, err := snmpgo.NewTrapServer(snmpgo.ServerArguments{
+		LocalAddr:   "localhost:0",
+		MaxVarBinds: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddSecurity(&snmpgo.SecurityEntry{
+		Version:   snmpgo.V2c,
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest, 1)}
+	go s.Serve(trapQueue)
+	defer s.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   snmpgo.ListeningUDPAddress(s),
+		Network:   "udp",
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	for _, n := range []int{11, 10} {
+		varBinds := snmpgo.VarBinds{
+			snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(0)),
+			snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp),
+		}
+		for len(varBinds) < n {
+			varBinds = append(varBinds, snmpgo.NewVarBind(snmpgo.OidIfIndex, snmpgo.NewInteger(1)))
+		}
+		if err = snmp.V2Trap(varBinds); err != nil {
+			t.Fatal(err)
+		}
+
+		trap := trapQueue.takeNextTrap()
+		if trap == nil {
+			t.Fatal("trap is not received")
+		}
+		if n > 10 {
+			if trap.Error == nil || !strings.Contains(trap.Error.Error(), "exceeds the limit of 10") {
+				t.Errorf("expected the limit error, actual %v", trap.Error)
+			}
+		} else if trap.Error != nil || len(trap.Pdu.VarBinds()) != n {
+			t.Errorf("expected %d varbinds, actual %v, error %v", n, trap.Pdu, trap.Error)
+		}
+	}
+}
+
+func TestTrapServerUnmatchedTraps(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		s, err := snmpgo.NewTrapServer(snmpgo.ServerArguments{
+			LocalAddr:     "localhost:0",
+			RejectUnknown: reject,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.AddSecurity(&snmpgo.SecurityEntry{
+			Version:   snmpgo.V2c,
+			Community: "public",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest, 3)}
+		go s.Serve(trapQueue)
+
+		argsList := []snmpgo.SNMPArguments{
+			{Version: snmpgo.V2c, Community: "private"},
+			{
+				Version:          snmpgo.V3,
+				UserName:         "Unknown",
+				SecurityLevel:    snmpgo.NoAuthNoPriv,
+				SecurityEngineId: "8000000004736e6d70676f",
+			},
+			{Version: snmpgo.V2c, Community: "public"},
+		}
+		expErrors := []string{"community", "user name"}
+		varBinds := snmpgo.VarBinds{snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp)}
+
+		for i, args := range argsList {
+			args.Address = snmpgo.ListeningUDPAddress(s)
+			snmp, err := snmpgo.NewSNMP(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = snmp.V2Trap(varBinds); err != nil {
+				t.Fatal(err)
+			}
+			snmp.Close()
+
+			if reject && i < len(expErrors) {
+				continue
+			}
+			trap := trapQueue.takeNextTrap()
+			if trap == nil {
+				t.Fatalf("trap is not received - reject %v, args %v", reject, args)
+			}
+			if i < len(expErrors) {
+				if trap.Error == nil || !strings.Contains(trap.Error.Error(), expErrors[i]) {
+					t.Errorf("expected the unmatched error of %s, actual %v", expErrors[i], trap.Error)
+				}
+			} else if trap.Error != nil {
+				t.Errorf("trap has error: %v", trap.Error)
+			}
+		}
+
+		// the traps are handled concurrently
+		for i := 0; i < 100 && s.UnmatchedTraps() < 2; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := s.UnmatchedTraps(); n != 2 {
+			t.Errorf("UnmatchedTraps() - reject %v, expected 2, actual %d", reject, n)
+		}
+		if reject && len(trapQueue.msg) > 0 {
+			t.Errorf("unmatched trap is delivered - %v", <-trapQueue.msg)
+		}
+		s.Close()
+	}
+}
+
+func TestSendV2TrapLeadingVarBinds(t *testing.T) {
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest, 1)}
+	s := snmptest.NewTrapServer("localhost:0", trapQueue)
+	defer s.Close()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   snmpgo.ListeningUDPAddress(s),
+		Network:   "udp",
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	uptime := snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(100))
+	trapOid := snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp)
+	extra := snmpgo.NewVarBind(snmpgo.OidIfIndex, snmpgo.NewInteger(1))
+
+	varBinds := snmpgo.VarBinds{uptime, trapOid, extra}
+	if err = snmp.V2Trap(varBinds); err != nil {
+		t.Fatal(err)
+	}
+	trap := trapQueue.takeNextTrap()
+	if trap == nil {
+		t.Fatal("trap is not received")
+	}
+	if !reflect.DeepEqual(trap.Pdu.VarBinds(), varBinds) {
+		t.Errorf("expected pdu bindings %v, got %v", varBinds, trap.Pdu.VarBinds())
+	}
+
+	invalids := []snmpgo.VarBinds{
+		{},
+		{uptime},
+		{uptime, extra},
+		{extra, trapOid},
+		{uptime, extra, trapOid},
+		{trapOid, uptime},
+		{snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewInteger(100)), trapOid},
+		{uptime, snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.NewOctetString([]byte("linkUp")))},
+	}
+	for _, v := range invalids {
+		if err = snmp.V2Trap(v); err == nil {
+			t.Errorf("V2Trap() - no error with the leading varbinds %v", v)
+		} else if _, ok := err.(*snmpgo.ArgumentError); !ok {
+			t.Errorf("V2Trap() - expected ArgumentError, actual %T", err)
+		}
+	}
+}
+
+func TestTrapServerReusePort(t *testing.T) {
+	args := snmpgo.ServerArguments{
+		LocalAddr: "127.0.0.1:0",
+		ReusePort: true,
+	}
+	s1, err := snmpgo.NewTrapServer(args)
+	if err != nil {
+		t.Skipf("ReusePort - not supported: %v", err)
+	}
+	go s1.Serve(&receiveQueue{make(chan *snmpgo.TrapRequest, 1)})
+	defer s1.Close()
+	args.LocalAddr = snmpgo.ListeningUDPAddress(s1)
+	if args.LocalAddr == "" {
+		t.Fatal("first server is not listening")
+	}
+
+	for _, reuse := range []bool{false, true} {
+		args.ReusePort = reuse
+		s2, err := snmpgo.NewTrapServer(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errCh := make(chan error, 1)
+		go func() { errCh <- s2.Serve(&receiveQueue{make(chan *snmpgo.TrapRequest, 1)}) }()
+
+		if !reuse {
+			select {
+			case err = <-errCh:
+			case <-time.After(2 * time.Second):
+			}
+			s2.Close()
+			if err == nil {
+				t.Error("second server without ReusePort - expected a bind error")
+			}
+			continue
+		}
+		addr := snmpgo.ListeningUDPAddress(s2)
+		s2.Close()
+		if addr != args.LocalAddr {
+			t.Errorf("second server with ReusePort - expected to listen on %s, actual [%s], error %v",
+				args.LocalAddr, addr, <-errCh)
+		}
+	}
+}
+
+func TestSNMPInformRequestAck(t *testing.T) {
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest, 1)}
+	s := snmptest.NewTrapServer("localhost:0", trapQueue)
+	defer s.Close()
+
+	varBinds := snmpgo.VarBinds{snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp)}
+	args := snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   snmpgo.ListeningUDPAddress(s),
+		Network:   "udp",
+		Timeout:   200 * time.Millisecond,
+		Retries:   2,
+		Community: "public",
+	}
+	snmp, err := snmpgo.NewSNMP(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = snmp.InformRequest(varBinds); err != nil {
+		t.Errorf("InformRequest() - acknowledged, has error %v", err)
+	}
+	if trap := trapQueue.takeNextTrap(); trap == nil || trap.Pdu.PduType() != snmpgo.InformRequest {
+		t.Errorf("InformRequest() - not received, %v", trap)
+	}
+	snmp.Close()
+
+	// a receiver not acknowledging, or acknowledging with the error status
+	for _, ack := range []bool{false, true} {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := make(chan struct{}, 10)
+		go func() {
+			buf := make([]byte, 2048)
+			for {
+				n, src, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				received <- struct{}{}
+				pdu, err := snmpgo.DecodeMessage(snmpgo.V2c, buf[:n], nil)
+				if !ack || err != nil {
+					continue
+				}
+				resp := snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, pdu.VarBinds())
+				resp.SetRequestId(pdu.RequestId())
+				resp.SetErrorStatus(snmpgo.GenError)
+				b, _ := snmpgo.EncodeMessage(&snmpgo.SNMPArguments{Version: snmpgo.V2c, Community: "public"}, resp)
+				conn.WriteTo(b, src)
+			}
+		}()
+
+		args.Address = conn.LocalAddr().String()
+		snmp, err := snmpgo.NewSNMP(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = snmp.InformRequest(varBinds)
+		snmp.Close()
+		conn.Close()
+
+		if !ack {
+			if e, ok := err.(net.Error); !ok || !e.Timeout() {
+				t.Errorf("InformRequest() - not acknowledged, expected timeout, actual %v", err)
+			}
+			if n := len(received); n != int(args.Retries)+1 {
+				t.Errorf("InformRequest() - expected %d transmissions, actual %d", args.Retries+1, n)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), "GenError") {
+			t.Errorf("InformRequest() - expected the error status, actual %v", err)
+		}
+	}
+}
+
+func TestSNMPInformRequestWithTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var received int32
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			if _, _, err := conn.ReadFrom(buf); err != nil {
+				return
+			}
+			atomic.AddInt32(&received, 1)
+		}
+	}()
+
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   conn.LocalAddr().String(),
+		Network:   "udp",
+		Timeout:   5 * time.Second,
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snmp.Close()
+
+	varBinds := snmpgo.VarBinds{snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp)}
+	start := time.Now()
+	err = snmp.InformRequestWithTimeout(varBinds, 50*time.Millisecond, 3)
+	elapsed := time.Since(start)
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Errorf("InformRequestWithTimeout() - expected timeout, actual %v", err)
+	}
+	if elapsed < 200*time.Millisecond || elapsed > time.Second {
+		t.Errorf("InformRequestWithTimeout() - expected 4 attempts of 50ms, actual %v", elapsed)
+	}
+	if n := snmp.LastAttempts(); n != 4 {
+		t.Errorf("InformRequestWithTimeout() - expected 4 attempts, actual %d", n)
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(&received) < 4; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&received); n != 4 {
+		t.Errorf("InformRequestWithTimeout() - expected 4 transmissions, actual %d", n)
+	}
+
+	if err = snmp.InformRequestWithTimeout(varBinds, 0, 11); err == nil {
+		t.Error("InformRequestWithTimeout() - retries out of range")
+	} else if _, ok := err.(*snmpgo.ArgumentError); !ok {
+		t.Errorf("InformRequestWithTimeout() - expected ArgumentError, actual %v", err)
+	}
+}
+
+func TestTrapServerServeContext(t *testing.T) {
+	s, err := snmpgo.NewTrapServer(snmpgo.ServerArguments{LocalAddr: "localhost:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.AddSecurity(&snmpgo.SecurityEntry{Version: snmpgo.V2c, Community: "public"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	trapQueue := &receiveQueue{make(chan *snmpgo.TrapRequest, 1)}
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.ServeContext(ctx, trapQueue) }()
+
+	trapSender := snmptest.NewTrapSender(t, snmpgo.ListeningUDPAddress(s))
+	trapSender.SendV2TrapWithBindings(true, "public",
+		snmpgo.VarBinds{snmpgo.NewVarBind(snmpgo.OidSnmpTrap, snmpgo.OidLinkUp)})
+	if trap := trapQueue.takeNextTrap(); trap == nil || trap.Error != nil {
+		t.Fatalf("trap is not received - %v", trap)
+	}
+
+	cancel()
+	select {
+	case err = <-errCh:
+		if err != context.Canceled {
+			t.Errorf("ServeContext() - expected %v, actual %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeContext() - not returned after the cancellation")
+	}
+
+	// canceled while the server is starting
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() { errCh <- s.ServeContext(ctx, trapQueue) }()
+		cancel()
+		select {
+		case err = <-errCh:
+			if err != context.Canceled {
+				t.Errorf("ServeContext() - expected %v, actual %v", context.Canceled, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("ServeContext() - not returned after the cancellation while starting")
+		}
+	}
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close() - blocked after the cancellation")
+	}
+}
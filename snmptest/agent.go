@@ -0,0 +1,173 @@
+package snmptest
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/k-sone/snmpgo"
+)
+
+// the maximum payload of UDP over IPv4, so that the large responses are not truncated
+const messageMaxSize = 65507
+
+// Agent is a SNMP V2c agent for testing, which answers Get, GetNext, GetBulk and
+// Set requests from the values of the OIDs, or the requests by a handler
+type Agent struct {
+	agent *snmpgo.Agent
+	conn  net.PacketConn
+	mib   *mib // nil unless created by NewAgent
+}
+
+// NewAgent creates a new Agent serving the mib on a random local UDP port
+func NewAgent(t *testing.T, community string, mib snmpgo.VarBinds) *Agent {
+	m := newMib(mib)
+	a := NewAgentWithHandler(t, community, m.handle)
+	a.mib = m
+	return a
+}
+
+// NewAgentWithHandler creates a new Agent answering the requests by the handler
+// on a random local UDP port
+func NewAgentWithHandler(t *testing.T, community string, handler snmpgo.RequestHandler) *Agent {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAgentWithConn(t, conn, community, handler)
+}
+
+// NewAgentWithConn is like NewAgentWithHandler, but receives on the already bound conn
+// (e.g. an IPv6 address), which is closed when the Agent is closed
+func NewAgentWithConn(t *testing.T, conn net.PacketConn, community string,
+	handler snmpgo.RequestHandler) *Agent {
+
+	agent, err := snmpgo.NewAgentWithConn(conn, snmpgo.ServerArguments{
+		MessageMaxSize: messageMaxSize,
+	})
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	if err = agent.AddSecurity(&snmpgo.SecurityEntry{
+		Version:   snmpgo.V2c,
+		Community: community,
+	}); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	go agent.ServeRequests(handler)
+	return &Agent{agent: agent, conn: conn}
+}
+
+// MibHandler returns a handler answering Get, GetNext, GetBulk and Set requests
+// from the values of the OIDs, which are copied and changed by the Set requests
+func MibHandler(mib snmpgo.VarBinds) snmpgo.RequestHandler {
+	return newMib(mib).handle
+}
+
+// Address returns the address to send requests
+func (a *Agent) Address() string {
+	return a.conn.LocalAddr().String()
+}
+
+// Close stops the Agent
+func (a *Agent) Close() {
+	a.agent.Close()
+}
+
+// Value returns the value of the OID, or nil if the OID is not served.
+// It is only available on the Agent created by NewAgent.
+func (a *Agent) Value(oid *snmpgo.Oid) snmpgo.Variable {
+	if a.mib == nil {
+		return nil
+	}
+	return a.mib.value(oid)
+}
+
+// SetValue sets the value of the OID, which is added if it is not served.
+// It is only available on the Agent created by NewAgent.
+func (a *Agent) SetValue(oid *snmpgo.Oid, value snmpgo.Variable) {
+	if a.mib != nil {
+		a.mib.setValue(oid, value)
+	}
+}
+
+type mib struct {
+	lock     sync.Mutex
+	varBinds snmpgo.VarBinds // sorted by OID
+}
+
+func newMib(varBinds snmpgo.VarBinds) *mib {
+	// copies the VarBinds, which are changed by the Set requests
+	copied := make(snmpgo.VarBinds, len(varBinds))
+	for i, v := range varBinds {
+		copied[i] = snmpgo.NewVarBind(v.Oid, v.Variable)
+	}
+	return &mib{varBinds: copied.Sort().Uniq()}
+}
+
+func (m *mib) value(oid *snmpgo.Oid) snmpgo.Variable {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.get(oid)
+}
+
+func (m *mib) setValue(oid *snmpgo.Oid, value snmpgo.Variable) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if v := m.varBinds.MatchOid(oid); v != nil {
+		v.Variable = value
+	} else {
+		m.varBinds = append(m.varBinds, snmpgo.NewVarBind(oid, value)).Sort()
+	}
+}
+
+func (m *mib) handle(req snmpgo.Pdu) snmpgo.Pdu {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if req.PduType() == snmpgo.SetRequest {
+		return m.set(req.VarBinds())
+	}
+	return snmpgo.NewRequestHandler(m.get, m.next)(req)
+}
+
+func (m *mib) get(oid *snmpgo.Oid) snmpgo.Variable {
+	if v := m.varBinds.MatchOid(oid); v != nil {
+		return v.Variable
+	}
+	return nil
+}
+
+// next returns the VarBind following the OID in the lexicographic order
+func (m *mib) next(oid *snmpgo.Oid) *snmpgo.VarBind {
+	for _, v := range m.varBinds {
+		if v.Oid.Compare(oid) > 0 {
+			return snmpgo.NewVarBind(v.Oid, v.Variable)
+		}
+	}
+	return nil
+}
+
+// set changes only the served OIDs with the values of the same type,
+// none of the values are changed if any of them fails
+func (m *mib) set(reqBinds snmpgo.VarBinds) snmpgo.Pdu {
+	res := snmpgo.NewPduWithVarBinds(snmpgo.V2c, snmpgo.GetResponse, reqBinds)
+	for i, v := range reqBinds {
+		served := m.varBinds.MatchOid(v.Oid)
+		switch {
+		case served == nil:
+			res.SetErrorStatus(snmpgo.NoCreation)
+		case served.Variable.Type() != v.Variable.Type():
+			res.SetErrorStatus(snmpgo.WrongType)
+		default:
+			continue
+		}
+		res.SetErrorIndex(i + 1)
+		return res
+	}
+	for _, v := range reqBinds {
+		m.varBinds.MatchOid(v.Oid).Variable = v.Variable
+	}
+	return res
+}
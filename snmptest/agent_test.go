@@ -0,0 +1,115 @@
+package snmptest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/k-sone/snmpgo"
+	"github.com/k-sone/snmpgo/snmptest"
+)
+
+func newAgentSNMP(t *testing.T, agent *snmptest.Agent) *snmpgo.SNMP {
+	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
+		Version:   snmpgo.V2c,
+		Address:   agent.Address(),
+		Network:   "udp4",
+		Timeout:   time.Second,
+		Community: "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snmp
+}
+
+func TestAgentGetNext(t *testing.T) {
+	// the sub-identifiers are compared numerically, not as strings
+	exps := []string{
+		"1.3.6.1.2.1.1.1.0",
+		"1.3.6.1.2.1.2.2.1.2.1",
+		"1.3.6.1.2.1.2.2.1.2.2",
+		"1.3.6.1.2.1.2.2.1.2.10",
+		"1.3.6.1.2.1.2.2.1.10.1",
+	}
+	var mib snmpgo.VarBinds
+	for i := len(exps) - 1; i >= 0; i-- {
+		mib = append(mib, snmpgo.NewVarBind(snmpgo.MustNewOid(exps[i]), snmpgo.NewInteger(int32(i))))
+	}
+	agent := snmptest.NewAgent(t, "public", mib)
+	defer agent.Close()
+
+	snmp := newAgentSNMP(t, agent)
+	defer snmp.Close()
+
+	oid := snmpgo.MustNewOid("1.3.6.1")
+	for i, exp := range exps {
+		pdu, err := snmp.GetNextRequest(snmpgo.Oids{oid})
+		if err != nil {
+			t.Fatalf("GetNextRequest() - has error %v", err)
+		}
+		v := pdu.VarBinds()[0]
+		if v.Oid.String() != exp || v.Variable.String() != snmpgo.NewInteger(int32(i)).String() {
+			t.Fatalf("GetNextRequest(%s) - expected [%s], actual %v", oid, exp, v)
+		}
+		oid = v.Oid
+	}
+
+	pdu, err := snmp.GetNextRequest(snmpgo.Oids{oid})
+	if err != nil || pdu.VarBinds()[0].Variable.Type() != "EndOfMibView" {
+		t.Errorf("GetNextRequest(%s) - expected EndOfMibView, actual %v, err %v", oid, pdu, err)
+	}
+
+	pdu, err = snmp.GetBulkRequest(snmpgo.Oids{snmpgo.MustNewOid("1.3.6.1.2.1.2.2.1.2")}, 0, 3)
+	if err != nil || len(pdu.VarBinds()) != 3 || pdu.VarBinds()[2].Oid.String() != exps[3] {
+		t.Errorf("GetBulkRequest() - expected 3 varbinds to [%s], actual %v, err %v", exps[3], pdu, err)
+	}
+}
+
+func TestAgentGetSet(t *testing.T) {
+	oid := snmpgo.MustNewOid("1.3.6.1.2.1.1.5.0")
+	agent := snmptest.NewAgent(t, "public", snmpgo.VarBinds{
+		snmpgo.NewVarBind(oid, snmpgo.NewOctetString([]byte("MyHost"))),
+	})
+	defer agent.Close()
+
+	snmp := newAgentSNMP(t, agent)
+	defer snmp.Close()
+
+	pdu, err := snmp.GetRequest(snmpgo.Oids{oid, snmpgo.OidSysUpTime})
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if v := pdu.VarBinds(); v[0].Variable.String() != "MyHost" || v[1].Variable.Type() != "NoSuchObject" {
+		t.Errorf("GetRequest() - unexpected varbinds %v", v)
+	}
+
+	pdu, err = snmp.SetRequest(snmpgo.VarBinds{
+		snmpgo.NewVarBind(oid, snmpgo.NewOctetString([]byte("NewHost"))),
+	})
+	if err != nil || pdu.ErrorStatus() != snmpgo.NoError {
+		t.Fatalf("SetRequest() - unexpected response %v, err %v", pdu, err)
+	}
+	if v := agent.Value(oid); v == nil || v.String() != "NewHost" {
+		t.Errorf("SetRequest() - expected [NewHost], actual %v", v)
+	}
+
+	tests := []struct {
+		varBinds snmpgo.VarBinds
+		status   snmpgo.ErrorStatus
+	}{
+		{snmpgo.VarBinds{snmpgo.NewVarBind(oid, snmpgo.NewInteger(1))}, snmpgo.WrongType},
+		{snmpgo.VarBinds{
+			snmpgo.NewVarBind(oid, snmpgo.NewOctetString([]byte("OtherHost"))),
+			snmpgo.NewVarBind(snmpgo.OidSysUpTime, snmpgo.NewTimeTicks(1)),
+		}, snmpgo.NoCreation},
+	}
+	for _, test := range tests {
+		pdu, err = snmp.SetRequest(test.varBinds)
+		if err != nil || pdu.ErrorStatus() != test.status || pdu.ErrorIndex() != len(test.varBinds) {
+			t.Errorf("SetRequest() - expected %s, actual %v, err %v", test.status, pdu, err)
+		}
+	}
+	if v := agent.Value(oid); v == nil || v.String() != "NewHost" {
+		t.Errorf("SetRequest() - expected unchanged [NewHost], actual %v", v)
+	}
+}
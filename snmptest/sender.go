@@ -19,7 +19,7 @@ func (t *TrapSender) SendV2TrapWithBindings(trap bool, community string, v snmpg
 	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
 		Version:   snmpgo.V2c,
 		Address:   t.Address,
-		Network:   "udp4",
+		Network:   "udp",
 		Retries:   1,
 		Community: community,
 	})
@@ -54,7 +54,7 @@ func (t *TrapSender) SendV3TrapWithBindings(v snmpgo.VarBinds, l snmpgo.Security
 	snmp, err := snmpgo.NewSNMP(snmpgo.SNMPArguments{
 		Version:          snmpgo.V3,
 		Address:          t.Address,
-		Network:          "udp4",
+		Network:          "udp",
 		Retries:          1,
 		UserName:         "MyName",
 		SecurityLevel:    l,
@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package snmpgo
+
+import (
+	"syscall"
+)
+
+const bindToDeviceSupported = true
+
+// bindToDeviceControl returns the Control of net.Dialer,
+// which sets the SO_BINDTODEVICE before connecting
+func bindToDeviceControl(device string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			serr = syscall.BindToDevice(int(fd), device)
+		})
+		if err == nil {
+			err = serr
+		}
+		return err
+	}
+}
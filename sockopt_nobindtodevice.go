@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package snmpgo
+
+import (
+	"syscall"
+)
+
+const bindToDeviceSupported = false
+
+func bindToDeviceControl(device string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return &MessageError{Message: "BindToDevice is not supported on this platform"}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package snmpgo
+
+import (
+	"net"
+)
+
+func socketBufferSizes(conn net.Conn) (read, write int, err error) {
+	return 0, 0, &MessageError{Message: "Socket buffer sizes are not supported on this platform"}
+}
+
+func isConnectionRefused(err error) bool {
+	return false
+}
@@ -0,0 +1,43 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package snmpgo
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+func socketBufferSizes(conn net.Conn) (read, write int, err error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, 0, &MessageError{Message: "Connection does not expose the socket"}
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return
+	}
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		if read, serr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF); serr != nil {
+			return
+		}
+		write, serr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	})
+	if err == nil {
+		err = serr
+	}
+	return
+}
+
+// isConnectionRefused returns true if the err is caused by the ICMP port unreachable
+func isConnectionRefused(err error) bool {
+	if e, ok := err.(*net.OpError); ok {
+		err = e.Err
+	}
+	if e, ok := err.(*os.SyscallError); ok {
+		err = e.Err
+	}
+	return err == syscall.ECONNREFUSED
+}
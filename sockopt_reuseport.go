@@ -0,0 +1,26 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package snmpgo
+
+import (
+	"syscall"
+)
+
+const reusePortSupported = true
+
+// reusePortControl sets the SO_REUSEADDR and SO_REUSEPORT before binding,
+// used as the Control of net.ListenConfig
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		if serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); serr != nil {
+			return
+		}
+		serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err == nil {
+		err = serr
+	}
+	return err
+}
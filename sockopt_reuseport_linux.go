@@ -0,0 +1,7 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package snmpgo
+
+// SO_REUSEPORT is not defined in the syscall package on some linux architectures
+const soReusePort = 0xf
@@ -1,6 +1,8 @@
 package snmpgo
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"sync"
 	"time"
@@ -13,27 +15,106 @@ type transport interface {
 	Close(interface{}) error
 }
 
+// serveTransport listens on the transport and reads the packets until the serving returns false.
+// The receive is called with each packet (and the error if it cannot be decoded) by the goroutine
+// reading the packets, so it must not block.
+func serveTransport(t transport, maxSize int, serving func() bool,
+	logf func(format string, args ...interface{}), name string,
+	receive func(conn interface{}, msg message, src net.Addr, err error)) error {
+
+	size := maxSize
+	if size < recvBufferSize {
+		size = recvBufferSize
+	}
+
+	for {
+		conn, err := t.Listen()
+		if !serving() {
+			if conn != nil {
+				// listened after closing
+				t.Close(conn)
+			}
+			return nil
+		}
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Temporary() {
+				continue
+			}
+			return err
+		}
+
+		go func(conn interface{}) {
+			defer t.Close(conn)
+			buf := make([]byte, size)
+			for {
+				_, src, msg, err := t.Read(conn, buf)
+				if _, ok := err.(net.Error); ok {
+					if serving() {
+						logf("%s: failed to read packet: %v", name, err)
+					}
+					return
+				}
+
+				receive(conn, msg, src, err)
+			}
+		}(conn)
+	}
+}
+
+// unconnectedConn is a net.Conn on an unconnected socket, which sends to the addr
+// and receives from any address
+type unconnectedConn struct {
+	net.PacketConn
+	addr net.Addr
+}
+
+func (c *unconnectedConn) Read(b []byte) (int, error) {
+	n, _, err := c.ReadFrom(b)
+	return n, err
+}
+
+func (c *unconnectedConn) Write(b []byte) (int, error) {
+	return c.WriteTo(b, c.addr)
+}
+
+func (c *unconnectedConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
 type packetTransport struct {
 	conn         net.PacketConn
+	boundConn    net.PacketConn // already bound connection, used instead of listening
 	lock         *sync.Mutex
-	anchor       chan struct{}
+	closed       chan struct{} // closed by Close to release the waiting Listen
 	network      string
 	localAddr    string
 	writeTimeout time.Duration
+	reusePort    bool
 }
 
 func (t *packetTransport) Listen() (interface{}, error) {
 	t.lock.Lock()
-	c := t.conn
+	c, closed := t.conn, t.closed
 	t.lock.Unlock()
 	if c != nil {
-		<-t.anchor
+		<-closed
 		return nil, nil
 	}
 
-	c, err := net.ListenPacket(t.network, t.localAddr)
+	var err error
+	t.lock.Lock()
+	c, t.boundConn = t.boundConn, nil
+	t.lock.Unlock()
+	if c == nil {
+		var lc net.ListenConfig
+		if t.reusePort {
+			lc.Control = reusePortControl
+		}
+		c, err = lc.ListenPacket(context.Background(), t.network, t.localAddr)
+	}
 	t.lock.Lock()
 	t.conn = c
+	t.closed = make(chan struct{})
 	t.lock.Unlock()
 	return c, err
 }
@@ -51,11 +132,27 @@ func (t *packetTransport) Read(conn interface{}, buf []byte) (num int, src net.A
 
 		pkt := make([]byte, num)
 		copy(pkt, buf)
-		msg, _, err = unmarshalMessage(pkt)
+		msg, err = unmarshalPacket(pkt)
 		return
 	}
 }
 
+// unmarshalPacket unmarshals a received packet,
+// and recovers from the panic caused by the malformed packet.
+func unmarshalPacket(pkt []byte) (msg message, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			msg = nil
+			err = &MessageError{
+				Message: "Failed to Unmarshal message",
+				Detail:  fmt.Sprintf("panic `%v`, Packet - [%s]", e, toHexStr(pkt, " ")),
+			}
+		}
+	}()
+	msg, _, err = unmarshalMessage(pkt)
+	return
+}
+
 func (t *packetTransport) Write(conn interface{}, pkt []byte, dst net.Addr) error {
 	c := conn.(net.PacketConn)
 	if err := c.SetWriteDeadline(time.Now().Add(t.writeTimeout)); err != nil {
@@ -79,7 +176,7 @@ func (t *packetTransport) Close(_ interface{}) error {
 
 	if c := t.conn; c != nil {
 		t.conn = nil
-		t.anchor <- struct{}{}
+		close(t.closed)
 		return c.Close()
 	}
 	return nil
@@ -90,10 +187,10 @@ func newTransport(args *ServerArguments) transport {
 	case "udp", "udp4", "udp6":
 		return &packetTransport{
 			lock:         new(sync.Mutex),
-			anchor:       make(chan struct{}, 0),
 			network:      args.Network,
 			localAddr:    args.LocalAddr,
 			writeTimeout: args.WriteTimeout,
+			reusePort:    args.ReusePort,
 		}
 	default:
 		return nil
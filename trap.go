@@ -0,0 +1,72 @@
+package snmpgo
+
+// Returns the snmpTrapOID.0 value and the varbinds of the coldStart notification,
+// these can be passed to SNMP.SendTrap
+func NewColdStartTrap() (*Oid, VarBinds) {
+	return OidColdStart, VarBinds{}
+}
+
+// Returns the snmpTrapOID.0 value and the varbinds of the warmStart notification
+func NewWarmStartTrap() (*Oid, VarBinds) {
+	return OidWarmStart, VarBinds{}
+}
+
+// Returns the snmpTrapOID.0 value and the varbinds of the authenticationFailure notification
+func NewAuthenticationFailureTrap() (*Oid, VarBinds) {
+	return OidAuthenticationFailure, VarBinds{}
+}
+
+// Returns the snmpTrapOID.0 value and the varbinds of the linkDown notification.
+// The adminStatus and operStatus are values of the ifAdminStatus and ifOperStatus
+// (e.g. up(1), down(2), testing(3))
+func NewLinkDownTrap(ifIndex, adminStatus, operStatus int) (*Oid, VarBinds) {
+	return OidLinkDown, linkTrapVarBinds(ifIndex, adminStatus, operStatus)
+}
+
+// Returns the snmpTrapOID.0 value and the varbinds of the linkUp notification
+func NewLinkUpTrap(ifIndex, adminStatus, operStatus int) (*Oid, VarBinds) {
+	return OidLinkUp, linkTrapVarBinds(ifIndex, adminStatus, operStatus)
+}
+
+func linkTrapVarBinds(ifIndex, adminStatus, operStatus int) VarBinds {
+	sub := []int{ifIndex}
+	index, _ := OidIfIndex.AppendSubIds(sub)
+	admin, _ := OidIfAdminStatus.AppendSubIds(sub)
+	oper, _ := OidIfOperStatus.AppendSubIds(sub)
+	return VarBinds{
+		NewVarBind(index, NewInteger(int32(ifIndex))),
+		NewVarBind(admin, NewInteger(int32(adminStatus))),
+		NewVarBind(oper, NewInteger(int32(operStatus))),
+	}
+}
+
+// The generic-trap of the enterprise-specific trap in the SNMP V1 Trap-PDU
+const enterpriseSpecificTrap = 6
+
+// ToV2VarBinds returns the sysUpTime.0, snmpTrapOID.0 and snmpTrapEnterprise.0 VarBinds
+// of the SNMP V2 notification translated from the trap (RFC3584 Section 3.1).
+// The snmpTrapOID.0 is the standard trap (e.g. linkDown) of the generic-trap,
+// or the enterprise + 0 + specific-trap of the enterprise-specific trap.
+// Returns nil if the Enterprise or the trap numbers are invalid.
+func (t *TrapPduV1) ToV2VarBinds() VarBinds {
+	enterprise, err := NewOid(t.Enterprise)
+	if err != nil || t.GenericTrap < 0 || t.GenericTrap > enterpriseSpecificTrap {
+		return nil
+	}
+
+	var trapOid *Oid
+	if t.GenericTrap == enterpriseSpecificTrap {
+		trapOid, err = enterprise.AppendSubIds([]int{0, t.SpecificTrap})
+	} else {
+		trapOid, err = oidSnmpTraps.AppendSubIds([]int{t.GenericTrap + 1})
+	}
+	if err != nil {
+		return nil
+	}
+
+	return VarBinds{
+		NewVarBind(OidSysUpTime, NewTimeTicks(uint32(t.TimeStamp))),
+		NewVarBind(OidSnmpTrap, trapOid),
+		NewVarBind(OidSnmpTrapEnterprise, enterprise),
+	}
+}
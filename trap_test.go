@@ -0,0 +1,105 @@
+package snmpgo_test
+
+import (
+	"testing"
+
+	"github.com/k-sone/snmpgo"
+)
+
+func TestNewStandardTraps(t *testing.T) {
+	tests := []struct {
+		f   func() (*snmpgo.Oid, snmpgo.VarBinds)
+		oid string
+	}{
+		{snmpgo.NewColdStartTrap, "1.3.6.1.6.3.1.1.5.1"},
+		{snmpgo.NewWarmStartTrap, "1.3.6.1.6.3.1.1.5.2"},
+		{snmpgo.NewAuthenticationFailureTrap, "1.3.6.1.6.3.1.1.5.5"},
+	}
+	for _, test := range tests {
+		oid, varBinds := test.f()
+		if oid.String() != test.oid {
+			t.Errorf("trap oid - expected [%s], actual [%s]", test.oid, oid)
+		}
+		if len(varBinds) != 0 {
+			t.Errorf("trap varbinds - expected empty, actual %v", varBinds)
+		}
+	}
+}
+
+func TestNewLinkTraps(t *testing.T) {
+	tests := []struct {
+		f   func(int, int, int) (*snmpgo.Oid, snmpgo.VarBinds)
+		oid string
+	}{
+		{snmpgo.NewLinkDownTrap, "1.3.6.1.6.3.1.1.5.3"},
+		{snmpgo.NewLinkUpTrap, "1.3.6.1.6.3.1.1.5.4"},
+	}
+	expVarBinds := []struct {
+		oid   string
+		value string
+	}{
+		{"1.3.6.1.2.1.2.2.1.1.12", "12"},
+		{"1.3.6.1.2.1.2.2.1.7.12", "1"},
+		{"1.3.6.1.2.1.2.2.1.8.12", "2"},
+	}
+
+	for _, test := range tests {
+		oid, varBinds := test.f(12, 1, 2)
+		if oid.String() != test.oid {
+			t.Errorf("trap oid - expected [%s], actual [%s]", test.oid, oid)
+		}
+		if len(varBinds) != len(expVarBinds) {
+			t.Fatalf("trap varbinds - expected %d, actual %v", len(expVarBinds), varBinds)
+		}
+		for i, exp := range expVarBinds {
+			if varBinds[i].Oid.String() != exp.oid || varBinds[i].Variable.String() != exp.value {
+				t.Errorf("trap varbinds[%d] - expected [%s: %s], actual %v",
+					i, exp.oid, exp.value, varBinds[i])
+			}
+			if _, ok := varBinds[i].Variable.(*snmpgo.Integer); !ok {
+				t.Errorf("trap varbinds[%d] - expected Integer, actual %v", i, varBinds[i])
+			}
+		}
+	}
+}
+
+func TestTrapPduV1ToV2VarBinds(t *testing.T) {
+	tests := []struct {
+		trap    snmpgo.TrapPduV1
+		trapOid string
+	}{
+		{snmpgo.TrapPduV1{Enterprise: "1.3.6.1.4.1.9", GenericTrap: 2, TimeStamp: 100}, "1.3.6.1.6.3.1.1.5.3"},
+		{snmpgo.TrapPduV1{Enterprise: "1.3.6.1.4.1.9", GenericTrap: 6, SpecificTrap: 17, TimeStamp: 100},
+			"1.3.6.1.4.1.9.0.17"},
+	}
+
+	for _, test := range tests {
+		varBinds := test.trap.ToV2VarBinds()
+		if len(varBinds) != 3 {
+			t.Fatalf("ToV2VarBinds() - expected 3 varbinds, actual %v", varBinds)
+		}
+		exps := []struct {
+			oid   *snmpgo.Oid
+			value string
+		}{
+			{snmpgo.OidSysUpTime, "0:00:01.00"},
+			{snmpgo.OidSnmpTrap, test.trapOid},
+			{snmpgo.OidSnmpTrapEnterprise, test.trap.Enterprise},
+		}
+		for i, exp := range exps {
+			if !varBinds[i].Oid.Equal(exp.oid) || varBinds[i].Variable.String() != exp.value {
+				t.Errorf("ToV2VarBinds()[%d] - expected [%s: %s], actual %v", i, exp.oid, exp.value, varBinds[i])
+			}
+		}
+	}
+
+	for _, trap := range []snmpgo.TrapPduV1{
+		{Enterprise: "foo", GenericTrap: 2},
+		{Enterprise: "1.3.6.1.4.1.9", GenericTrap: 7},
+		{Enterprise: "1.3.6.1.4.1.9", GenericTrap: 6, SpecificTrap: -1},
+	} {
+		if varBinds := trap.ToV2VarBinds(); varBinds != nil {
+			t.Errorf("ToV2VarBinds() - expected nil with %v, actual %v", trap, varBinds)
+		}
+	}
+}
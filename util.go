@@ -2,9 +2,12 @@ package snmpgo
 
 import (
 	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"net"
@@ -64,12 +67,16 @@ func genMessageId() (id int) {
 	return
 }
 
+// retry calls f until it succeeds up to retries times again.
+// Only the transient errors (the timeout, the temporary network error and
+// the engine time out of the time window) are retried, the other errors
+// (e.g. ArgumentError, the authentication failure) are returned immediately.
 func retry(retries int, f func() error) (err error) {
 	for i := 0; i <= retries; i++ {
 		err = f()
 		switch e := err.(type) {
 		case net.Error:
-			if e.Timeout() {
+			if e.Timeout() || e.Temporary() {
 				continue
 			}
 		case *notInTimeWindowError:
@@ -81,6 +88,18 @@ func retry(retries int, f func() error) (err error) {
 	return
 }
 
+// isConnectionError returns true if the err is caused by the broken connection
+// (e.g. the closed socket, the unreachable agent) instead of the timeout
+func isConnectionError(err error) bool {
+	switch e := err.(type) {
+	case *UnreachableError:
+		return true
+	case net.Error:
+		return !e.Timeout()
+	}
+	return err == io.EOF || err == io.ErrClosedPipe
+}
+
 func confirmedType(t PduType) bool {
 	if t == GetRequest || t == GetNextRequest || t == SetRequest ||
 		t == GetBulkRequest || t == InformRequest {
@@ -89,17 +108,189 @@ func confirmedType(t PduType) bool {
 	return false
 }
 
+// authoritativeType returns true if the sender of the pdu is the authoritative engine
+func authoritativeType(t PduType) bool {
+	return t == SNMPTrapV2 || t == Report
+}
+
+func validateCommunity(community string) error {
+	if l := len(community); l < 1 || l > 255 {
+		return &ArgumentError{
+			Value:   community,
+			Message: "Community length is range 1..255",
+		}
+	}
+	return nil
+}
+
+func validateUsm(userName string, level SecurityLevel, authPassword string,
+	authProtocol AuthProtocol, privPassword string, privProtocol PrivProtocol) error {
+
+	// RFC3414 Section 5
+	if l := len(userName); l < 1 || l > 32 {
+		return &ArgumentError{
+			Value:   userName,
+			Message: "UserName length is range 1..32",
+		}
+	}
+	if level < NoAuthNoPriv || level > AuthPriv {
+		return &ArgumentError{
+			Value:   level,
+			Message: "Illegal SecurityLevel",
+		}
+	}
+	if level > NoAuthNoPriv {
+		if authPassword == "" && authProtocol == "" {
+			return &ArgumentError{
+				Value:   level,
+				Message: fmt.Sprintf("SecurityLevel %s requires AuthPassword and AuthProtocol", level),
+			}
+		}
+		// RFC3414 Section 11.2
+		if len(authPassword) < 8 {
+			return &ArgumentError{
+				Value:   authPassword,
+				Message: "AuthPassword is at least 8 characters in length",
+			}
+		}
+		if p := authProtocol; p != Md5 && p != Sha {
+			return &ArgumentError{
+				Value:   authProtocol,
+				Message: "Illegal AuthProtocol",
+			}
+		}
+	}
+	if level > AuthNoPriv {
+		if privPassword == "" && privProtocol == "" {
+			return &ArgumentError{
+				Value:   level,
+				Message: fmt.Sprintf("SecurityLevel %s requires PrivPassword and PrivProtocol", level),
+			}
+		}
+		// RFC3414 Section 11.2
+		if len(privPassword) < 8 {
+			return &ArgumentError{
+				Value:   privPassword,
+				Message: "PrivPassword is at least 8 characters in length",
+			}
+		}
+		if p := privProtocol; p != Des && p != Aes {
+			return &ArgumentError{
+				Value:   privProtocol,
+				Message: "Illegal PrivProtocol",
+			}
+		}
+	}
+	return nil
+}
+
+// ignoredUsmCredentials returns the names of the credentials which are supplied
+// but not used by the security level
+func ignoredUsmCredentials(level SecurityLevel, authPassword string,
+	authProtocol AuthProtocol, privPassword string, privProtocol PrivProtocol) (names []string) {
+
+	if level < AuthNoPriv {
+		if authPassword != "" {
+			names = append(names, "AuthPassword")
+		}
+		if authProtocol != "" {
+			names = append(names, "AuthProtocol")
+		}
+	}
+	if level < AuthPriv {
+		if privPassword != "" {
+			names = append(names, "PrivPassword")
+		}
+		if privProtocol != "" {
+			names = append(names, "PrivProtocol")
+		}
+	}
+	return
+}
+
+// unmarshalHeaderPartial decodes the identifier and the length octets of a BER object,
+// and returns the contents which may be shorter than the length if the data is truncated
+func unmarshalHeaderPartial(b []byte) (class, tag int, compound bool, contents []byte, err error) {
+	if len(b) < 2 || b[0]&0x1f == 0x1f || b[1] == 0x80 {
+		err = asn1.SyntaxError{Msg: "unsupported or truncated BER header"}
+		return
+	}
+	class = int(b[0] >> 6)
+	compound = b[0]&0x20 != 0
+	tag = int(b[0] & 0x1f)
+
+	length, offset := int(b[1]), 2
+	if length > 0x7f {
+		n := length & 0x7f
+		if n > 4 || len(b) < offset+n {
+			err = asn1.SyntaxError{Msg: "unsupported or truncated BER length"}
+			return
+		}
+		length = 0
+		for _, c := range b[offset : offset+n] {
+			length = length<<8 | int(c)
+		}
+		offset += n
+	}
+
+	contents = b[offset:]
+	if len(contents) > length {
+		contents = contents[:length]
+	}
+	return
+}
+
+// engineIdToBytes decodes the hexadecimal engine id without the "0x" prefix,
+// an engine id is 5..32 octets (RFC 3411 Section 5)
 func engineIdToBytes(engineId string) ([]byte, error) {
+	if len(engineId)%2 != 0 {
+		return nil, &ArgumentError{
+			Value:   engineId,
+			Message: "EngineId must have an even number of hexadecimal digits",
+		}
+	}
 	b, err := hex.DecodeString(engineId)
-	if l := len(b); err != nil || (l < 5 || l > 32) {
+	if err != nil {
+		msg := "EngineId must be a hexadecimal string"
+		if e, ok := err.(hex.InvalidByteError); ok {
+			msg = fmt.Sprintf("%s, invalid character %q", msg, rune(e))
+		}
+		return nil, &ArgumentError{
+			Value:   engineId,
+			Message: msg,
+		}
+	}
+	if l := len(b); l < 5 || l > 32 {
 		return nil, &ArgumentError{
 			Value:   engineId,
-			Message: "EngineId must be a hexadecimal string and length is range 5..32",
+			Message: fmt.Sprintf("EngineId length is range 5..32 octets, actual %d", l),
 		}
 	}
 	return b, nil
 }
 
+// GenerateEngineId returns the hexadecimal engine id of the enterprise and the id
+// in the format of RFC 3411 Section 5 (SnmpEngineID), which can be used as the SecurityEngineId.
+// The first 4 octets are the enterprise number (e.g. 8072 of the net-snmp) with the first bit set,
+// the 5th octet is the format, that is text(4) if the id is printable, otherwise octets(5).
+// The id is truncated to 27 octets, and the first bit of the enterprise is ignored.
+func GenerateEngineId(enterprise uint32, id []byte) string {
+	if len(id) > 27 {
+		id = id[:27]
+	}
+	format := byte(4)
+	for _, c := range id {
+		if c < 0x20 || c > 0x7e {
+			format = 5
+			break
+		}
+	}
+	b := make([]byte, 5, 5+len(id))
+	binary.BigEndian.PutUint32(b, enterprise|0x80000000)
+	b[4] = format
+	return toHexStr(append(b, id...), "")
+}
+
 var hexPrefix *regexp.Regexp = regexp.MustCompile(`^0[xX]`)
 
 func stripHexPrefix(s string) string {
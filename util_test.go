@@ -3,6 +3,7 @@ package snmpgo_test
 import (
 	"fmt"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 
@@ -28,6 +29,60 @@ func TestStripHexPrefix(t *testing.T) {
 	}
 }
 
+func TestEngineIdToBytes(t *testing.T) {
+	b, err := snmpgo.EngineIdToBytes(snmpgo.StripHexPrefix("0x8000000001020304"))
+	if err != nil || snmpgo.ToHexStr(b, "") != "8000000001020304" {
+		t.Errorf("engineIdToBytes() - unexpected result %x, err %v", b, err)
+	}
+
+	for _, c := range []struct {
+		engineId string
+		message  string
+	}{
+		{"800000000102030", "even number"},
+		{"80000000010203zz", "invalid character 'z'"},
+		{snmpgo.StripHexPrefix("0x"), "length"},
+		{"80000000", "length"},
+		{strings.Repeat("00", 33), "length"},
+	} {
+		_, err := snmpgo.EngineIdToBytes(c.engineId)
+		if e, ok := err.(*snmpgo.ArgumentError); !ok || !strings.Contains(e.Message, c.message) {
+			t.Errorf("engineIdToBytes() - [%s] expected error with [%s], actual %v",
+				c.engineId, c.message, err)
+		}
+	}
+}
+
+func TestGenerateEngineId(t *testing.T) {
+	for _, c := range []struct {
+		enterprise uint32
+		id         []byte
+		expStr     string
+	}{
+		// enterprise 8072 = 0x1f88, text format
+		{8072, []byte("snmpgo"), "80001f8804736e6d70676f"},
+		// MAC address, octets format
+		{8072, []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, "80001f8805001122334455"},
+		// the first bit of the enterprise is the format indicator
+		{0x80000001, []byte("a"), "800000010461"},
+		{0x01020304, nil, "8102030404"},
+	} {
+		engineId := snmpgo.GenerateEngineId(c.enterprise, c.id)
+		if engineId != c.expStr {
+			t.Errorf("GenerateEngineId() - expected [%s], actual [%s]", c.expStr, engineId)
+		}
+		if _, err := snmpgo.EngineIdToBytes(engineId); err != nil {
+			t.Errorf("GenerateEngineId() - [%s] is invalid, %v", engineId, err)
+		}
+	}
+
+	// truncated to 32 octets
+	engineId := snmpgo.GenerateEngineId(8072, []byte(strings.Repeat("a", 40)))
+	if b, err := snmpgo.EngineIdToBytes(engineId); err != nil || len(b) != 32 {
+		t.Errorf("GenerateEngineId() - expected 32 octets, actual [%s], err %v", engineId, err)
+	}
+}
+
 func TestRetry(t *testing.T) {
 	count := 0
 	f := func() error {
@@ -55,8 +110,46 @@ func TestRetry(t *testing.T) {
 	if err := snmpgo.Retry(5, f); err == nil || count != 6 {
 		t.Errorf("retry() - error: err=%s, count=%d", err, count)
 	}
+
+	for _, e := range []error{
+		&netError{timeout: true},
+		&netError{temporary: true},
+	} {
+		count = 0
+		f = func() error {
+			count += 1
+			return e
+		}
+		if err := snmpgo.Retry(5, f); err != e || count != 6 {
+			t.Errorf("retry() - transient error: err=%s, count=%d", err, count)
+		}
+	}
+
+	for _, e := range []error{
+		&netError{},
+		&snmpgo.ArgumentError{Message: "error"},
+		&snmpgo.MessageError{Message: "Failed to authenticate"},
+	} {
+		count = 0
+		f = func() error {
+			count += 1
+			return e
+		}
+		if err := snmpgo.Retry(5, f); err != e || count != 1 {
+			t.Errorf("retry() - permanent error: err=%s, count=%d", err, count)
+		}
+	}
+}
+
+type netError struct {
+	timeout   bool
+	temporary bool
 }
 
+func (e *netError) Error() string   { return "net error" }
+func (e *netError) Timeout() bool   { return e.timeout }
+func (e *netError) Temporary() bool { return e.temporary }
+
 func TestRandomRace(t *testing.T) {
 	if c := runtime.GOMAXPROCS(-1); c < 2 {
 		runtime.GOMAXPROCS(runtime.NumCPU() * 2)
@@ -1,14 +1,18 @@
 package snmpgo
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/asn1"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/geoffgarside/ber"
 )
@@ -52,6 +56,18 @@ func NewInteger(i int32) *Integer {
 	return &Integer{i}
 }
 
+// NewIntegerFromInt64 is like NewInteger, but returns an error
+// if the value is out of range of Integer32
+func NewIntegerFromInt64(i int64) (*Integer, error) {
+	if i < math.MinInt32 || i > math.MaxInt32 {
+		return nil, &ArgumentError{
+			Value:   i,
+			Message: fmt.Sprintf("Integer is range %d..%d", math.MinInt32, math.MaxInt32),
+		}
+	}
+	return NewInteger(int32(i)), nil
+}
+
 type OctetString struct {
 	Value []byte
 }
@@ -90,6 +106,19 @@ func NewOctetString(b []byte) *OctetString {
 	return &OctetString{b}
 }
 
+// NewOctetStringFromHex returns the OctetString of the hexadecimal string,
+// the "0x" prefix and the colon separators are optional (e.g. "0xaabbcc" or "aa:bb:cc").
+func NewOctetStringFromHex(s string) (*OctetString, error) {
+	b, err := hex.DecodeString(strings.Replace(stripHexPrefix(s), ":", "", -1))
+	if err != nil {
+		return nil, &ArgumentError{
+			Value:   s,
+			Message: "OctetString must be a hexadecimal string",
+		}
+	}
+	return NewOctetString(b), nil
+}
+
 type Null struct{}
 
 func (v *Null) BigInt() (*big.Int, error) {
@@ -124,8 +153,9 @@ func (v *Oid) BigInt() (*big.Int, error) {
 	return nil, UnsupportedOperation
 }
 
+// Returns a string of this OID in the format specified by SetOidFormat (The default is numeric)
 func (v *Oid) String() string {
-	return v.Value.String()
+	return formatOid(v)
 }
 
 func (v *Oid) Type() string {
@@ -133,10 +163,19 @@ func (v *Oid) Type() string {
 }
 
 func (v *Oid) Marshal() ([]byte, error) {
+	if len(v.Value) == 0 {
+		return []byte{tagObjectIdentifier, 0x00}, nil
+	}
 	return asn1.Marshal(v.Value)
 }
 
 func (v *Oid) Unmarshal(b []byte) (rest []byte, err error) {
+	// a zero-length OID, which some agents send as a placeholder
+	if len(b) >= 2 && b[0] == tagObjectIdentifier && b[1] == 0x00 {
+		v.Value = asn1.ObjectIdentifier{}
+		return b[2:], nil
+	}
+
 	var i asn1.ObjectIdentifier
 	rest, err = ber.Unmarshal(b, &i)
 	if err == nil {
@@ -187,9 +226,16 @@ func (v *Oid) Equal(o *Oid) bool {
 	return v.Value.Equal(o.Value)
 }
 
+// Returns a copy of this OID, which does not share the sub-ids
+func (v *Oid) Copy() *Oid {
+	value := make(asn1.ObjectIdentifier, len(v.Value))
+	copy(value, v.Value)
+	return &Oid{value}
+}
+
 // Returns Oid with additional sub-ids
 func (v *Oid) AppendSubIds(subs []int) (*Oid, error) {
-	buf := bytes.NewBufferString(v.String())
+	buf := bytes.NewBufferString(v.Value.String())
 	for _, i := range subs {
 		buf.WriteString(".")
 		buf.WriteString(strconv.Itoa(i))
@@ -315,20 +361,59 @@ func (o sortableOids) Swap(i, j int) {
 }
 
 func (o sortableOids) Less(i, j int) bool {
-	return o.Oids[i] != nil && o.Oids[i].Compare(o.Oids[j]) < 1
+	return CompareOids(o.Oids[i], o.Oids[j]) < 0
 }
 
+// CompareOids compares the OIDs by the sub-identifiers in the same order as Oids.Sort.
+// Returns 0 if a is equal to b, -1 if a is less than b and 1 if a is greater than b.
+// The nil is greater than any OID.
+func CompareOids(a, b *Oid) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	default:
+		return a.Compare(b)
+	}
+}
+
+// NewOids returns the Oids parsed from the strings,
+// or an OidParseError with the index of the first string that cannot be parsed
 func NewOids(s []string) (oids Oids, err error) {
-	for _, l := range s {
+	for i, l := range s {
 		o, e := NewOid(l)
 		if e != nil {
-			return nil, e
+			return nil, &OidParseError{Index: i, Value: l, Cause: e}
 		}
 		oids = append(oids, o)
 	}
 	return
 }
 
+// ParseOids returns the Oids read from the reader, one OID per line.
+// The leading and trailing spaces are trimmed, the empty lines and the lines starting with '#'
+// are skipped. An OidParseError is returned with the 0-based index of the first line
+// that cannot be parsed.
+func ParseOids(r io.Reader) (oids Oids, err error) {
+	scanner := bufio.NewScanner(r)
+	for n := 0; scanner.Scan(); n++ {
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		o, e := NewOid(l)
+		if e != nil {
+			return nil, &OidParseError{Index: n, Value: l, Cause: e}
+		}
+		oids = append(oids, o)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
 type Ipaddress struct {
 	OctetString
 }
@@ -377,6 +462,11 @@ func (v *Counter32) BigInt() (*big.Int, error) {
 	return big.NewInt(int64(v.Value)), nil
 }
 
+// Uint32 returns the unsigned value, which is shared by Gauge32 and TimeTicks
+func (v *Counter32) Uint32() uint32 {
+	return v.Value
+}
+
 func (v *Counter32) String() string {
 	return strconv.FormatInt(int64(v.Value), 10)
 }
@@ -401,6 +491,15 @@ func NewCounter32(i uint32) *Counter32 {
 	return &Counter32{i}
 }
 
+// NewCounter32FromInt64 is like NewCounter32, but returns an error
+// if the value is out of range of Counter32
+func NewCounter32FromInt64(i int64) (*Counter32, error) {
+	if err := validateUnsigned32("Counter32", i); err != nil {
+		return nil, err
+	}
+	return NewCounter32(uint32(i)), nil
+}
+
 type Gauge32 struct {
 	Counter32
 }
@@ -425,10 +524,52 @@ func NewGauge32(i uint32) *Gauge32 {
 	return &Gauge32{Counter32{i}}
 }
 
+// NewGauge32FromInt64 is like NewGauge32, but returns an error
+// if the value is out of range of Gauge32
+func NewGauge32FromInt64(i int64) (*Gauge32, error) {
+	if err := validateUnsigned32("Gauge32", i); err != nil {
+		return nil, err
+	}
+	return NewGauge32(uint32(i)), nil
+}
+
+func validateUnsigned32(name string, i int64) error {
+	if i < 0 || i > math.MaxUint32 {
+		return &ArgumentError{
+			Value:   i,
+			Message: fmt.Sprintf("%s is range %d..%d", name, 0, uint32(math.MaxUint32)),
+		}
+	}
+	return nil
+}
+
 type TimeTicks struct {
 	Counter32
 }
 
+// Returns the time of this TimeTicks, which is in hundredths of a second
+func (v *TimeTicks) Duration() time.Duration {
+	return time.Duration(v.Value) * 10 * time.Millisecond
+}
+
+// Returns a string like the Timeticks display of Net-SNMP (e.g. "5 days, 3:14:07.00")
+func (v *TimeTicks) String() string {
+	centi := v.Value % 100
+	sec := v.Value / 100
+	days := sec / 86400
+	sec %= 86400
+	clock := fmt.Sprintf("%d:%02d:%02d.%02d", sec/3600, sec/60%60, sec%60, centi)
+
+	switch days {
+	case 0:
+		return clock
+	case 1:
+		return "1 day, " + clock
+	default:
+		return fmt.Sprintf("%d days, %s", days, clock)
+	}
+}
+
 func (v *TimeTicks) Type() string {
 	return "TimeTicks"
 }
@@ -449,6 +590,17 @@ func NewTimeTicks(i uint32) *TimeTicks {
 	return &TimeTicks{Counter32{i}}
 }
 
+// NewUptimeTicks returns the elapsed time since the start in hundredths of a second
+// (e.g. the sysUpTime.0 of notifications), which wraps around to 0 every 2^32 ticks.
+// A start in the future is 0.
+func NewUptimeTicks(start time.Time) *TimeTicks {
+	d := time.Since(start)
+	if d < 0 {
+		d = 0
+	}
+	return NewTimeTicks(uint32(uint64(d/(10*time.Millisecond)) % (math.MaxUint32 + 1)))
+}
+
 type Opaque struct {
 	OctetString
 }
@@ -510,44 +662,44 @@ func NewCounter64(i uint64) *Counter64 {
 	return &Counter64{i}
 }
 
-type NoSucheObject struct {
+type NoSuchObject struct {
 	Null
 }
 
-func (v *NoSucheObject) Type() string {
-	return "NoSucheObject"
+func (v *NoSuchObject) Type() string {
+	return "NoSuchObject"
 }
 
-func (v *NoSucheObject) Marshal() ([]byte, error) {
-	return []byte{tagNoSucheObject, 0}, nil
+func (v *NoSuchObject) Marshal() ([]byte, error) {
+	return []byte{tagNoSuchObject, 0}, nil
 }
 
-func (v *NoSucheObject) Unmarshal(b []byte) (rest []byte, err error) {
-	return unmarshalEmpty(b, tagNoSucheObject)
+func (v *NoSuchObject) Unmarshal(b []byte) (rest []byte, err error) {
+	return unmarshalEmpty(b, tagNoSuchObject)
 }
 
-func NewNoSucheObject() *NoSucheObject {
-	return &NoSucheObject{Null{}}
+func NewNoSuchObject() *NoSuchObject {
+	return &NoSuchObject{Null{}}
 }
 
-type NoSucheInstance struct {
+type NoSuchInstance struct {
 	Null
 }
 
-func (v *NoSucheInstance) Type() string {
-	return "NoSucheInstance"
+func (v *NoSuchInstance) Type() string {
+	return "NoSuchInstance"
 }
 
-func (v *NoSucheInstance) Marshal() ([]byte, error) {
-	return []byte{tagNoSucheInstance, 0}, nil
+func (v *NoSuchInstance) Marshal() ([]byte, error) {
+	return []byte{tagNoSuchInstance, 0}, nil
 }
 
-func (v *NoSucheInstance) Unmarshal(b []byte) (rest []byte, err error) {
-	return unmarshalEmpty(b, tagNoSucheInstance)
+func (v *NoSuchInstance) Unmarshal(b []byte) (rest []byte, err error) {
+	return unmarshalEmpty(b, tagNoSuchInstance)
 }
 
-func NewNoSucheInstance() *NoSucheInstance {
-	return &NoSucheInstance{Null{}}
+func NewNoSuchInstance() *NoSuchInstance {
+	return &NoSuchInstance{Null{}}
 }
 
 type EndOfMibView struct {
@@ -570,6 +722,71 @@ func NewEndOfMibView() *EndOfMibView {
 	return &EndOfMibView{Null{}}
 }
 
+// The UnknownVariable holds an object of the application class whose tag is not defined
+// in the SNMP (e.g. a vendor-specific type), so that the other VarBinds can be decoded
+type UnknownVariable struct {
+	Tag   int    // Tag number of the object
+	Value []byte // Contents octets of the object
+}
+
+func (v *UnknownVariable) BigInt() (*big.Int, error) {
+	return nil, UnsupportedOperation
+}
+
+func (v *UnknownVariable) String() string {
+	return toHexStr(v.Value, " ")
+}
+
+func (v *UnknownVariable) Type() string {
+	return "Unknown"
+}
+
+func (v *UnknownVariable) Marshal() ([]byte, error) {
+	return asn1.Marshal(asn1.RawValue{Class: classApplication, Tag: v.Tag, Bytes: v.Value})
+}
+
+func (v *UnknownVariable) Unmarshal(b []byte) (rest []byte, err error) {
+	var raw asn1.RawValue
+	rest, err = ber.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, err
+	}
+	if raw.Class != classApplication {
+		return nil, asn1.StructuralError{fmt.Sprintf(
+			"Invalid ASN.1 object - Class [%02x], Tag [%02x] : %s",
+			raw.Class, raw.Tag, toHexStr(b, " "))}
+	}
+	v.Tag = raw.Tag
+	v.Value = raw.Bytes
+	return
+}
+
+// Deprecated: Use NoSuchObject instead
+type NoSucheObject = NoSuchObject
+
+// Deprecated: Use NoSuchInstance instead
+type NoSucheInstance = NoSuchInstance
+
+// Deprecated: Use NewNoSuchObject instead
+func NewNoSucheObject() *NoSuchObject {
+	return NewNoSuchObject()
+}
+
+// Deprecated: Use NewNoSuchInstance instead
+func NewNoSucheInstance() *NoSuchInstance {
+	return NewNoSuchInstance()
+}
+
+// Returns true if the variable is an exception
+// (NoSuchObject, NoSuchInstance or EndOfMibView) in a response
+func IsException(v Variable) bool {
+	switch v.(type) {
+	case *NoSuchObject, *NoSuchInstance, *EndOfMibView:
+		return true
+	}
+	return false
+}
+
 func unmarshalVariable(b []byte) (v Variable, rest []byte, err error) {
 	var raw asn1.RawValue
 	rest, err = ber.Unmarshal(b, &raw)
@@ -613,14 +830,17 @@ func unmarshalVariable(b []byte) (v Variable, rest []byte, err error) {
 		case tagCounter64 & tagMask:
 			var u Counter64
 			v = &u
+		default:
+			var u UnknownVariable
+			v = &u
 		}
 	case classContextSpecific:
 		switch raw.Tag {
-		case tagNoSucheObject & tagMask:
-			var u NoSucheObject
+		case tagNoSuchObject & tagMask:
+			var u NoSuchObject
 			v = &u
-		case tagNoSucheInstance & tagMask:
-			var u NoSucheInstance
+		case tagNoSuchInstance & tagMask:
+			var u NoSuchInstance
 			v = &u
 		case tagEndOfMibView & tagMask:
 			var u EndOfMibView
@@ -2,9 +2,12 @@ package snmpgo_test
 
 import (
 	"bytes"
+	"math"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/k-sone/snmpgo"
 )
@@ -124,6 +127,29 @@ func TestOctetString2(t *testing.T) {
 	}
 }
 
+func TestNewOctetStringFromHex(t *testing.T) {
+	expBuf := []byte{0xaa, 0xbb, 0xcc}
+	for _, s := range []string{"0xAABBCC", "AA:BB:CC", "aabbcc", "0Xaa:bb:cc"} {
+		v, err := snmpgo.NewOctetStringFromHex(s)
+		if err != nil {
+			t.Errorf("NewOctetStringFromHex() - [%s] has error %v", s, err)
+			continue
+		}
+		if !bytes.Equal(expBuf, v.Value) {
+			t.Errorf("NewOctetStringFromHex() - [%s] expected [%s], actual [%s]",
+				s, snmpgo.ToHexStr(expBuf, " "), snmpgo.ToHexStr(v.Value, " "))
+		}
+	}
+
+	for _, s := range []string{"0xAABBC", "AA:BB:CG", "AA BB CC"} {
+		if _, err := snmpgo.NewOctetStringFromHex(s); err == nil {
+			t.Errorf("NewOctetStringFromHex() - [%s] is accepted", s)
+		} else if _, ok := err.(*snmpgo.ArgumentError); !ok {
+			t.Errorf("NewOctetStringFromHex() - [%s] expected ArgumentError, actual %v", s, err)
+		}
+	}
+}
+
 func TestNull(t *testing.T) {
 	expStr := ""
 	expBuf := []byte{0x05, 0x00}
@@ -294,6 +320,35 @@ func TestNewOid(t *testing.T) {
 	}
 }
 
+func TestNewOidsParseError(t *testing.T) {
+	strs := []string{"1.3.6.1.2.1.1.1.0", ".1.3.6.1.2.1.1.3.0", "1.3.6.x.1", "3.1"}
+
+	oids, err := snmpgo.NewOids(strs[:2])
+	if err != nil || len(oids) != 2 || oids[1].String() != "1.3.6.1.2.1.1.3.0" {
+		t.Errorf("NewOids() - unexpected oids %v, error %v", oids, err)
+	}
+
+	_, err = snmpgo.NewOids(strs)
+	if e, ok := err.(*snmpgo.OidParseError); !ok || e.Index != 2 || e.Value != "1.3.6.x.1" {
+		t.Errorf("NewOids() - expected the error at 2, actual %v", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), "`1.3.6.x.1` at index 2") {
+		t.Errorf("OidParseError.Error() - expected the value and the index, actual %s", err)
+	}
+
+	r := strings.NewReader("# system\n1.3.6.1.2.1.1.1.0\n\n  .1.3.6.1.2.1.1.3.0  \n")
+	oids, err = snmpgo.ParseOids(r)
+	if err != nil || len(oids) != 2 || oids[1].String() != "1.3.6.1.2.1.1.3.0" {
+		t.Errorf("ParseOids() - unexpected oids %v, error %v", oids, err)
+	}
+
+	r = strings.NewReader(strings.Join(append([]string{"# system", ""}, strs...), "\n"))
+	_, err = snmpgo.ParseOids(r)
+	if e, ok := err.(*snmpgo.OidParseError); !ok || e.Index != 4 || e.Value != "1.3.6.x.1" {
+		t.Errorf("ParseOids() - expected the error at 4, actual %v", err)
+	}
+}
+
 func TestOids(t *testing.T) {
 	oids, _ := snmpgo.NewOids([]string{
 		"1.3.6.1.2.1.1.2.0",
@@ -488,9 +543,59 @@ func TestGauge32(t *testing.T) {
 	}
 }
 
+func TestNewVariableFromInt64(t *testing.T) {
+	for _, i := range []int64{math.MinInt32 - 1, math.MaxInt32 + 1} {
+		if _, err := snmpgo.NewIntegerFromInt64(i); err == nil {
+			t.Errorf("NewIntegerFromInt64(%d) - no error", i)
+		}
+	}
+	if v, err := snmpgo.NewIntegerFromInt64(math.MinInt32); err != nil || v.Value != math.MinInt32 {
+		t.Errorf("NewIntegerFromInt64(%d) - value %v, err %v", int64(math.MinInt32), v, err)
+	}
+
+	for _, i := range []int64{-1, math.MaxUint32 + 1} {
+		if _, err := snmpgo.NewCounter32FromInt64(i); err == nil {
+			t.Errorf("NewCounter32FromInt64(%d) - no error", i)
+		}
+		if _, err := snmpgo.NewGauge32FromInt64(i); err == nil {
+			t.Errorf("NewGauge32FromInt64(%d) - no error", i)
+		}
+	}
+	if v, err := snmpgo.NewCounter32FromInt64(math.MaxUint32); err != nil || v.Value != math.MaxUint32 {
+		t.Errorf("NewCounter32FromInt64(%d) - value %v, err %v", int64(math.MaxUint32), v, err)
+	}
+	if v, err := snmpgo.NewGauge32FromInt64(0); err != nil || v.Value != 0 {
+		t.Errorf("NewGauge32FromInt64(0) - value %v, err %v", v, err)
+	}
+}
+
+func TestUnsigned32Uint32(t *testing.T) {
+	type unsigned32 interface {
+		snmpgo.Variable
+		Uint32() uint32
+	}
+	for _, exp := range []uint32{0, 1 << 31, math.MaxUint32} {
+		for _, v := range []unsigned32{
+			snmpgo.NewCounter32(exp), snmpgo.NewGauge32(exp), snmpgo.NewTimeTicks(exp),
+		} {
+			buf, err := v.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal(): %v", err)
+			}
+			w := reflect.New(reflect.TypeOf(v).Elem()).Interface().(unsigned32)
+			if _, err = w.Unmarshal(buf); err != nil {
+				t.Fatalf("Unmarshal(): %v", err)
+			}
+			if w.Uint32() != exp {
+				t.Errorf("%s.Uint32() - expected [%d], actual [%d]", v.Type(), exp, w.Uint32())
+			}
+		}
+	}
+}
+
 func TestTimeTicks(t *testing.T) {
 	expInt := int64(4294967295)
-	expStr := "4294967295"
+	expStr := "497 days, 2:27:52.95"
 	expBuf := []byte{0x43, 0x05, 0x00, 0xff, 0xff, 0xff, 0xff}
 	var v snmpgo.Variable = snmpgo.NewTimeTicks(uint32(expInt))
 
@@ -534,6 +639,61 @@ func TestTimeTicks(t *testing.T) {
 	}
 }
 
+func TestTimeTicksDuration(t *testing.T) {
+	tests := []struct {
+		ticks    uint32
+		duration time.Duration
+		str      string
+	}{
+		{0, 0, "0:00:00.00"},
+		{7, 70 * time.Millisecond, "0:00:00.07"},
+		{99, 990 * time.Millisecond, "0:00:00.99"},
+		{100, time.Second, "0:00:01.00"},
+		{8640000, 24 * time.Hour, "1 day, 0:00:00.00"},
+		{44364700, 5*24*time.Hour + 3*time.Hour + 14*time.Minute + 7*time.Second, "5 days, 3:14:07.00"},
+		{4294967295, 4294967295 * 10 * time.Millisecond, "497 days, 2:27:52.95"},
+	}
+
+	for _, test := range tests {
+		v := snmpgo.NewTimeTicks(test.ticks)
+		if d := v.Duration(); d != test.duration {
+			t.Errorf("Duration() - expected [%v], actual [%v]", test.duration, d)
+		}
+		if s := v.String(); s != test.str {
+			t.Errorf("String() - expected [%s], actual [%s]", test.str, s)
+		}
+	}
+
+	// the maximum ticks does not overflow in the conversion
+	v := snmpgo.NewTimeTicks(math.MaxUint32)
+	exp := 497*24*time.Hour + 2*time.Hour + 27*time.Minute + 52*time.Second + 950*time.Millisecond
+	if d := v.Duration(); d != exp {
+		t.Errorf("Duration() max - expected [%v], actual [%v]", exp, d)
+	}
+}
+
+func TestNewUptimeTicks(t *testing.T) {
+	const wrap = 4294967296 * 10 * time.Millisecond
+	tests := []struct {
+		elapsed time.Duration
+		ticks   uint32
+	}{
+		{0, 0},
+		{1234560 * time.Millisecond, 123456},
+		{wrap - time.Second, 4294967196},
+		{wrap + 100*time.Second, 10000},
+		{-time.Hour, 0},
+	}
+
+	for _, test := range tests {
+		v := snmpgo.NewUptimeTicks(time.Now().Add(-test.elapsed))
+		// allows the ticks elapsed while testing
+		if v.Value-test.ticks > 10 {
+			t.Errorf("NewUptimeTicks(%v) - expected [%d], actual [%d]", test.elapsed, test.ticks, v.Value)
+		}
+	}
+}
+
 func TestOpaque(t *testing.T) {
 	expStr := "54:65:73:74"
 	expBuf := []byte{0x44, 0x04, 0x54, 0x65, 0x73, 0x74}
@@ -622,10 +782,10 @@ func TestCounter64(t *testing.T) {
 	}
 }
 
-func TestNoSucheObject(t *testing.T) {
+func TestNoSuchObject(t *testing.T) {
 	expStr := ""
 	expBuf := []byte{0x80, 0x00}
-	var v snmpgo.Variable = snmpgo.NewNoSucheObject()
+	var v snmpgo.Variable = snmpgo.NewNoSuchObject()
 
 	_, err := v.BigInt()
 	if err == nil {
@@ -645,7 +805,7 @@ func TestNoSucheObject(t *testing.T) {
 			snmpgo.ToHexStr(expBuf, " "), snmpgo.ToHexStr(buf, " "))
 	}
 
-	var w snmpgo.NoSucheObject
+	var w snmpgo.NoSuchObject
 	rest, err := (&w).Unmarshal(buf)
 	if len(rest) != 0 || err != nil {
 		t.Errorf("Unmarshal() - len[%d] err[%v]", len(rest), err)
@@ -664,10 +824,10 @@ func TestNoSucheObject(t *testing.T) {
 	}
 }
 
-func TestNoSucheInstance(t *testing.T) {
+func TestNoSuchInstance(t *testing.T) {
 	expStr := ""
 	expBuf := []byte{0x81, 0x00}
-	var v snmpgo.Variable = snmpgo.NewNoSucheInstance()
+	var v snmpgo.Variable = snmpgo.NewNoSuchInstance()
 
 	_, err := v.BigInt()
 	if err == nil {
@@ -687,7 +847,7 @@ func TestNoSucheInstance(t *testing.T) {
 			snmpgo.ToHexStr(expBuf, " "), snmpgo.ToHexStr(buf, " "))
 	}
 
-	var w snmpgo.NoSucheInstance
+	var w snmpgo.NoSuchInstance
 	rest, err := (&w).Unmarshal(buf)
 	if len(rest) != 0 || err != nil {
 		t.Errorf("Unmarshal() - len[%d] err[%v]", len(rest), err)
@@ -747,3 +907,75 @@ func TestEndOfMibView(t *testing.T) {
 		t.Errorf("Unmarshal() with rest - expected [%s], actual [%s]", expStr, w.String())
 	}
 }
+
+func TestIsException(t *testing.T) {
+	exceptions := []snmpgo.Variable{
+		snmpgo.NewNoSuchObject(),
+		snmpgo.NewNoSuchInstance(),
+		snmpgo.NewEndOfMibView(),
+		snmpgo.NewNoSucheObject(),
+		snmpgo.NewNoSucheInstance(),
+	}
+	for _, v := range exceptions {
+		if !snmpgo.IsException(v) {
+			t.Errorf("IsException() - expected true, actual false for %s", v.Type())
+		}
+	}
+
+	values := []snmpgo.Variable{
+		snmpgo.NewInteger(0),
+		snmpgo.NewOctetString([]byte{}),
+		snmpgo.NewNull(),
+		snmpgo.MustNewOid("1.3.6.1"),
+		snmpgo.NewCounter32(0),
+		nil,
+	}
+	for _, v := range values {
+		if snmpgo.IsException(v) {
+			t.Errorf("IsException() - expected false, actual true for %v", v)
+		}
+	}
+
+	var _ *snmpgo.NoSuchObject = snmpgo.NewNoSucheObject()
+	var _ *snmpgo.NoSucheInstance = snmpgo.NewNoSuchInstance()
+}
+
+func TestCompareOids(t *testing.T) {
+	tests := []struct {
+		a, b string
+		exp  int
+	}{
+		{"1.3.6.1", "1.3.6.1", 0},
+		{"1.3.6.1", "1.3.6.1.1", -1},
+		{"1.3.6.1.1", "1.3.6.1", 1},
+		{"1.3.6.1.2", "1.3.6.1.10", -1},
+		{"1.3.6.1.10", "1.3.6.1.2", 1},
+		{"1.3.6.1.2.1", "1.3.6.1.10", -1},
+	}
+	for _, test := range tests {
+		a, b := snmpgo.MustNewOid(test.a), snmpgo.MustNewOid(test.b)
+		if c := snmpgo.CompareOids(a, b); c != test.exp {
+			t.Errorf("CompareOids(%s, %s) - expected [%d], actual [%d]", a, b, test.exp, c)
+		}
+	}
+
+	oid := snmpgo.MustNewOid("1.3.6.1")
+	if snmpgo.CompareOids(oid, nil) != -1 || snmpgo.CompareOids(nil, oid) != 1 ||
+		snmpgo.CompareOids(nil, nil) != 0 {
+		t.Error("CompareOids() - nil ordering")
+	}
+
+	oids, _ := snmpgo.NewOids([]string{"1.3.6.1.10", "1.3.6.1.1", "1.3.6.1", "1.3.6.1.2"})
+	oids = append(oids, nil)
+	oids[0], oids[4] = oids[4], oids[0]
+	expOids := []string{"1.3.6.1", "1.3.6.1.1", "1.3.6.1.2", "1.3.6.1.10"}
+	oids = oids.Sort()
+	for i, exp := range expOids {
+		if oids[i] == nil || oids[i].String() != exp {
+			t.Errorf("Sort() - expected [%s], actual [%v]", exp, oids[i])
+		}
+	}
+	if oids[4] != nil {
+		t.Errorf("Sort() - expected nil at the last, actual [%v]", oids[4])
+	}
+}